@@ -1,5 +1,22 @@
 package es
 
+import (
+	"errors"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// versionConflictType ES乐观锁冲突时返回的错误类型
+const versionConflictType = "version_conflict_engine_exception"
+
+// ErrVersionConflict 带 if_seq_no/if_primary_term 条件写入时，文档已被其他写入方修改
+var ErrVersionConflict = errors.New("es version conflict")
+
+// IsVersionConflict 判断是否乐观锁冲突，调用方一般需要重新Get后再写入
+func IsVersionConflict(err error) bool {
+	return errors.Is(err, ErrVersionConflict) || gerror.Cause(err) == ErrVersionConflict
+}
+
 type errorCause struct {
 	Type   string `json:"type"`
 	Reason string `json:"reason"`
@@ -10,6 +10,8 @@ import (
 	"github.com/gogf/gf/frame/g"
 	"github.com/gogf/gf/frame/gins"
 	"github.com/gogf/gf/util/gconv"
+
+	"github.com/olaola-chat/slp-library/redact"
 )
 
 const (
@@ -57,35 +59,23 @@ type EsInstance struct {
 	EsVpc  *Client
 }
 
-var instance *EsInstance
-
-// 初始化redis实例
-func init() {
-	g.Log().Info("init es instance")
-	instance = &EsInstance{
-		EsUser: EsClientInit(EsUser),
-		EsNew:  EsClientInit(EsNew),
-		EsRush: EsClientInit(EsRush),
-		EsVpc:  EsClientInit(EsVpc),
-	}
-}
-
+// EsClient 根据集群名字获取ES实例，第一次使用时才读取配置
+// 不在import时初始化，没有ES配置的服务和单元测试也可以引用本包
 func EsClient(name string) *Client {
 	switch name {
-	case EsUser:
-		return instance.EsUser
-	case EsNew:
-		return instance.EsNew
-	case EsRush:
-		return instance.EsRush
-	case EsVpc:
-		return instance.EsVpc
-
+	case EsUser, EsNew, EsRush, EsVpc:
+		return EsClientInit(name)
 	default:
 		panic(gerror.New("get es client error"))
 	}
 }
 
+// SetClient 替换 name 对应的ES实例，不再读取配置
+// 主要用于单元测试时指向 estest 启动的内存ES服务
+func SetClient(name string, client *Client) {
+	gins.Set(fmt.Sprintf("self-go-es.%s", name), client)
+}
+
 // Client 封装ES常用方法
 type Client struct {
 	Config *Config
@@ -134,25 +124,96 @@ func (c *Client) Get(index, docID string, fields ...[]string) (*GetResponse, err
 	return res, err
 }
 
-func (c *Client) Put(index, docID string, data map[string]interface{}) error {
+// Condition 乐观锁写入条件，对应ES的 if_seq_no/if_primary_term
+// 一般由 GetResponse.Condition 生成，文档在此期间被修改会返回 ErrVersionConflict
+type Condition struct {
+	SeqNo       int64
+	PrimaryTerm int64
+}
+
+// query 拼接到url上的参数
+func (c *Condition) query() string {
+	return fmt.Sprintf("if_seq_no=%d&if_primary_term=%d", c.SeqNo, c.PrimaryTerm)
+}
+
+// withCondition 如果传了写入条件，拼接到url上
+func withCondition(url string, cond []*Condition) string {
+	if len(cond) == 0 || cond[0] == nil {
+		return url
+	}
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	return url + sep + cond[0].query()
+}
+
+// Put ES 写入整个文档，cond 不为空时为乐观锁写入
+func (c *Client) Put(index, docID string, data map[string]interface{}, cond ...*Condition) error {
 	res := &PutResponse{}
-	url := fmt.Sprintf("%s/default/%s", index, docID)
+	url := withCondition(fmt.Sprintf("%s/default/%s", index, docID), cond)
 	err := c.exec(url, HTTPPost, data, res)
 	return err
 }
 
-func (c *Client) Update(index string, id uint64, data map[string]interface{}) error {
+// Update ES 局部更新文档，cond 不为空时为乐观锁更新
+func (c *Client) Update(index string, id uint64, data map[string]interface{}, cond ...*Condition) error {
 	res := &PutResponse{}
-	url := fmt.Sprintf("%s/default/%d/_update", index, id)
+	url := withCondition(fmt.Sprintf("%s/default/%d/_update", index, id), cond)
 	updateData := make(map[string]interface{})
 	updateData["doc"] = data
 	err := c.exec(url, HTTPPost, updateData, res)
 	return err
 }
 
-func (c *Client) Delete(index string, id uint64) error {
+// Upsert ES 文档存在则局部更新，不存在则以 data 创建
+func (c *Client) Upsert(index string, id uint64, data map[string]interface{}) error {
+	res := &PutResponse{}
+	url := fmt.Sprintf("%s/default/%d/_update", index, id)
+	updateData := map[string]interface{}{
+		"doc":           data,
+		"doc_as_upsert": true,
+	}
+	err := c.exec(url, HTTPPost, updateData, res)
+	return err
+}
+
+// Script 定义painless脚本，参数通过 Params 传递，不要拼接到 Source 里，否则ES每次都要重新编译
+type Script struct {
+	Source string                 `json:"source"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Lang   string                 `json:"lang,omitempty"`
+}
+
+// NewScript 创建一个painless脚本
+func NewScript(source string, params map[string]interface{}) *Script {
+	return &Script{
+		Source: source,
+		Params: params,
+		Lang:   "painless",
+	}
+}
+
+// UpdateScript ES 使用脚本更新文档
+// upsert 不为空时，文档不存在则以 upsert 创建(不执行脚本)
+// cond 不为空时为乐观锁更新
+func (c *Client) UpdateScript(index string, id uint64, script *Script, upsert map[string]interface{}, cond ...*Condition) error {
+	res := &PutResponse{}
+	url := withCondition(fmt.Sprintf("%s/default/%d/_update", index, id), cond)
+	updateData := map[string]interface{}{
+		"script": script,
+	}
+	if upsert != nil {
+		updateData["upsert"] = upsert
+	}
+	err := c.exec(url, HTTPPost, updateData, res)
+	return err
+}
+
+// Delete ES 删除文档，cond 不为空时为乐观锁删除
+func (c *Client) Delete(index string, id uint64, cond ...*Condition) error {
 	res := &PutResponse{}
-	url := fmt.Sprintf("%s/default/%d", index, id)
+	url := withCondition(fmt.Sprintf("%s/default/%d", index, id), cond)
 	err := c.exec(url, HTTPDelete, nil, res)
 	return err
 }
@@ -161,6 +222,25 @@ func (c *Client) execGet(url string, pointer interface{}) error {
 	return c.exec(url, HTTPGet, nil, pointer)
 }
 
+// maxLogBody 日志中请求和返回最多记录的字节数，搜索结果等大的内容只记录开头
+const maxLogBody = 2048
+
+// logBody 按文本脱敏后截断，多取一段再截断，避免截断处的值没有被完整匹配
+func logBody(data []byte) string {
+	if len(data) <= maxLogBody {
+		return redact.String(string(data))
+	}
+	end := maxLogBody + 256
+	if end > len(data) {
+		end = len(data)
+	}
+	s := redact.String(string(data[:end]))
+	if len(s) > maxLogBody {
+		s = s[:maxLogBody]
+	}
+	return fmt.Sprintf("%s...(%d bytes)", s, len(data))
+}
+
 func (c *Client) exec(url string, method string, data interface{}, pointer interface{}) error {
 	var body []byte
 	queryURL := fmt.Sprintf("http://%s:%d/%s", c.Config.Host, c.Config.Port, url)
@@ -179,6 +259,8 @@ func (c *Client) exec(url string, method string, data interface{}, pointer inter
 		}
 	} else if method == HTTPGet {
 		body = client.GetBytes(queryURL)
+	} else if method == HTTPDelete {
+		body = client.DeleteBytes(queryURL)
 	} else {
 		return gerror.New("method error")
 	}
@@ -186,21 +268,19 @@ func (c *Client) exec(url string, method string, data interface{}, pointer inter
 	if len(body) == 0 {
 		return gerror.New("http request error")
 	}
-	g.Log().Printf("exec:%v, %v, %v", queryURL, string(datastr), string(body))
-	normalError := json.Unmarshal(body, pointer)
-	if normalError == nil {
-		return nil
-	}
+	//请求和返回中可能有手机号、token等，脱敏后记录
+	g.Log().Printf("exec:%v, %v, %v", redact.URL(queryURL), logBody(datastr), logBody(body))
 
-	//尝试解析是不是ErrorResponse
+	//先尝试解析是不是ErrorResponse
+	//错误内容也能被解析到正常的返回结构里，不先判断的话错误会被吞掉
 	errorRes := &ErrorResponse{}
 	err := json.Unmarshal(body, errorRes)
-	if err == nil {
-		if errorRes.Error.Reason == "" {
-			return normalError
+	if err == nil && errorRes.Error.Reason != "" {
+		if errorRes.Error.Type == versionConflictType {
+			return gerror.Wrap(ErrVersionConflict, errorRes.Error.Reason)
 		}
 		return gerror.New(errorRes.Error.Reason)
 	}
 
-	return normalError
+	return json.Unmarshal(body, pointer)
 }
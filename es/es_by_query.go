@@ -0,0 +1,63 @@
+package es
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// byQuery 执行 _update_by_query/_delete_by_query
+// 遇到版本冲突继续执行(conflicts=proceed)，冲突数量见 VersionConflicts
+func (c *Client) byQuery(index, action string, body map[string]interface{}, async bool) (*ByQueryResponse, error) {
+	res := &ByQueryResponse{}
+	queryURL := fmt.Sprintf("%s/%s?conflicts=proceed", index, action)
+	if async {
+		queryURL += "&wait_for_completion=false"
+	}
+	err := c.exec(queryURL, HTTPPost, body, res)
+	return res, err
+}
+
+// updateByQueryBody script 为空时只是按新的mapping重新索引文档
+func updateByQueryBody(query interface{}, script *Script) map[string]interface{} {
+	body := map[string]interface{}{
+		"query": query,
+	}
+	if script != nil {
+		body["script"] = script
+	}
+	return body
+}
+
+// UpdateByQuery ES 按条件批量执行脚本更新，同步等待执行完成
+// 文档较多时请使用 UpdateByQueryAsync，请求超时时间只有1s
+func (c *Client) UpdateByQuery(index string, query interface{}, script *Script) (*ByQueryResponse, error) {
+	return c.byQuery(index, "_update_by_query", updateByQueryBody(query, script), false)
+}
+
+// UpdateByQueryAsync ES 按条件批量执行脚本更新，返回任务ID，通过 Task 查询进度
+func (c *Client) UpdateByQueryAsync(index string, query interface{}, script *Script) (string, error) {
+	res, err := c.byQuery(index, "_update_by_query", updateByQueryBody(query, script), true)
+	return res.Task, err
+}
+
+// DeleteByQuery ES 按条件批量删除，同步等待执行完成
+func (c *Client) DeleteByQuery(index string, query interface{}) (*ByQueryResponse, error) {
+	return c.byQuery(index, "_delete_by_query", map[string]interface{}{
+		"query": query,
+	}, false)
+}
+
+// DeleteByQueryAsync ES 按条件批量删除，返回任务ID，通过 Task 查询进度
+func (c *Client) DeleteByQueryAsync(index string, query interface{}) (string, error) {
+	res, err := c.byQuery(index, "_delete_by_query", map[string]interface{}{
+		"query": query,
+	}, true)
+	return res.Task, err
+}
+
+// Task 查询异步任务的执行进度
+func (c *Client) Task(taskID string) (*TaskResponse, error) {
+	res := &TaskResponse{}
+	err := c.execGet(fmt.Sprintf("_tasks/%s", url.PathEscape(taskID)), res)
+	return res, err
+}
@@ -0,0 +1,230 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// recorded 测试服务收到的请求
+type recorded struct {
+	method string
+	path   string
+	query  map[string]string
+	body   map[string]interface{}
+}
+
+// newRecordServer 记录收到的请求，返回固定的响应
+func newRecordServer(t *testing.T, status int, response string) (*Client, *recorded) {
+	t.Helper()
+	req := &recorded{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req.method, req.path = r.Method, r.URL.Path
+		req.query = make(map[string]string)
+		for k, v := range r.URL.Query() {
+			req.query[k] = v[0]
+		}
+		req.body = nil
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &req.body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &Client{Config: &Config{Host: host, Port: uint16(p)}}, req
+}
+
+func TestClientConditionalWrites(t *testing.T) {
+	script := NewScript("ctx._source.rank += params.n", map[string]interface{}{"n": 1})
+	cond := &Condition{SeqNo: 7, PrimaryTerm: 2}
+	tests := []struct {
+		name     string
+		call     func(c *Client) error
+		method   string
+		path     string
+		query    map[string]string
+		bodyKeys []string
+		noUpsert bool
+	}{
+		{
+			name:     "UpdateScript with condition",
+			call:     func(c *Client) error { return c.UpdateScript("room", 1, script, nil, cond) },
+			method:   http.MethodPost,
+			path:     "/room/default/1/_update",
+			query:    map[string]string{"if_seq_no": "7", "if_primary_term": "2"},
+			bodyKeys: []string{"script"},
+			noUpsert: true,
+		},
+		{
+			name:     "UpdateScript with upsert",
+			call:     func(c *Client) error { return c.UpdateScript("room", 2, script, map[string]interface{}{"rank": 1}) },
+			method:   http.MethodPost,
+			path:     "/room/default/2/_update",
+			query:    map[string]string{},
+			bodyKeys: []string{"script", "upsert"},
+		},
+		{
+			name:     "Update with condition",
+			call:     func(c *Client) error { return c.Update("room", 3, map[string]interface{}{"rank": 1}, cond) },
+			method:   http.MethodPost,
+			path:     "/room/default/3/_update",
+			query:    map[string]string{"if_seq_no": "7", "if_primary_term": "2"},
+			bodyKeys: []string{"doc"},
+			noUpsert: true,
+		},
+		{
+			name:     "Delete with condition",
+			call:     func(c *Client) error { return c.Delete("room", 4, cond) },
+			method:   http.MethodDelete,
+			path:     "/room/default/4",
+			query:    map[string]string{"if_seq_no": "7", "if_primary_term": "2"},
+			noUpsert: true,
+		},
+	}
+	for _, tt := range tests {
+		client, req := newRecordServer(t, http.StatusOK, `{"result":"updated"}`)
+		if err := tt.call(client); err != nil {
+			t.Fatalf("%s error = %v", tt.name, err)
+		}
+		if req.method != tt.method || req.path != tt.path {
+			t.Errorf("%s request = %s %s, want %s %s", tt.name, req.method, req.path, tt.method, tt.path)
+		}
+		if len(req.query) != len(tt.query) {
+			t.Errorf("%s query = %v, want %v", tt.name, req.query, tt.query)
+		}
+		for k, v := range tt.query {
+			if req.query[k] != v {
+				t.Errorf("%s query %s = %q, want %q", tt.name, k, req.query[k], v)
+			}
+		}
+		for _, k := range tt.bodyKeys {
+			if _, ok := req.body[k]; !ok {
+				t.Errorf("%s body = %v, missing %s", tt.name, req.body, k)
+			}
+		}
+		if _, ok := req.body["upsert"]; ok && tt.noUpsert {
+			t.Errorf("%s body = %v, unexpected upsert", tt.name, req.body)
+		}
+	}
+}
+
+func TestClientByQuery(t *testing.T) {
+	query := map[string]interface{}{"term": map[string]interface{}{"app_id": 88}}
+	script := NewScript("ctx._source.rank = 0", nil)
+	tests := []struct {
+		name     string
+		call     func(c *Client) (interface{}, error)
+		path     string
+		query    map[string]string
+		response string
+		check    func(res interface{}) bool
+	}{
+		{
+			name:     "UpdateByQuery",
+			call:     func(c *Client) (interface{}, error) { return c.UpdateByQuery("room", query, script) },
+			path:     "/room/_update_by_query",
+			query:    map[string]string{"conflicts": "proceed"},
+			response: `{"total":3,"updated":2,"version_conflicts":1}`,
+			check: func(res interface{}) bool {
+				r := res.(*ByQueryResponse)
+				return r.Total == 3 && r.Updated == 2 && r.VersionConflicts == 1
+			},
+		},
+		{
+			name:     "UpdateByQueryAsync",
+			call:     func(c *Client) (interface{}, error) { return c.UpdateByQueryAsync("room", query, nil) },
+			path:     "/room/_update_by_query",
+			query:    map[string]string{"conflicts": "proceed", "wait_for_completion": "false"},
+			response: `{"task":"node:42"}`,
+			check:    func(res interface{}) bool { return res.(string) == "node:42" },
+		},
+		{
+			name:     "DeleteByQuery",
+			call:     func(c *Client) (interface{}, error) { return c.DeleteByQuery("room", query) },
+			path:     "/room/_delete_by_query",
+			query:    map[string]string{"conflicts": "proceed"},
+			response: `{"total":2,"deleted":2}`,
+			check:    func(res interface{}) bool { return res.(*ByQueryResponse).Deleted == 2 },
+		},
+		{
+			name:     "Task",
+			call:     func(c *Client) (interface{}, error) { return c.Task("node:42") },
+			path:     "/_tasks/node:42",
+			query:    map[string]string{},
+			response: `{"completed":true,"task":{"status":{"total":4,"updated":1,"version_conflicts":1}}}`,
+			check: func(res interface{}) bool {
+				r := res.(*TaskResponse)
+				return r.Completed && r.Task.Status.Processed() == 2 && r.Task.Status.Progress() == 0.5
+			},
+		},
+	}
+	for _, tt := range tests {
+		client, req := newRecordServer(t, http.StatusOK, tt.response)
+		res, err := tt.call(client)
+		if err != nil {
+			t.Fatalf("%s error = %v", tt.name, err)
+		}
+		if req.path != tt.path {
+			t.Errorf("%s path = %s, want %s", tt.name, req.path, tt.path)
+		}
+		if len(req.query) != len(tt.query) {
+			t.Errorf("%s query = %v, want %v", tt.name, req.query, tt.query)
+		}
+		for k, v := range tt.query {
+			if req.query[k] != v {
+				t.Errorf("%s query %s = %q, want %q", tt.name, k, req.query[k], v)
+			}
+		}
+		if !tt.check(res) {
+			t.Errorf("%s result = %+v", tt.name, res)
+		}
+	}
+}
+
+func TestClientVersionConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		conflict bool
+	}{
+		{
+			name:     "version conflict",
+			response: `{"error":{"type":"version_conflict_engine_exception","reason":"[1]: version conflict, required seqNo [7]"},"status":409}`,
+			conflict: true,
+		},
+		{
+			name:     "other error",
+			response: `{"error":{"type":"document_missing_exception","reason":"[1]: document missing"},"status":404}`,
+		},
+	}
+	for _, tt := range tests {
+		client, _ := newRecordServer(t, http.StatusConflict, tt.response)
+		err := client.UpdateScript("room", 1, NewScript("ctx._source.rank++", nil), nil, &Condition{SeqNo: 7, PrimaryTerm: 1})
+		if err == nil {
+			t.Fatalf("%s error = nil", tt.name)
+		}
+		if IsVersionConflict(err) != tt.conflict {
+			t.Errorf("%s IsVersionConflict(%v) = %v, want %v", tt.name, err, !tt.conflict, tt.conflict)
+		}
+	}
+}
+
+func TestLogBody(t *testing.T) {
+	if got := logBody([]byte(`{"mobile":"13812345678","name":"tom"}`)); got != `{"mobile":"138****678","name":"tom"}` {
+		t.Errorf("logBody() = %s", got)
+	}
+	large := append([]byte(`{"token":"abc def",`), make([]byte, maxLogBody*2)...)
+	got := logBody(large)
+	if !strings.HasPrefix(got, `{"token":"***",`) || !strings.HasSuffix(got, fmt.Sprintf("...(%d bytes)", len(large))) || len(got) > maxLogBody+32 {
+		t.Errorf("logBody(large) = %.64s..., len %d", got, len(got))
+	}
+}
@@ -0,0 +1,229 @@
+package estest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/olaola-chat/slp-library/es"
+)
+
+const testIndex = "room"
+
+func newTestServer(t *testing.T) *Server {
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	srv.Seed(testIndex, "1", map[string]interface{}{"name": "Happy Room", "app_id": 88, "property": "vip", "rank": 30})
+	srv.Seed(testIndex, "2", map[string]interface{}{"name": "快乐 派对", "app_id": 88, "property": "normal", "rank": 10})
+	srv.Seed(testIndex, "3", map[string]interface{}{"name": "happy hour", "app_id": 66, "property": "vip", "rank": 20})
+	return srv
+}
+
+func TestClientDocument(t *testing.T) {
+	srv := newTestServer(t)
+	client := srv.Client()
+
+	err := client.Put(testIndex, "4", map[string]interface{}{"name": "new room", "rank": 1})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	doc, err := client.Get(testIndex, "4")
+	if err != nil || !doc.Found {
+		t.Fatalf("Get() = %+v, %v", doc, err)
+	}
+	if doc.Source["name"] != "new room" {
+		t.Errorf("Get() name = %v, want new room", doc.Source["name"])
+	}
+
+	if err = client.Update(testIndex, 4, map[string]interface{}{"rank": 2}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	source, _ := srv.Doc(testIndex, "4")
+	if source["name"] != "new room" || toString(source["rank"]) != "2" {
+		t.Errorf("Update() source = %v", source)
+	}
+
+	if err = client.Update(testIndex, 5, map[string]interface{}{"rank": 2}); err == nil {
+		t.Errorf("Update() missing document should fail")
+	}
+	if err = client.Upsert(testIndex, 5, map[string]interface{}{"rank": 5}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if _, ok := srv.Doc(testIndex, "5"); !ok {
+		t.Errorf("Upsert() should create document")
+	}
+
+	res, err := client.Mget(testIndex, []string{"1", "4", "404"}, []string{"name"})
+	if err != nil {
+		t.Fatalf("Mget() error = %v", err)
+	}
+	if len(res.Docs) != 3 || !res.Docs[0].Found || res.Docs[2].Found {
+		t.Fatalf("Mget() docs = %+v", res.Docs)
+	}
+	if _, ok := res.Docs[0].Source["rank"]; ok {
+		t.Errorf("Mget() should only return name field, got %v", res.Docs[0].Source)
+	}
+
+	if err = client.Delete(testIndex, 4); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok := srv.Doc(testIndex, "4"); ok {
+		t.Errorf("Delete() document still exists")
+	}
+}
+
+func TestClientCondition(t *testing.T) {
+	srv := newTestServer(t)
+	client := srv.Client()
+
+	doc, err := client.Get(testIndex, "1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	cond := doc.Condition()
+	if err = client.Update(testIndex, 1, map[string]interface{}{"rank": 31}, cond); err != nil {
+		t.Fatalf("Update() with fresh condition error = %v", err)
+	}
+	err = client.Update(testIndex, 1, map[string]interface{}{"rank": 32}, cond)
+	if !es.IsVersionConflict(err) {
+		t.Fatalf("Update() with stale condition error = %v, want version conflict", err)
+	}
+	err = client.Put(testIndex, "1", map[string]interface{}{"name": "stale"}, cond)
+	if !es.IsVersionConflict(err) {
+		t.Fatalf("Put() with stale condition error = %v, want version conflict", err)
+	}
+	source, _ := srv.Doc(testIndex, "1")
+	if toString(source["rank"]) != "31" {
+		t.Errorf("stale writes should not be applied, source = %v", source)
+	}
+}
+
+func TestClientSearch(t *testing.T) {
+	srv := newTestServer(t)
+	client := srv.Client()
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want []string
+	}{
+		{
+			name: "term",
+			body: map[string]interface{}{"query": es.SetProperty("vip")},
+			want: []string{"1", "3"},
+		},
+		{
+			name: "terms",
+			body: map[string]interface{}{"query": es.SetAppId([]uint32{66})},
+			want: []string{"3"},
+		},
+		{
+			name: "match",
+			body: map[string]interface{}{"query": es.SetMatchName("HAPPY")},
+			want: []string{"1", "3"},
+		},
+		{
+			name: "match han",
+			body: map[string]interface{}{"query": es.SetMatchName("快乐")},
+			want: []string{"2"},
+		},
+		{
+			name: "range",
+			body: map[string]interface{}{"query": map[string]interface{}{
+				"range": map[string]interface{}{"rank": map[string]interface{}{"gte": 20}},
+			}},
+			want: []string{"1", "3"},
+		},
+		{
+			name: "bool",
+			body: es.BuildQuery([]interface{}{es.SetAppId([]uint32{88}), es.SetProperty("vip")}, 10),
+			want: []string{"1"},
+		},
+		{
+			name: "bool should must_not",
+			body: map[string]interface{}{"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"should":   []interface{}{es.SetProperty("vip"), es.SetProperty("normal")},
+					"must_not": es.SetAppId([]uint32{66}),
+				},
+			}},
+			want: []string{"1", "2"},
+		},
+		{
+			name: "sort size",
+			body: map[string]interface{}{
+				"sort": []interface{}{map[string]interface{}{"rank": map[string]interface{}{"order": "desc"}}},
+				"size": 2,
+			},
+			want: []string{"1", "3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.Search(testIndex, tt.body)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			got := make([]string, 0, len(res.Hits.Hits))
+			for _, hit := range res.Hits.Hits {
+				got = append(got, hit.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := client.Search(testIndex, map[string]interface{}{
+		"query": map[string]interface{}{"fuzzy": map[string]interface{}{"name": "hapy"}},
+	})
+	if err == nil {
+		t.Errorf("Search() unsupported query should fail")
+	}
+}
+
+func TestEsSearch(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Register()
+
+	total, data, err := es.NewEsSearch().QueryWithContent(context.Background(), testIndex, es.BuildQuery([]interface{}{es.SetProperty("vip")}, 1))
+	if err != nil {
+		t.Fatalf("QueryWithContent() error = %v", err)
+	}
+	if total != 2 || len(data) != 1 {
+		t.Errorf("QueryWithContent() = %d, %v", total, data)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	srv := newTestServer(t)
+
+	body := strings.Join([]string{
+		`{"index":{"_index":"room","_id":"10"}}`,
+		`{"name":"bulk room"}`,
+		`{"create":{"_index":"room","_id":"1"}}`,
+		`{"name":"duplicated"}`,
+		`{"update":{"_id":"2"}}`,
+		`{"doc":{"rank":11}}`,
+		`{"delete":{"_id":"3"}}`,
+	}, "\n") + "\n"
+	resp, err := http.Post(srv.URL+"/room/_bulk", "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("bulk error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if _, ok := srv.Doc(testIndex, "10"); !ok {
+		t.Errorf("bulk index should create document")
+	}
+	if source, _ := srv.Doc(testIndex, "1"); source["name"] != "Happy Room" {
+		t.Errorf("bulk create should not overwrite, source = %v", source)
+	}
+	if source, _ := srv.Doc(testIndex, "2"); toString(source["rank"]) != "11" {
+		t.Errorf("bulk update source = %v", source)
+	}
+	if _, ok := srv.Doc(testIndex, "3"); ok {
+		t.Errorf("bulk delete document still exists")
+	}
+}
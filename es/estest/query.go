@@ -0,0 +1,432 @@
+package estest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// matchQuery 判断文档是否满足查询条件
+// 支持 match_all/term/terms/match/range/exists/bool，不计算相关性得分
+func matchQuery(query interface{}, source map[string]interface{}) (bool, error) {
+	if query == nil {
+		return true, nil
+	}
+	clause, ok := query.(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("query malformed, expected object but found [%T]", query)
+	}
+	for typ, body := range clause {
+		var (
+			ok  bool
+			err error
+		)
+		switch typ {
+		case "match_all":
+			ok = true
+		case "term":
+			ok, err = matchTerm(body, source)
+		case "terms":
+			ok, err = matchTerms(body, source)
+		case "match":
+			ok, err = matchText(body, source)
+		case "range":
+			ok, err = matchRange(body, source)
+		case "exists":
+			ok, err = matchExists(body, source)
+		case "bool":
+			ok, err = matchBool(body, source)
+		default:
+			return false, fmt.Errorf("query [%s] is not supported by estest", typ)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// fieldClause 解析 {"field": value} 结构的查询
+func fieldClause(typ string, body interface{}) (string, interface{}, error) {
+	m, ok := body.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", nil, fmt.Errorf("[%s] query malformed, expected exactly one field", typ)
+	}
+	for field, value := range m {
+		return field, value, nil
+	}
+	return "", nil, nil
+}
+
+func matchTerm(body interface{}, source map[string]interface{}) (bool, error) {
+	field, value, err := fieldClause("term", body)
+	if err != nil {
+		return false, err
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		value = m["value"]
+	}
+	for _, v := range lookup(source, field) {
+		if equal(v, value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchTerms(body interface{}, source map[string]interface{}) (bool, error) {
+	field, value, err := fieldClause("terms", body)
+	if err != nil {
+		return false, err
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("[terms] query malformed, expected array for field [%s]", field)
+	}
+	for _, v := range lookup(source, field) {
+		for _, want := range values {
+			if equal(v, want) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchText 简单模拟 standard 分词器：按非字母数字切分，汉字单字成词，忽略大小写
+func matchText(body interface{}, source map[string]interface{}) (bool, error) {
+	field, value, err := fieldClause("match", body)
+	if err != nil {
+		return false, err
+	}
+	operator := "or"
+	if m, ok := value.(map[string]interface{}); ok {
+		value = m["query"]
+		if op, ok := m["operator"].(string); ok {
+			operator = strings.ToLower(op)
+		}
+	}
+	want := analyze(toString(value))
+	if len(want) == 0 {
+		return false, nil
+	}
+	got := make(map[string]bool)
+	for _, v := range lookup(source, field) {
+		for _, token := range analyze(toString(v)) {
+			got[token] = true
+		}
+	}
+	matched := 0
+	for _, token := range want {
+		if got[token] {
+			matched++
+		}
+	}
+	if operator == "and" {
+		return matched == len(want), nil
+	}
+	return matched > 0, nil
+}
+
+func matchRange(body interface{}, source map[string]interface{}) (bool, error) {
+	field, value, err := fieldClause("range", body)
+	if err != nil {
+		return false, err
+	}
+	bounds, ok := value.(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("[range] query malformed for field [%s]", field)
+	}
+	for _, v := range lookup(source, field) {
+		ok := true
+		for op, bound := range bounds {
+			c := compare(v, bound)
+			switch op {
+			case "gt":
+				ok = ok && c > 0
+			case "gte":
+				ok = ok && c >= 0
+			case "lt":
+				ok = ok && c < 0
+			case "lte":
+				ok = ok && c <= 0
+			}
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchExists(body interface{}, source map[string]interface{}) (bool, error) {
+	m, ok := body.(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("[exists] query malformed")
+	}
+	field := toString(m["field"])
+	for _, v := range lookup(source, field) {
+		if v != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchBool must/filter 全部满足，must_not 全部不满足
+// should 在没有 must/filter 时至少满足一个，或者满足 minimum_should_match 个
+func matchBool(body interface{}, source map[string]interface{}) (bool, error) {
+	m, ok := body.(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("[bool] query malformed")
+	}
+	for _, key := range []string{"must", "filter"} {
+		for _, clause := range clauses(m[key]) {
+			ok, err := matchQuery(clause, source)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	for _, clause := range clauses(m["must_not"]) {
+		ok, err := matchQuery(clause, source)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return false, nil
+		}
+	}
+	should := clauses(m["should"])
+	if len(should) == 0 {
+		return true, nil
+	}
+	minimum := 0
+	if _, ok := m["must"]; !ok {
+		if _, ok := m["filter"]; !ok {
+			minimum = 1
+		}
+	}
+	if v, ok := m["minimum_should_match"]; ok {
+		n, err := strconv.Atoi(toString(v))
+		if err != nil {
+			return false, fmt.Errorf("[bool] only integer minimum_should_match is supported by estest")
+		}
+		minimum = n
+	}
+	matched := 0
+	for _, clause := range should {
+		ok, err := matchQuery(clause, source)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+	return matched >= minimum, nil
+}
+
+// clauses bool子句可以是单个对象，也可以是数组
+func clauses(v interface{}) []interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return val
+	default:
+		return []interface{}{val}
+	}
+}
+
+// lookup 按 a.b.c 路径取字段值，数组展开
+func lookup(source map[string]interface{}, field string) []interface{} {
+	if v, ok := source[field]; ok {
+		return flatten(v)
+	}
+	parts := strings.SplitN(field, ".", 2)
+	if len(parts) < 2 {
+		return nil
+	}
+	res := make([]interface{}, 0)
+	for _, v := range flatten(source[parts[0]]) {
+		if m, ok := v.(map[string]interface{}); ok {
+			res = append(res, lookup(m, parts[1])...)
+		}
+	}
+	return res
+}
+
+func flatten(v interface{}) []interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		res := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			res = append(res, flatten(item)...)
+		}
+		return res
+	default:
+		return []interface{}{val}
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// equal 数字按数值比较，其他按字符串比较，和ES keyword/数字字段的term查询一致
+func equal(a, b interface{}) bool {
+	x, okA := toFloat(a)
+	y, okB := toFloat(b)
+	if okA && okB {
+		return x == y
+	}
+	return toString(a) == toString(b)
+}
+
+// compare 返回 -1/0/1，数字按数值比较，其他按字符串比较
+func compare(a, b interface{}) int {
+	x, okA := toFloat(a)
+	y, okB := toFloat(b)
+	if okA && okB {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(toString(a), toString(b))
+}
+
+func analyze(text string) []string {
+	tokens := make([]string, 0)
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// sortField 排序字段定义
+type sortField struct {
+	field string
+	desc  bool
+}
+
+// parseSort 支持 "field"、{"field": "desc"}、{"field": {"order": "desc"}} 及其数组
+func parseSort(v interface{}) ([]sortField, error) {
+	fields := make([]sortField, 0)
+	for _, item := range clauses(v) {
+		switch val := item.(type) {
+		case string:
+			fields = append(fields, sortField{field: val, desc: val == "_score"})
+		case map[string]interface{}:
+			for field, order := range val {
+				if m, ok := order.(map[string]interface{}); ok {
+					order = m["order"]
+				}
+				fields = append(fields, sortField{field: field, desc: strings.ToLower(toString(order)) == "desc"})
+			}
+		default:
+			return nil, fmt.Errorf("[sort] malformed, found [%T]", item)
+		}
+	}
+	return fields, nil
+}
+
+// sortValue 多值字段取第一个值，缺失的字段排在最后
+func sortValue(h hit, field string) interface{} {
+	if field == "_id" {
+		return h.id
+	}
+	values := lookup(h.doc.source, field)
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+func sortHits(hits []hit, fields []sortField) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		for _, f := range fields {
+			if f.field == "_score" {
+				continue
+			}
+			a, b := sortValue(hits[i], f.field), sortValue(hits[j], f.field)
+			if a == nil || b == nil {
+				if (a == nil) != (b == nil) {
+					return b == nil
+				}
+				continue
+			}
+			c := compare(a, b)
+			if c == 0 {
+				continue
+			}
+			if f.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// filterSource 按 _source 参数裁剪返回字段，fields 为空时返回全部
+func filterSource(source map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return source
+	}
+	res := make(map[string]interface{})
+	for _, field := range fields {
+		if v, ok := source[field]; ok {
+			res[field] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,543 @@
+// Package estest 提供一个内存版的ES服务，用于单元测试
+//
+// 只实现了 es.Client 用到的接口子集：
+// 文档的 index/get/mget/update/delete，_search(term/terms/match/range/bool, sort/size/from)，
+// _bulk 和 _delete_by_query，不支持脚本和相关性得分
+package estest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/olaola-chat/slp-library/es"
+)
+
+// Server 内存版ES服务
+type Server struct {
+	*httptest.Server
+	store *store
+}
+
+// NewServer 启动一个内存版ES服务，用完需要调用 Close
+func NewServer() *Server {
+	s := &Server{store: newStore()}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config 返回指向当前服务的ES配置
+func (s *Server) Config() *es.Config {
+	u, _ := url.Parse(s.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return &es.Config{
+		Host: u.Hostname(),
+		Port: uint16(port),
+	}
+}
+
+// Client 返回指向当前服务的 es.Client
+func (s *Server) Client() *es.Client {
+	return &es.Client{Config: s.Config()}
+}
+
+// Register 把 es.EsClient(name) 指向当前服务，不传 name 时替换 es.EsVpc
+// es.NewEsSearch 使用的是 es.EsVpc，注册之后业务搜索代码可以直接测试
+func (s *Server) Register(names ...string) {
+	if len(names) == 0 {
+		names = []string{es.EsVpc}
+	}
+	for _, name := range names {
+		es.SetClient(name, s.Client())
+	}
+}
+
+// Seed 直接写入文档，用于准备测试数据
+func (s *Server) Seed(index, id string, source map[string]interface{}) {
+	_, _ = s.store.put(index, id, normalize(source), nil, false)
+}
+
+// Doc 直接读取文档，用于断言写入结果
+func (s *Server) Doc(index, id string) (map[string]interface{}, bool) {
+	doc, ok := s.store.get(index, id)
+	if !ok {
+		return nil, false
+	}
+	return doc.source, true
+}
+
+// Count 索引下的文档数
+func (s *Server) Count(index string) int {
+	return s.store.count(index)
+}
+
+// Reset 清空所有索引
+func (s *Server) Reset() {
+	s.store.reset()
+}
+
+// normalize 通过json转换，保证测试数据和http写入的数据类型一致
+func normalize(source map[string]interface{}) map[string]interface{} {
+	bs, err := json.Marshal(source)
+	if err != nil {
+		return source
+	}
+	res := make(map[string]interface{})
+	if err := decode(bs, &res); err != nil {
+		return source
+	}
+	return res
+}
+
+// decode 数字解析为 json.Number，避免大整数ID丢失精度
+func decode(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, err *esError) {
+	writeJSON(w, err.status, err.body())
+}
+
+// serveHTTP 路由，索引类型(default/_doc)被忽略
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, badRequest("read body failed: %v", err))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	last := parts[len(parts)-1]
+
+	switch {
+	case last == "_bulk":
+		index := ""
+		if len(parts) > 1 {
+			index = parts[0]
+		}
+		s.bulk(w, index, data)
+	case len(parts) == 2 && last == "_search":
+		s.search(w, parts[0], data)
+	case len(parts) == 2 && last == "_delete_by_query":
+		s.deleteByQuery(w, parts[0], data)
+	case len(parts) >= 2 && last == "_mget":
+		s.mget(w, parts[0], query, data)
+	case len(parts) == 4 && last == "_update":
+		s.update(w, parts[0], parts[2], query, data)
+	case len(parts) == 3 && parts[1] == "_update":
+		s.update(w, parts[0], parts[2], query, data)
+	case len(parts) == 3 && parts[1] == "_create":
+		s.put(w, parts[0], parts[2], query, data, true)
+	case len(parts) == 3:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.get(w, parts[0], parts[2], query)
+		case http.MethodPost, http.MethodPut:
+			s.put(w, parts[0], parts[2], query, data, query.Get("op_type") == "create")
+		case http.MethodDelete:
+			s.delete(w, parts[0], parts[2], query)
+		default:
+			writeError(w, badRequest("method [%s] is not supported by estest", r.Method))
+		}
+	default:
+		writeError(w, badRequest("path [%s] is not supported by estest", r.URL.Path))
+	}
+}
+
+// parseCondition 解析 if_seq_no/if_primary_term 参数
+func parseCondition(query url.Values) (*condition, *esError) {
+	seqNo, term := query.Get("if_seq_no"), query.Get("if_primary_term")
+	if seqNo == "" && term == "" {
+		return nil, nil
+	}
+	cond := &condition{}
+	var err1, err2 error
+	cond.seqNo, err1 = strconv.ParseInt(seqNo, 10, 64)
+	cond.primaryTerm, err2 = strconv.ParseInt(term, 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, badRequest("if_seq_no and if_primary_term must be set together")
+	}
+	return cond, nil
+}
+
+// sourceFields 解析 _source/_source_includes 参数
+func sourceFields(query url.Values) []string {
+	value := query.Get("_source")
+	if value == "" {
+		value = query.Get("_source_includes")
+	}
+	if value == "" || value == "true" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func (s *Server) getBody(index, id string, fields []string) (map[string]interface{}, bool) {
+	body := map[string]interface{}{
+		"_index": index,
+		"_type":  "default",
+		"_id":    id,
+		"found":  false,
+	}
+	doc, ok := s.store.get(index, id)
+	if !ok {
+		return body, false
+	}
+	body["found"] = true
+	body["_version"] = doc.version
+	body["_seq_no"] = doc.seqNo
+	body["_primary_term"] = primaryTerm
+	body["_source"] = filterSource(doc.source, fields)
+	return body, true
+}
+
+func (s *Server) get(w http.ResponseWriter, index, id string, query url.Values) {
+	body, ok := s.getBody(index, id, sourceFields(query))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// mget 兼容 es.Client 直接提交ID数组，以及ES标准的 ids/docs 格式
+func (s *Server) mget(w http.ResponseWriter, index string, query url.Values, data []byte) {
+	ids := make([]string, 0)
+	var list []interface{}
+	if err := decode(data, &list); err != nil {
+		req := map[string]interface{}{}
+		if err := decode(data, &req); err != nil {
+			writeError(w, badRequest("mget body malformed: %v", err))
+			return
+		}
+		list = clauses(req["ids"])
+		for _, item := range clauses(req["docs"]) {
+			if m, ok := item.(map[string]interface{}); ok {
+				list = append(list, m["_id"])
+			}
+		}
+	}
+	for _, id := range list {
+		ids = append(ids, toString(id))
+	}
+
+	fields := sourceFields(query)
+	docs := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		body, _ := s.getBody(index, id, fields)
+		docs = append(docs, body)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"docs": docs})
+}
+
+func (s *Server) put(w http.ResponseWriter, index, id string, query url.Values, data []byte, create bool) {
+	cond, esErr := parseCondition(query)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	source := map[string]interface{}{}
+	if err := decode(data, &source); err != nil {
+		writeError(w, badRequest("document malformed: %v", err))
+		return
+	}
+	res, esErr := s.store.put(index, id, source, cond, create)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	writeJSON(w, res.status, res.body())
+}
+
+func (s *Server) update(w http.ResponseWriter, index, id string, query url.Values, data []byte) {
+	cond, esErr := parseCondition(query)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	body := map[string]interface{}{}
+	if err := decode(data, &body); err != nil {
+		writeError(w, badRequest("update body malformed: %v", err))
+		return
+	}
+	res, esErr := s.store.update(index, id, body, cond)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.body())
+}
+
+func (s *Server) delete(w http.ResponseWriter, index, id string, query url.Values) {
+	cond, esErr := parseCondition(query)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	res, esErr := s.store.delete(index, id, cond)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	writeJSON(w, res.status, res.body())
+}
+
+// searchRequest 解析出的检索请求
+type searchRequest struct {
+	query  interface{}
+	sort   []sortField
+	from   int
+	size   int
+	fields []string
+	noSrc  bool
+}
+
+func parseSearch(data []byte) (*searchRequest, *esError) {
+	req := &searchRequest{size: 10}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return req, nil
+	}
+	body := map[string]interface{}{}
+	if err := decode(data, &body); err != nil {
+		return nil, badRequest("search body malformed: %v", err)
+	}
+	req.query = body["query"]
+	var err error
+	if req.sort, err = parseSort(body["sort"]); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if v, ok := body["size"]; ok {
+		if req.size, err = strconv.Atoi(toString(v)); err != nil {
+			return nil, badRequest("[size] must be an integer")
+		}
+	}
+	if v, ok := body["from"]; ok {
+		if req.from, err = strconv.Atoi(toString(v)); err != nil {
+			return nil, badRequest("[from] must be an integer")
+		}
+	}
+	switch src := body["_source"].(type) {
+	case bool:
+		req.noSrc = !src
+	case string:
+		req.fields = []string{src}
+	case []interface{}:
+		for _, f := range src {
+			req.fields = append(req.fields, toString(f))
+		}
+	}
+	return req, nil
+}
+
+func (s *Server) search(w http.ResponseWriter, index string, data []byte) {
+	req, esErr := parseSearch(data)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	hits, err := s.store.scan(index, func(source map[string]interface{}) (bool, error) {
+		return matchQuery(req.query, source)
+	})
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+	sortHits(hits, req.sort)
+
+	total := len(hits)
+	if req.from >= len(hits) {
+		hits = nil
+	} else {
+		hits = hits[req.from:]
+	}
+	if req.size < len(hits) {
+		hits = hits[:req.size]
+	}
+
+	items := make([]interface{}, 0, len(hits))
+	for _, h := range hits {
+		item := map[string]interface{}{
+			"_index": index,
+			"_type":  "default",
+			"_id":    h.id,
+			"_score": 1.0,
+		}
+		if !req.noSrc {
+			item["_source"] = filterSource(h.doc.source, req.fields)
+		}
+		if values, ok := numericSortValues(h, req.sort); ok {
+			item["sort"] = values
+		}
+		items = append(items, item)
+	}
+	maxScore := 0.0
+	if total > 0 {
+		maxScore = 1.0
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"took":      0,
+		"timed_out": false,
+		"_shards": map[string]interface{}{
+			"total":      1,
+			"successful": 1,
+			"skipped":    0,
+			"failed":     0,
+		},
+		"hits": map[string]interface{}{
+			"total":     total,
+			"max_score": maxScore,
+			"hits":      items,
+		},
+	})
+}
+
+// numericSortValues es.Client 的 sort 字段定义为 []float64，只有全部是数字时才返回
+func numericSortValues(h hit, fields []sortField) ([]float64, bool) {
+	if len(fields) == 0 {
+		return nil, false
+	}
+	values := make([]float64, 0, len(fields))
+	for _, f := range fields {
+		if f.field == "_score" {
+			values = append(values, 1.0)
+			continue
+		}
+		v, ok := toFloat(sortValue(h, f.field))
+		if !ok {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return values, true
+}
+
+func (s *Server) deleteByQuery(w http.ResponseWriter, index string, data []byte) {
+	req, esErr := parseSearch(data)
+	if esErr != nil {
+		writeError(w, esErr)
+		return
+	}
+	hits, err := s.store.scan(index, func(source map[string]interface{}) (bool, error) {
+		return matchQuery(req.query, source)
+	})
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+	deleted := 0
+	for _, h := range hits {
+		if res, esErr := s.store.delete(index, h.id, nil); esErr == nil && res.result == "deleted" {
+			deleted++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"took":              0,
+		"timed_out":         false,
+		"total":             len(hits),
+		"deleted":           deleted,
+		"batches":           1,
+		"version_conflicts": 0,
+		"noops":             0,
+		"failures":          []interface{}{},
+	})
+}
+
+// bulk 支持 index/create/update/delete，每个操作独立成功或失败
+func (s *Server) bulk(w http.ResponseWriter, defaultIndex string, data []byte) {
+	items := make([]interface{}, 0)
+	hasError := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		action := map[string]map[string]interface{}{}
+		if err := decode(line, &action); err != nil || len(action) != 1 {
+			writeError(w, badRequest("bulk action malformed: %s", line))
+			return
+		}
+		for op, meta := range action {
+			index := toString(meta["_index"])
+			if index == "" {
+				index = defaultIndex
+			}
+			id := toString(meta["_id"])
+
+			var source map[string]interface{}
+			if op != "delete" {
+				if !scanner.Scan() {
+					writeError(w, badRequest("bulk action [%s] requires a source line", op))
+					return
+				}
+				source = map[string]interface{}{}
+				if err := decode(scanner.Bytes(), &source); err != nil {
+					writeError(w, badRequest("bulk source malformed: %v", err))
+					return
+				}
+			}
+
+			var cond *condition
+			if seqNo, ok := meta["if_seq_no"]; ok {
+				cond = &condition{primaryTerm: primaryTerm}
+				cond.seqNo, _ = strconv.ParseInt(toString(seqNo), 10, 64)
+				if term, ok := meta["if_primary_term"]; ok {
+					cond.primaryTerm, _ = strconv.ParseInt(toString(term), 10, 64)
+				}
+			}
+
+			var (
+				res   *writeResult
+				esErr *esError
+			)
+			switch op {
+			case "index":
+				res, esErr = s.store.put(index, id, source, cond, false)
+			case "create":
+				res, esErr = s.store.put(index, id, source, cond, true)
+			case "update":
+				res, esErr = s.store.update(index, id, source, cond)
+			case "delete":
+				res, esErr = s.store.delete(index, id, cond)
+			default:
+				esErr = badRequest("bulk action [%s] is not supported by estest", op)
+			}
+
+			var item map[string]interface{}
+			if esErr != nil {
+				hasError = true
+				item = map[string]interface{}{
+					"_index": index,
+					"_type":  "default",
+					"_id":    id,
+					"status": esErr.status,
+					"error":  esErr.body()["error"],
+				}
+			} else {
+				item = res.body()
+				item["status"] = res.status
+			}
+			items = append(items, map[string]interface{}{op: item})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"took":   0,
+		"errors": hasError,
+		"items":  items,
+	})
+}
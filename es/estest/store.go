@@ -0,0 +1,355 @@
+package estest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// primaryTerm 内存服务只有一个主分片，primary term 固定为1
+const primaryTerm int64 = 1
+
+// esError 对应ES返回的错误，status 为http状态码
+type esError struct {
+	status int
+	typ    string
+	reason string
+}
+
+func (e *esError) body() map[string]interface{} {
+	cause := map[string]interface{}{
+		"type":   e.typ,
+		"reason": e.reason,
+	}
+	return map[string]interface{}{
+		"error": map[string]interface{}{
+			"root_cause": []interface{}{cause},
+			"type":       e.typ,
+			"reason":     e.reason,
+		},
+		"status": e.status,
+	}
+}
+
+func badRequest(format string, args ...interface{}) *esError {
+	return &esError{
+		status: http.StatusBadRequest,
+		typ:    "illegal_argument_exception",
+		reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// condition 乐观锁条件，对应 if_seq_no/if_primary_term
+type condition struct {
+	seqNo       int64
+	primaryTerm int64
+}
+
+type document struct {
+	source  map[string]interface{}
+	version int64
+	seqNo   int64
+}
+
+type index struct {
+	docs  map[string]*document
+	seqNo int64
+}
+
+// writeResult 写入操作的返回结果
+type writeResult struct {
+	index   string
+	id      string
+	result  string
+	version int64
+	seqNo   int64
+	status  int
+}
+
+func (r *writeResult) body() map[string]interface{} {
+	return map[string]interface{}{
+		"_index":        r.index,
+		"_type":         "default",
+		"_id":           r.id,
+		"_version":      r.version,
+		"result":        r.result,
+		"_seq_no":       r.seqNo,
+		"_primary_term": primaryTerm,
+		"_shards": map[string]interface{}{
+			"total":      1,
+			"successful": 1,
+			"failed":     0,
+		},
+	}
+}
+
+// store 内存文档存储，所有索引共用一把锁
+type store struct {
+	mu      sync.RWMutex
+	indices map[string]*index
+}
+
+func newStore() *store {
+	return &store{indices: make(map[string]*index)}
+}
+
+func (s *store) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.indices = make(map[string]*index)
+}
+
+// getIndex 调用方需要持有锁
+func (s *store) getIndex(name string, create bool) *index {
+	idx, ok := s.indices[name]
+	if !ok && create {
+		idx = &index{docs: make(map[string]*document)}
+		s.indices[name] = idx
+	}
+	return idx
+}
+
+// checkCondition 校验乐观锁条件，调用方需要持有锁
+func checkCondition(name, id string, doc *document, cond *condition) *esError {
+	if cond == nil {
+		return nil
+	}
+	if doc == nil {
+		return &esError{
+			status: http.StatusConflict,
+			typ:    "version_conflict_engine_exception",
+			reason: fmt.Sprintf("[%s]: version conflict, required seqNo [%d], primary term [%d]. but no document was found", id, cond.seqNo, cond.primaryTerm),
+		}
+	}
+	if doc.seqNo != cond.seqNo || cond.primaryTerm != primaryTerm {
+		return &esError{
+			status: http.StatusConflict,
+			typ:    "version_conflict_engine_exception",
+			reason: fmt.Sprintf("[%s]: version conflict, required seqNo [%d], primary term [%d]. current document has seqNo [%d] and primary term [%d]", id, cond.seqNo, cond.primaryTerm, doc.seqNo, primaryTerm),
+		}
+	}
+	return nil
+}
+
+// save 写入文档，调用方需要持有锁
+func (s *store) save(name, id string, source map[string]interface{}) *writeResult {
+	idx := s.getIndex(name, true)
+	idx.seqNo++
+	res := &writeResult{index: name, id: id, seqNo: idx.seqNo}
+	if doc, ok := idx.docs[id]; ok {
+		doc.source = source
+		doc.version++
+		doc.seqNo = idx.seqNo
+		res.result = "updated"
+		res.version = doc.version
+		res.status = http.StatusOK
+		return res
+	}
+	idx.docs[id] = &document{source: source, version: 1, seqNo: idx.seqNo}
+	res.result = "created"
+	res.version = 1
+	res.status = http.StatusCreated
+	return res
+}
+
+// find 查找文档，调用方需要持有锁
+func (s *store) find(name, id string) *document {
+	idx := s.getIndex(name, false)
+	if idx == nil {
+		return nil
+	}
+	return idx.docs[id]
+}
+
+// put 写入整个文档，create 为true时文档已存在则报错
+func (s *store) put(name, id string, source map[string]interface{}, cond *condition, create bool) (*writeResult, *esError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := s.find(name, id)
+	if err := checkCondition(name, id, doc, cond); err != nil {
+		return nil, err
+	}
+	if create && doc != nil {
+		return nil, &esError{
+			status: http.StatusConflict,
+			typ:    "version_conflict_engine_exception",
+			reason: fmt.Sprintf("[%s]: version conflict, document already exists (current version [%d])", id, doc.version),
+		}
+	}
+	return s.save(name, id, copyMap(source)), nil
+}
+
+// update 局部更新文档，支持 doc/doc_as_upsert/upsert，不支持 script
+func (s *store) update(name, id string, body map[string]interface{}, cond *condition) (*writeResult, *esError) {
+	if _, ok := body["script"]; ok {
+		return nil, badRequest("script is not supported by estest")
+	}
+	partial, _ := body["doc"].(map[string]interface{})
+	upsert, _ := body["upsert"].(map[string]interface{})
+	docAsUpsert, _ := body["doc_as_upsert"].(bool)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := s.find(name, id)
+	if err := checkCondition(name, id, doc, cond); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		switch {
+		case upsert != nil:
+			return s.save(name, id, copyMap(upsert)), nil
+		case docAsUpsert && partial != nil:
+			return s.save(name, id, copyMap(partial)), nil
+		}
+		return nil, &esError{
+			status: http.StatusNotFound,
+			typ:    "document_missing_exception",
+			reason: fmt.Sprintf("[default][%s]: document missing", id),
+		}
+	}
+	merged := copyMap(doc.source)
+	mergeMap(merged, partial)
+	if reflect.DeepEqual(merged, doc.source) {
+		return &writeResult{
+			index:   name,
+			id:      id,
+			result:  "noop",
+			version: doc.version,
+			seqNo:   doc.seqNo,
+			status:  http.StatusOK,
+		}, nil
+	}
+	return s.save(name, id, merged), nil
+}
+
+// delete 删除文档，文档不存在时返回 not_found，不是错误
+func (s *store) delete(name, id string, cond *condition) (*writeResult, *esError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := s.find(name, id)
+	if err := checkCondition(name, id, doc, cond); err != nil {
+		return nil, err
+	}
+	idx := s.getIndex(name, true)
+	idx.seqNo++
+	res := &writeResult{index: name, id: id, seqNo: idx.seqNo}
+	if doc == nil {
+		res.result = "not_found"
+		res.version = 1
+		res.status = http.StatusNotFound
+		return res, nil
+	}
+	delete(idx.docs, id)
+	res.result = "deleted"
+	res.version = doc.version + 1
+	res.status = http.StatusOK
+	return res, nil
+}
+
+// get 获取文档，返回的是拷贝
+func (s *store) get(name, id string) (*document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc := s.find(name, id)
+	if doc == nil {
+		return nil, false
+	}
+	return &document{source: copyMap(doc.source), version: doc.version, seqNo: doc.seqNo}, true
+}
+
+// hit 检索命中的文档
+type hit struct {
+	id  string
+	doc *document
+}
+
+// scan 按 filter 过滤索引下所有文档，结果按文档ID排序，保证顺序稳定
+func (s *store) scan(name string, filter func(source map[string]interface{}) (bool, error)) ([]hit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := s.getIndex(name, false)
+	if idx == nil {
+		return nil, nil
+	}
+	hits := make([]hit, 0)
+	for id, doc := range idx.docs {
+		ok, err := filter(doc.source)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			hits = append(hits, hit{
+				id:  id,
+				doc: &document{source: copyMap(doc.source), version: doc.version, seqNo: doc.seqNo},
+			})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return lessID(hits[i].id, hits[j].id)
+	})
+	return hits, nil
+}
+
+// count 索引下的文档数
+func (s *store) count(name string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := s.getIndex(name, false)
+	if idx == nil {
+		return 0
+	}
+	return len(idx.docs)
+}
+
+// lessID 数字ID按数值排序，其他按字符串排序
+func lessID(a, b string) bool {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// copyMap 深拷贝文档，避免调用方修改内存中的数据
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = copyValue(v)
+	}
+	return res
+}
+
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return copyMap(val)
+	case []interface{}:
+		res := make([]interface{}, len(val))
+		for i, item := range val {
+			res[i] = copyValue(item)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// mergeMap 和ES一样，对象字段递归合并，其他字段直接覆盖
+func mergeMap(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				mergeMap(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = copyValue(v)
+	}
+}
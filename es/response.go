@@ -62,3 +62,66 @@ type GetResponse struct {
 type MResponse struct {
 	Docs []GetResponse `json:"docs"`
 }
+
+// Condition 根据检索到的文档版本生成乐观锁写入条件
+func (r *GetResponse) Condition() *Condition {
+	return &Condition{
+		SeqNo:       r.SeqNo,
+		PrimaryTerm: r.PrimaryTerm,
+	}
+}
+
+// ByQueryResponse _update_by_query/_delete_by_query 返回数据结构定义
+// 异步执行时只有 Task 有值
+type ByQueryResponse struct {
+	Took             int64                    `json:"took"`
+	TimedOut         bool                     `json:"timed_out"`
+	Total            int64                    `json:"total"`
+	Updated          int64                    `json:"updated"`
+	Deleted          int64                    `json:"deleted"`
+	Batches          int64                    `json:"batches"`
+	VersionConflicts int64                    `json:"version_conflicts"`
+	Noops            int64                    `json:"noops"`
+	Failures         []map[string]interface{} `json:"failures"`
+	Task             string                   `json:"task"`
+}
+
+// TaskStatus by query任务执行进度
+type TaskStatus struct {
+	Total            int64 `json:"total"`
+	Updated          int64 `json:"updated"`
+	Created          int64 `json:"created"`
+	Deleted          int64 `json:"deleted"`
+	Batches          int64 `json:"batches"`
+	VersionConflicts int64 `json:"version_conflicts"`
+	Noops            int64 `json:"noops"`
+}
+
+// Processed 已处理的文档数
+func (s TaskStatus) Processed() int64 {
+	return s.Updated + s.Created + s.Deleted + s.VersionConflicts + s.Noops
+}
+
+// Progress 任务进度 0~1，ES还没统计出总数时返回0
+func (s TaskStatus) Progress() float64 {
+	if s.Total <= 0 {
+		return 0
+	}
+	return float64(s.Processed()) / float64(s.Total)
+}
+
+type taskInfo struct {
+	Node               string     `json:"node"`
+	ID                 int64      `json:"id"`
+	Action             string     `json:"action"`
+	Description        string     `json:"description"`
+	Status             TaskStatus `json:"status"`
+	RunningTimeInNanos int64      `json:"running_time_in_nanos"`
+}
+
+// TaskResponse 查询任务返回数据结构定义，Completed 之后 Response 才有值
+type TaskResponse struct {
+	Completed bool             `json:"completed"`
+	Task      taskInfo         `json:"task"`
+	Response  *ByQueryResponse `json:"response"`
+}
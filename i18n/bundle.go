@@ -0,0 +1,164 @@
+package i18n
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/encoding/gjson"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/util/gconv"
+)
+
+// bundles 语言 => key => 翻译，来自ACM等动态配置，优先级高于i18n资源文件
+// 整体替换，读取时不加锁
+var bundles atomic.Value
+
+func init() {
+	bundles.Store(map[string]map[string]string{})
+}
+
+func getBundles() map[string]map[string]string {
+	return bundles.Load().(map[string]map[string]string)
+}
+
+// bundleContent 从动态翻译中查找，不存在返回空字符串
+func bundleContent(key, language string) string {
+	if m, ok := getBundles()[normalizeLanguage(language)]; ok {
+		return m[key]
+	}
+	return ""
+}
+
+// SetBundles 整体替换动态翻译，参数和 acm.DirCallback 一致，可以直接用于监听ACM目录：
+//
+//	acm.GetAcm().ListenDir("i18n", i18n.SetBundles)
+//
+// key 的最后一段(去掉扩展名)是语言名，如 Acm/i18n/zh-cn.toml，value 是toml/json/yaml格式的翻译文件
+// 任何一个文件解析失败都不会替换，保留之前的翻译
+func SetBundles(kvs map[string]string) error {
+	data := make(map[string]map[string]string, len(kvs))
+	for key, content := range kvs {
+		name := path.Base(key)
+		name = strings.TrimSuffix(name, path.Ext(name))
+		if name == "" || strings.TrimSpace(content) == "" {
+			continue
+		}
+		kv, err := ParseBundle(content)
+		if err != nil {
+			return gerror.Wrapf(err, "i18n bundle %s parse error", key)
+		}
+		language := normalizeLanguage(name)
+		m, ok := data[language]
+		if !ok {
+			m = make(map[string]string, len(kv))
+			data[language] = m
+		}
+		for k, v := range kv {
+			m[k] = v
+		}
+	}
+	bundles.Store(data)
+	resetMessageCache()
+
+	//动态翻译中的语言也作为支持的语言参与协商，删除的语言不再参与
+	loadLanguages()
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	rebuildLanguages()
+	return nil
+}
+
+// ParseBundle 解析toml/json/yaml格式的翻译文件，嵌套的配置展开成 a.b.c 形式的key
+func ParseBundle(content string) (map[string]string, error) {
+	j, err := gjson.LoadContent(content)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	flattenBundle(m, "", j.Map())
+	return m, nil
+}
+
+// flattenBundle 嵌套的配置展开成 a.b.c 形式的key
+func flattenBundle(dst map[string]string, prefix string, src map[string]interface{}) {
+	for k, v := range src {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			flattenBundle(dst, k, sub)
+			continue
+		}
+		dst[k] = gconv.String(v)
+	}
+}
+
+// maxMissingKeys 最多记录的缺失key数量，避免把非key的文本传给T时无限增长
+const maxMissingKeys = 10000
+
+// MissingKey 缺失翻译的统计
+type MissingKey struct {
+	Language string `json:"language"`
+	Key      string `json:"key"`
+	Count    int64  `json:"count"`
+	LastSeen int64  `json:"last_seen"` //unix时间戳
+}
+
+type missingCounter struct {
+	count    int64
+	lastSeen int64
+}
+
+var (
+	missingMu   sync.Mutex
+	missingKeys = make(map[[2]string]*missingCounter)
+)
+
+// recordMissing 记录当前语言缺失的key，包括回退到其他语言才找到的
+func recordMissing(language, key string) {
+	missingMu.Lock()
+	defer missingMu.Unlock()
+	id := [2]string{language, key}
+	c, ok := missingKeys[id]
+	if !ok {
+		if len(missingKeys) >= maxMissingKeys {
+			return
+		}
+		c = &missingCounter{}
+		missingKeys[id] = c
+	}
+	c.count++
+	c.lastSeen = time.Now().Unix()
+}
+
+// MissingKeys 返回缺失翻译的统计，按次数从多到少排列，language 为空返回所有语言
+func MissingKeys(language string) []MissingKey {
+	language = normalizeLanguage(language)
+	missingMu.Lock()
+	res := make([]MissingKey, 0, len(missingKeys))
+	for id, c := range missingKeys {
+		if language != "" && normalizeLanguage(id[0]) != language {
+			continue
+		}
+		res = append(res, MissingKey{Language: id[0], Key: id[1], Count: c.count, LastSeen: c.lastSeen})
+	}
+	missingMu.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Language+res[i].Key < res[j].Language+res[j].Key
+	})
+	return res
+}
+
+// ResetMissingKeys 清空缺失翻译的统计，一般在翻译更新之后调用
+func ResetMissingKeys() {
+	missingMu.Lock()
+	defer missingMu.Unlock()
+	missingKeys = make(map[[2]string]*missingCounter)
+}
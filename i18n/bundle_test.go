@@ -0,0 +1,76 @@
+package i18n
+
+import (
+	"testing"
+)
+
+func TestSetBundles(t *testing.T) {
+	if _, err := compileMessage("{count, plural, other {# gifts}}"); err != nil {
+		t.Fatal(err)
+	}
+	SetSupportedLanguages("en", "zh-CN")
+	defer SetSupportedLanguages()
+	defer func() { _ = SetBundles(nil) }()
+	ResetMissingKeys()
+	defer ResetMissingKeys()
+
+	err := SetBundles(map[string]string{
+		"Acm/i18n/en.toml":    "[gift]\nsent = \"Gift sent\"\nhello = \"Hello\"",
+		"Acm/i18n/zh-CN.json": `{"gift": {"sent": "礼物已送出"}}`,
+	})
+	if err != nil {
+		t.Fatalf("SetBundles() error = %v", err)
+	}
+	if len(messageCache) != 0 {
+		t.Errorf("message cache = %d after SetBundles", len(messageCache))
+	}
+
+	n := NewI18n()
+	n.SetLanguages([]string{"zh-CN", "en"})
+	if got := n.T("gift.sent"); got != "礼物已送出" {
+		t.Errorf("T(gift.sent) = %q", got)
+	}
+	if got := n.T("gift.hello"); got != "Hello" {
+		t.Errorf("T(gift.hello) = %q, want fallback", got)
+	}
+	n.T("gift.hello")
+	n.T("gift.none")
+
+	keys := MissingKeys("zh-cn")
+	if len(keys) != 2 || keys[0].Key != "gift.hello" || keys[0].Count != 2 || keys[1].Key != "gift.none" {
+		t.Errorf("MissingKeys() = %+v", keys)
+	}
+	if keys := MissingKeys("en"); len(keys) != 0 {
+		t.Errorf("MissingKeys(en) = %+v", keys)
+	}
+
+	//解析失败保留之前的翻译
+	if err := SetBundles(map[string]string{"Acm/i18n/en.json": "{bad"}); err == nil {
+		t.Errorf("SetBundles() should fail")
+	}
+	if got := n.T("gift.sent"); got != "礼物已送出" {
+		t.Errorf("T(gift.sent) after bad bundle = %q", got)
+	}
+
+	//动态翻译中的语言参与协商，删除后不再参与
+	if err := SetBundles(map[string]string{"Acm/i18n/ja.json": `{"gift": {"sent": "ok"}}`}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookupLanguage("ja"); !ok {
+		t.Errorf("lookupLanguage(ja) after SetBundles = false")
+	}
+	if err := SetBundles(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookupLanguage("ja"); ok {
+		t.Errorf("lookupLanguage(ja) after removed = true")
+	}
+	//资源文件中没有语言时不做过滤
+	SetSupportedLanguages()
+	if err := SetBundles(map[string]string{"Acm/i18n/ja.json": `{"gift": {"sent": "ok"}}`}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookupLanguage("ko"); !ok {
+		t.Errorf("lookupLanguage(ko) without resource languages = false")
+	}
+}
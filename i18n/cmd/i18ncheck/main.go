@@ -0,0 +1,84 @@
+// i18ncheck 检查代码中使用的翻译key和i18n资源文件是否一致，有问题时退出码为1，可用于发布前检查
+//
+//	go run github.com/olaola-chat/slp-library/i18n/cmd/i18ncheck --src ./app --i18n ./i18n
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/olaola-chat/slp-library/i18n/i18ncheck"
+)
+
+func main() {
+	var (
+		i18nDir  string
+		noUnused bool
+	)
+	src := cli.StringSlice{}
+	ignore := cli.StringSlice{}
+
+	ca := cli.NewApp()
+	ca.Name = "i18ncheck"
+	ca.Usage = "report missing, unused and format mismatched translation keys"
+	ca.Version = "0.0.1"
+	ca.Flags = []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "src",
+			Usage: "go source dirs, default .",
+			Value: &src,
+		},
+		cli.StringFlag{
+			Name:        "i18n",
+			Usage:       "i18n resource dir",
+			Value:       "i18n",
+			Destination: &i18nDir,
+		},
+		cli.StringSliceFlag{
+			Name:  "ignore-unused",
+			Usage: "key prefixes not reported as unused",
+			Value: &ignore,
+		},
+		cli.BoolFlag{
+			Name:        "no-unused",
+			Usage:       "do not report unused keys",
+			Destination: &noUnused,
+		},
+	}
+	ca.Action = func(c *cli.Context) error {
+		dirs := []string(src)
+		if len(dirs) == 0 {
+			dirs = []string{"."}
+		}
+		usages, err := i18ncheck.Extract(dirs...)
+		if err != nil {
+			return err
+		}
+		locales, err := i18ncheck.LoadLocales(i18nDir)
+		if err != nil {
+			return err
+		}
+		problems := i18ncheck.Check(usages, locales, i18ncheck.Options{IgnoreUnused: ignore})
+		count := 0
+		for _, p := range problems {
+			if noUnused && p.Kind == i18ncheck.ProblemUnused {
+				continue
+			}
+			fmt.Println(p.String())
+			count++
+		}
+		fmt.Fprintf(os.Stderr, "%d keys used, %d languages, %d problems\n", len(usages), len(locales), count)
+		if count > 0 {
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	}
+	if err := ca.Run(os.Args); err != nil {
+		if _, ok := err.(cli.ExitCoder); !ok {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
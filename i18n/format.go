@@ -0,0 +1,321 @@
+package i18n
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/util/gconv"
+)
+
+// decimal 十进制表示的数字，避免float运算带来的误差
+// intPart 没有前导0(0本身除外)，fracPart 是小数部分的数字
+type decimal struct {
+	negative bool
+	intPart  string
+	fracPart string
+}
+
+// toDecimal 整数精确转换，float 使用能还原该值的最短表示，如 float32(0.1) => 0.1
+// 字符串必须是合法的十进制数字，如金额 "1234.005"
+func toDecimal(value interface{}) (decimal, bool) {
+	var s string
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64:
+		s = strconv.FormatInt(gconv.Int64(v), 10)
+	case uint, uint8, uint16, uint32, uint64:
+		s = strconv.FormatUint(gconv.Uint64(v), 10)
+	case float32:
+		s = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		s = v.String()
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		return decimal{}, false
+	}
+	return parseDecimal(s)
+}
+
+func parseDecimal(s string) (decimal, bool) {
+	var d decimal
+	if strings.HasPrefix(s, "-") {
+		d.negative = true
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	d.intPart, d.fracPart = s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		d.intPart, d.fracPart = s[:i], s[i+1:]
+	}
+	if d.intPart == "" && d.fracPart == "" {
+		return decimal{}, false
+	}
+	for _, part := range []string{d.intPart, d.fracPart} {
+		for i := 0; i < len(part); i++ {
+			if part[i] < '0' || part[i] > '9' {
+				return decimal{}, false
+			}
+		}
+	}
+	d.intPart = strings.TrimLeft(d.intPart, "0")
+	if d.intPart == "" {
+		d.intPart = "0"
+	}
+	return d, true
+}
+
+// isZero 所有数字都是0
+func (d decimal) isZero() bool {
+	return strings.Trim(d.intPart+d.fracPart, "0") == ""
+}
+
+// round 四舍五入到 frac 位小数(0.5远离0)，不补0
+func (d decimal) round(frac int) decimal {
+	if frac < 0 {
+		frac = 0
+	}
+	if len(d.fracPart) <= frac {
+		return d
+	}
+	up := d.fracPart[frac] >= '5'
+	digits := []byte(d.intPart + d.fracPart[:frac])
+	if up {
+		i := len(digits) - 1
+		for ; i >= 0; i-- {
+			if digits[i] == '9' {
+				digits[i] = '0'
+				continue
+			}
+			digits[i]++
+			break
+		}
+		if i < 0 {
+			digits = append([]byte{'1'}, digits...)
+		}
+	}
+	n := len(digits) - frac
+	res := decimal{negative: d.negative, intPart: string(digits[:n]), fracPart: string(digits[n:])}
+	res.intPart = strings.TrimLeft(res.intPart, "0")
+	if res.intPart == "" {
+		res.intPart = "0"
+	}
+	return res
+}
+
+// shift 小数点左移 n 位，即除以10的n次方
+func (d decimal) shift(n int) decimal {
+	intPart := d.intPart
+	if len(intPart) <= n {
+		intPart = strings.Repeat("0", n-len(intPart)+1) + intPart
+	}
+	res := decimal{
+		negative: d.negative,
+		intPart:  strings.TrimLeft(intPart[:len(intPart)-n], "0"),
+		fracPart: intPart[len(intPart)-n:] + d.fracPart,
+	}
+	if res.intPart == "" {
+		res.intPart = "0"
+	}
+	return res
+}
+
+// String 小数部分补齐到 minFrac 位，去掉多余的0，负零输出为0
+func (d decimal) String(minFrac int) string {
+	frac := strings.TrimRight(d.fracPart, "0")
+	if len(frac) < minFrac {
+		frac += strings.Repeat("0", minFrac-len(frac))
+	}
+	var b strings.Builder
+	if d.negative && !(decimal{intPart: d.intPart, fracPart: frac}).isZero() {
+		b.WriteByte('-')
+	}
+	b.WriteString(d.intPart)
+	if frac != "" {
+		b.WriteByte('.')
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// RoundDecimal 按十进制精确四舍五入，固定 frac 位小数，不做本地化，用于金币钻石等金额的展示和计算
+// 如 RoundDecimal(1.005, 2) => "1.01"，无法解析的值返回空字符串
+func RoundDecimal(value interface{}, frac int) string {
+	d, ok := toDecimal(value)
+	if !ok {
+		return ""
+	}
+	return d.round(frac).String(frac)
+}
+
+// FormatNumber 按语言格式化数字，有分组符号，最多保留 maxFrac 位小数，去掉末尾的0
+// FormatNumber("de", 1234.5, 2) => "1.234,5"
+func FormatNumber(language string, value interface{}, maxFrac int) string {
+	d, ok := toDecimal(value)
+	if !ok {
+		return gconv.String(value)
+	}
+	return symbolsOf(language).localize(d.round(maxFrac).String(0), true)
+}
+
+// FormatDecimal 按语言格式化数字，固定 frac 位小数，用于金币钻石等金额
+// FormatDecimal("en", 1234.005, 2) => "1,234.01"
+func FormatDecimal(language string, value interface{}, frac int) string {
+	d, ok := toDecimal(value)
+	if !ok {
+		return gconv.String(value)
+	}
+	return symbolsOf(language).localize(d.round(frac).String(frac), true)
+}
+
+// compactUnit 缩写单位，exp 为10的指数
+type compactUnit struct {
+	exp    int
+	suffix string
+}
+
+// compactTable 语言 => 缩写单位，从小到大，先找完整语言，再找基础语言，默认使用英文
+var (
+	compactEnglish = []compactUnit{{3, "K"}, {6, "M"}, {9, "B"}, {12, "T"}}
+	compactTable   = map[string][]compactUnit{
+		"en":    compactEnglish,
+		"zh":    {{4, "万"}, {8, "亿"}, {12, "万亿"}},
+		"zh-tw": {{4, "萬"}, {8, "億"}, {12, "兆"}},
+		"zh-hk": {{4, "萬"}, {8, "億"}, {12, "兆"}},
+		"ja":    {{4, "万"}, {8, "億"}, {12, "兆"}},
+		"ko":    {{4, "만"}, {8, "억"}, {12, "조"}},
+		"ar":    {{3, "\u00a0ألف"}, {6, "\u00a0مليون"}, {9, "\u00a0مليار"}, {12, "\u00a0تريليون"}},
+	}
+)
+
+func compactUnitsOf(language string) []compactUnit {
+	language = normalizeLanguage(language)
+	if units, ok := compactTable[language]; ok {
+		return units
+	}
+	if units, ok := compactTable[baseLanguage(language)]; ok {
+		return units
+	}
+	return compactEnglish
+}
+
+// FormatCompact 按语言缩写大数字，最多保留 maxFrac 位小数
+// 中文 12345 => "1.23万"，英文 1234567 => "1.23M"，阿拉伯语使用阿拉伯数字
+// 四舍五入后进位到下一个单位，如 999999 => "1M" 而不是 "1000K"
+func FormatCompact(language string, value interface{}, maxFrac int) string {
+	d, ok := toDecimal(value)
+	if !ok {
+		return gconv.String(value)
+	}
+	units := compactUnitsOf(language)
+	symbols := symbolsOf(language)
+
+	i := len(units) - 1
+	for ; i >= 0; i-- {
+		if len(d.intPart)-1 >= units[i].exp {
+			break
+		}
+	}
+	if i < 0 {
+		return symbols.localize(d.round(maxFrac).String(0), true)
+	}
+	shifted := d.shift(units[i].exp).round(maxFrac)
+	//进位之后达到下一个单位
+	if i+1 < len(units) && len(shifted.intPart) > units[i+1].exp-units[i].exp {
+		i++
+		shifted = d.shift(units[i].exp).round(maxFrac)
+	}
+	return symbols.localize(shifted.String(0), true) + units[i].suffix
+}
+
+// currencyInfo 货币符号和小数位数
+type currencyInfo struct {
+	symbol string
+	digits int
+}
+
+var currencyTable = map[string]currencyInfo{
+	"USD": {"$", 2},
+	"CNY": {"¥", 2},
+	"HKD": {"HK$", 2},
+	"TWD": {"NT$", 2},
+	"JPY": {"¥", 0},
+	"KRW": {"₩", 0},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"INR": {"₹", 2},
+	"IDR": {"Rp", 2},
+	"VND": {"₫", 0},
+	"THB": {"฿", 2},
+	"MYR": {"RM", 2},
+	"PHP": {"₱", 2},
+	"SGD": {"S$", 2},
+	"RUB": {"₽", 2},
+	"TRY": {"₺", 2},
+	"BRL": {"R$", 2},
+	"SAR": {"SAR", 2},
+	"AED": {"AED", 2},
+	"EGP": {"E£", 2},
+	"KWD": {"KWD", 3},
+}
+
+// currencySuffixLanguages 货币符号放在数字后面的语言
+var currencySuffixLanguages = map[string]bool{
+	"de": true, "es": true, "fr": true, "it": true, "pt": true,
+	"ru": true, "uk": true, "pl": true, "vi": true, "ar": true,
+}
+
+// FormatCurrency 按语言格式化金额，currency 为ISO 4217货币代码，小数位数由货币决定
+// FormatCurrency("en", 1234.5, "USD") => "$1,234.50"，FormatCurrency("de", 1234.5, "EUR") => "1.234,50 €"(不换行空格)
+func FormatCurrency(language string, value interface{}, currency string) string {
+	currency = strings.ToUpper(currency)
+	info, ok := currencyTable[currency]
+	if !ok {
+		info = currencyInfo{symbol: currency, digits: 2}
+	}
+	d, ok := toDecimal(value)
+	if !ok {
+		return gconv.String(value)
+	}
+	d = d.round(info.digits)
+	negative := d.negative && !d.isZero()
+	d.negative = false
+	num := symbolsOf(language).localize(d.String(info.digits), true)
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	if currencySuffixLanguages[baseLanguage(normalizeLanguage(language))] {
+		b.WriteString(num)
+		b.WriteString("\u00a0")
+		b.WriteString(info.symbol)
+	} else {
+		b.WriteString(info.symbol)
+		b.WriteString(num)
+	}
+	return b.String()
+}
+
+// FormatNumber 按当前会话的语言格式化数字，见 FormatNumber
+func (n *I18n) FormatNumber(value interface{}, maxFrac int) string {
+	return FormatNumber(n.language, value, maxFrac)
+}
+
+// FormatDecimal 按当前会话的语言格式化固定小数位数的金额，见 FormatDecimal
+func (n *I18n) FormatDecimal(value interface{}, frac int) string {
+	return FormatDecimal(n.language, value, frac)
+}
+
+// FormatCompact 按当前会话的语言缩写大数字，见 FormatCompact
+func (n *I18n) FormatCompact(value interface{}, maxFrac int) string {
+	return FormatCompact(n.language, value, maxFrac)
+}
+
+// FormatCurrency 按当前会话的语言格式化金额，见 FormatCurrency
+func (n *I18n) FormatCurrency(value interface{}, currency string) string {
+	return FormatCurrency(n.language, value, currency)
+}
@@ -0,0 +1,60 @@
+package i18n
+
+import "testing"
+
+func TestRoundDecimal(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		frac  int
+		want  string
+	}{
+		{1.005, 2, "1.01"},
+		{float32(0.1), 3, "0.100"},
+		{float32(12345.67), 1, "12345.7"},
+		{-2.5, 0, "-3"},
+		{-0.001, 2, "0.00"},
+		{9.999, 2, "10.00"},
+		{int64(1234), 2, "1234.00"},
+		{"0.125", 2, "0.13"},
+		{"12a", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := RoundDecimal(tt.value, tt.frac); got != tt.want {
+			t.Errorf("RoundDecimal(%v, %d) = %q, want %q", tt.value, tt.frac, got, tt.want)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"en number", FormatNumber("en", 1234567.891, 2), "1,234,567.89"},
+		{"de number", FormatNumber("de", 1234.5, 2), "1.234,5"},
+		{"ar number", FormatNumber("ar", 1234.5, 2), "١٬٢٣٤٫٥"},
+		{"en decimal", FormatDecimal("en", 1234.005, 2), "1,234.01"},
+		{"en decimal int", FormatDecimal("en", 99, 2), "99.00"},
+		{"en compact small", FormatCompact("en", 999, 1), "999"},
+		{"en compact K", FormatCompact("en", 1250, 1), "1.3K"},
+		{"en compact B", FormatCompact("en", 2500000000, 2), "2.5B"},
+		{"en compact carry", FormatCompact("en", 999999, 1), "1M"},
+		{"en compact negative", FormatCompact("en", -15300, 1), "-15.3K"},
+		{"zh compact 万", FormatCompact("zh-CN", 12345, 2), "1.23万"},
+		{"zh compact 亿", FormatCompact("zh-CN", 350000000, 2), "3.5亿"},
+		{"zh-tw compact", FormatCompact("zh-TW", 12345, 1), "1.2萬"},
+		{"ar compact", FormatCompact("ar", 1500000, 1), "١٫٥\u00a0مليون"},
+		{"fr compact default", FormatCompact("fr", 1500, 1), "1,5K"},
+		{"en currency", FormatCurrency("en", 1234.5, "USD"), "$1,234.50"},
+		{"en currency negative", FormatCurrency("en", -3, "usd"), "-$3.00"},
+		{"de currency", FormatCurrency("de", 1234.5, "EUR"), "1.234,50\u00a0€"},
+		{"ja currency", FormatCurrency("ja", 1234.5, "JPY"), "¥1,235"},
+		{"unknown currency", FormatCurrency("en", 1, "XYZ"), "XYZ1.00"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package i18n
 
 import (
+	"fmt"
+
 	"github.com/gogf/gf/i18n/gi18n"
 )
 
@@ -12,24 +14,77 @@ func NewI18n() *I18n {
 // I18n 封装下当前请求用户的language，避免每次格式化都需要传递
 type I18n struct {
 	language string
+	chain    []string //语言回退链，第一个就是 language
 }
 
-// SetLanguage 设置当前会话的语言
+// SetLanguage 设置当前会话的语言，会根据支持的语言生成回退链
 func (n *I18n) SetLanguage(language string) {
-	n.language = language
+	n.SetLanguages(Negotiate([]string{language}, ""))
+}
+
+// SetLanguages 直接设置语言回退链，一般是 Negotiate 的结果
+func (n *I18n) SetLanguages(chain []string) {
+	n.chain = chain
+	n.language = ""
+	if len(chain) > 0 {
+		n.language = chain[0]
+	}
 }
 
-// GetLanguage 设置当前会话的语言
+// GetLanguage 获取当前会话的语言
 func (n *I18n) GetLanguage() string {
 	return n.language
 }
 
-// T 根据key返回当前会话的语言
+// GetLanguages 获取当前会话的语言回退链
+func (n *I18n) GetLanguages() []string {
+	return n.chain
+}
+
+// lookup 沿回退链查找key，返回翻译内容和所在的语言，动态翻译优先于资源文件
+// 当前语言没有这个key时记录缺失，即使回退链中的其他语言找到了
+func (n *I18n) lookup(key string) (string, string, bool) {
+	for i, language := range n.chain {
+		value := bundleContent(key, language)
+		if value == "" {
+			value = gi18n.GetContent(key, language)
+		}
+		if value != "" {
+			if i > 0 {
+				recordMissing(n.language, key)
+			}
+			return value, language, true
+		}
+	}
+	if n.language != "" {
+		recordMissing(n.language, key)
+	}
+	return "", n.language, false
+}
+
+// T 根据key返回当前会话的语言，当前语言没有这个key时沿回退链查找
 func (n *I18n) T(content string) string {
+	if value, _, ok := n.lookup(content); ok {
+		return value
+	}
 	return gi18n.Translate(content, n.language)
 }
 
+// Tm 根据key返回当前会话的语言，按ICU MessageFormat格式化，支持复数、选择和命名参数
+// 例如 "{count, plural, one {# gift} other {# gifts}}"，格式错误时返回未格式化的内容
+func (n *I18n) Tm(key string, args map[string]interface{}) string {
+	pattern, language, ok := n.lookup(key)
+	if !ok {
+		pattern = gi18n.Translate(key, n.language)
+	}
+	result, _ := FormatMessage(language, pattern, args)
+	return result
+}
+
 // Tf 根据key返回当前会话的语言，支持格式化
 func (n *I18n) Tf(format string, values ...interface{}) string {
-	return gi18n.Tfl(n.language, format, values...)
+	if len(n.chain) == 0 {
+		return gi18n.Tfl(n.language, format, values...)
+	}
+	return fmt.Sprintf(n.T(format), values...)
 }
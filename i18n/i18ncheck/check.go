@@ -0,0 +1,312 @@
+package i18ncheck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/errors/gerror"
+
+	"github.com/olaola-chat/slp-library/i18n"
+)
+
+// Locales 语言 => key => 翻译
+type Locales map[string]map[string]string
+
+// LoadLocales 和gi18n一样读取i18n资源目录：
+// 文件名是语言名(i18n/en.toml)，或者子目录名是语言名(i18n/en/*.toml)
+func LoadLocales(dir string) (Locales, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, gerror.Wrapf(err, "read %s error", dir)
+	}
+	locales := make(Locales)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if !entry.IsDir() {
+			language := strings.TrimSuffix(name, filepath.Ext(name))
+			if err := loadLocaleFile(locales, language, path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		files, err := os.ReadDir(path)
+		if err != nil {
+			return nil, gerror.Wrapf(err, "read %s error", path)
+		}
+		if _, ok := locales[name]; !ok {
+			locales[name] = make(map[string]string)
+		}
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			if err := loadLocaleFile(locales, name, filepath.Join(path, f.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return locales, nil
+}
+
+func loadLocaleFile(locales Locales, language, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return gerror.Wrapf(err, "read %s error", path)
+	}
+	kv, err := i18n.ParseBundle(string(content))
+	if err != nil {
+		return gerror.Wrapf(err, "parse %s error", path)
+	}
+	m, ok := locales[language]
+	if !ok {
+		m = make(map[string]string, len(kv))
+		locales[language] = m
+	}
+	for k, v := range kv {
+		m[k] = v
+	}
+	return nil
+}
+
+// Languages 已排序的语言列表
+func (l Locales) Languages() []string {
+	res := make([]string, 0, len(l))
+	for language := range l {
+		res = append(res, language)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ProblemKind 问题类型
+type ProblemKind string
+
+const (
+	// ProblemMissing 代码中使用了，但某个语言中没有
+	ProblemMissing ProblemKind = "missing"
+	// ProblemUnused 语言文件中有，但代码中没有使用
+	ProblemUnused ProblemKind = "unused"
+	// ProblemFormat 格式化参数和翻译不一致，或者各语言之间不一致
+	ProblemFormat ProblemKind = "format"
+)
+
+// Problem 检查出的一个问题
+type Problem struct {
+	Kind     ProblemKind
+	Key      string
+	Language string
+	Pos      string //代码位置，unused 时为空
+	Detail   string
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Pos != "" {
+		b.WriteString(p.Pos)
+		b.WriteString(": ")
+	}
+	b.WriteString(string(p.Kind))
+	b.WriteString(": ")
+	b.WriteString(p.Key)
+	if p.Language != "" {
+		b.WriteString(" [")
+		b.WriteString(p.Language)
+		b.WriteString("]")
+	}
+	if p.Detail != "" {
+		b.WriteString(": ")
+		b.WriteString(p.Detail)
+	}
+	return b.String()
+}
+
+// Options 检查选项
+type Options struct {
+	// IgnoreUnused 这些前缀的key不检查是否使用，用于运行时拼接的key
+	IgnoreUnused []string
+}
+
+// Check 对比代码中使用的key和各语言的翻译
+func Check(usages []Usage, locales Locales, opt Options) []Problem {
+	var problems []Problem
+	languages := locales.Languages()
+
+	used := make(map[string]bool)
+	var prefixes []string
+	for _, u := range usages {
+		if u.Prefix {
+			prefixes = append(prefixes, u.Key)
+			continue
+		}
+		first := !used[u.Key]
+		used[u.Key] = true
+		pos := u.Pos.String()
+		for _, language := range languages {
+			value, ok := locales[language][u.Key]
+			if !ok {
+				//同一个key只在第一次使用的位置报告缺失
+				if first {
+					problems = append(problems, Problem{Kind: ProblemMissing, Key: u.Key, Language: language, Pos: pos})
+				}
+				continue
+			}
+			if detail := checkArgs(u, value); detail != "" {
+				problems = append(problems, Problem{Kind: ProblemFormat, Key: u.Key, Language: language, Pos: pos, Detail: detail})
+			}
+		}
+	}
+	prefixes = append(prefixes, opt.IgnoreUnused...)
+
+	keys := make(map[string]bool)
+	for _, language := range languages {
+		for key := range locales[language] {
+			keys[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		if !used[key] && !hasPrefix(key, prefixes) {
+			problems = append(problems, Problem{Kind: ProblemUnused, Key: key, Language: strings.Join(languagesOf(locales, key), ",")})
+		}
+		if detail := checkConsistency(locales, languages, key); detail != "" {
+			problems = append(problems, Problem{Kind: ProblemFormat, Key: key, Detail: detail})
+		}
+	}
+	return problems
+}
+
+// checkArgs 检查调用的参数和翻译是否匹配
+func checkArgs(u Usage, value string) string {
+	switch u.Kind {
+	case KindFormat:
+		if u.Args < 0 {
+			return ""
+		}
+		if n := countVerbs(value); n != u.Args {
+			return fmt.Sprintf("%s called with %d args, translation %q needs %d", u.Func, u.Args, value, n)
+		}
+	case KindMessage:
+		names, err := i18n.MessageArgs(value)
+		if err != nil {
+			return fmt.Sprintf("invalid message %q: %v", value, err)
+		}
+		if u.Names == nil {
+			return ""
+		}
+		given := make(map[string]bool, len(u.Names))
+		for _, name := range u.Names {
+			given[name] = true
+		}
+		var lack []string
+		for _, name := range names {
+			if !given[name] {
+				lack = append(lack, name)
+			}
+		}
+		if len(lack) > 0 {
+			return fmt.Sprintf("%s missing args %s for translation %q", u.Func, strings.Join(lack, ","), value)
+		}
+	}
+	return ""
+}
+
+// checkConsistency 同一个key在各语言中的格式化参数应该一致
+func checkConsistency(locales Locales, languages []string, key string) string {
+	var (
+		base      string
+		baseVerbs int
+	)
+	for _, language := range languages {
+		value, ok := locales[language][key]
+		if !ok {
+			continue
+		}
+		n := countVerbs(value)
+		if base == "" {
+			base, baseVerbs = language, n
+			continue
+		}
+		if n != baseVerbs {
+			return fmt.Sprintf("%s has %d format verbs, %s has %d", base, baseVerbs, language, n)
+		}
+	}
+	return ""
+}
+
+func languagesOf(locales Locales, key string) []string {
+	var res []string
+	for _, language := range locales.Languages() {
+		if _, ok := locales[language][key]; ok {
+			res = append(res, language)
+		}
+	}
+	return res
+}
+
+func hasPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// countVerbs fmt格式化需要的参数个数，%% 不算，%[n]d 按最大的n计算
+func countVerbs(format string) int {
+	count, argNum := 0, 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		//flags、宽度、精度，* 也消耗一个参数
+		for i < len(format) {
+			c := format[i]
+			if c == '[' {
+				end := strings.IndexByte(format[i:], ']')
+				if end < 0 {
+					break
+				}
+				var n int
+				if _, err := fmt.Sscanf(format[i+1:i+end], "%d", &n); err == nil && n > 0 {
+					argNum = n - 1
+				}
+				i += end + 1
+				continue
+			}
+			if c == '*' {
+				argNum++
+				if argNum > count {
+					count = argNum
+				}
+				i++
+				continue
+			}
+			if strings.IndexByte("+-# 0123456789.", c) >= 0 {
+				i++
+				continue
+			}
+			break
+		}
+		if i >= len(format) || format[i] == '%' {
+			continue
+		}
+		argNum++
+		if argNum > count {
+			count = argNum
+		}
+	}
+	return count
+}
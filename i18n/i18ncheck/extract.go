@@ -0,0 +1,303 @@
+package i18ncheck
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// Kind 翻译调用的类型，决定如何检查参数
+type Kind int
+
+const (
+	// KindKey 只使用key，如 I18n.T、gi18n.GetContent
+	KindKey Kind = iota
+	// KindFormat fmt格式化，如 I18n.Tf、gi18n.Tf
+	KindFormat
+	// KindMessage ICU MessageFormat格式化，如 I18n.Tm
+	KindMessage
+)
+
+// Usage 代码中一次使用翻译key的位置
+type Usage struct {
+	Key    string
+	Prefix bool //key 是动态拼接的，只知道前缀
+	Kind   Kind
+	Func   string
+	Pos    token.Position
+	Args   int      //KindFormat 的参数个数，-1 表示无法确定(如 args...)
+	Names  []string //KindMessage 的参数名，nil 表示无法确定
+}
+
+// gi18nFuncs gi18n包函数 => (key参数位置, 类型)
+var gi18nFuncs = map[string]struct {
+	index int
+	kind  Kind
+}{
+	"T":          {0, KindKey},
+	"Translate":  {0, KindKey},
+	"GetContent": {0, KindKey},
+	"Tf":         {0, KindFormat},
+	"Tfl":        {1, KindFormat},
+}
+
+// methodFuncs I18n的方法 => 类型
+// 没有类型信息，只要是 x.T("常量") 这样的调用都当作翻译
+var methodFuncs = map[string]Kind{
+	"T":  KindKey,
+	"Tf": KindFormat,
+	"Tm": KindMessage,
+}
+
+// contentKeyReg gi18n.T 支持在文本中用 {#key} 引用翻译
+var contentKeyReg = regexp.MustCompile(`{#([^{}]+)}`)
+
+// Extract 递归扫描目录下的Go源文件(不含测试文件和vendor)，返回使用的翻译key，按位置排序
+func Extract(dirs ...string) ([]Usage, error) {
+	files := make(map[string][]string)
+	for _, root := range dirs {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			name := d.Name()
+			if d.IsDir() {
+				if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				dir := filepath.Dir(path)
+				files[dir] = append(files[dir], path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, gerror.Wrapf(err, "walk %s error", root)
+		}
+	}
+
+	var usages []Usage
+	for _, paths := range files {
+		res, err := extractPackage(paths)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, res...)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		a, b := usages[i].Pos, usages[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return usages, nil
+}
+
+// extractPackage 同一个目录的文件一起解析，包级别的字符串常量可以作为key
+func extractPackage(paths []string) ([]Usage, error) {
+	fset := token.NewFileSet()
+	parsed := make([]*ast.File, 0, len(paths))
+	for _, path := range paths {
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, gerror.Wrapf(err, "parse %s error", path)
+		}
+		parsed = append(parsed, f)
+	}
+
+	consts := make(map[string]string)
+	for _, f := range parsed {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if i < len(vs.Values) {
+						if value, ok := constString(vs.Values[i], nil); ok {
+							consts[name.Name] = value
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var usages []Usage
+	for _, f := range parsed {
+		e := &extractor{fset: fset, consts: consts, imports: fileImports(f)}
+		ast.Inspect(f, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpr); ok {
+				usages = append(usages, e.call(call)...)
+			}
+			return true
+		})
+	}
+	return usages, nil
+}
+
+// fileImports 文件中导入包的本地名字 => 包路径
+func fileImports(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+type extractor struct {
+	fset    *token.FileSet
+	consts  map[string]string
+	imports map[string]string
+}
+
+func (e *extractor) call(call *ast.CallExpr) []Usage {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	name := sel.Sel.Name
+
+	var (
+		index int
+		kind  Kind
+		fn    string
+	)
+	if ident, ok := sel.X.(*ast.Ident); ok && e.imports[ident.Name] != "" {
+		if !strings.HasSuffix(e.imports[ident.Name], "/i18n/gi18n") {
+			return nil
+		}
+		f, ok := gi18nFuncs[name]
+		if !ok {
+			return nil
+		}
+		index, kind, fn = f.index, f.kind, "gi18n."+name
+	} else {
+		k, ok := methodFuncs[name]
+		if !ok {
+			return nil
+		}
+		index, kind, fn = 0, k, name
+	}
+	if len(call.Args) <= index {
+		return nil
+	}
+
+	usage := Usage{Kind: kind, Func: fn, Pos: e.fset.Position(call.Pos()), Args: -1}
+	switch kind {
+	case KindFormat:
+		if call.Ellipsis == token.NoPos {
+			usage.Args = len(call.Args) - index - 1
+		}
+	case KindMessage:
+		if len(call.Args) > index+1 {
+			usage.Names = e.mapKeys(call.Args[index+1])
+		} else {
+			usage.Names = []string{}
+		}
+	}
+
+	key, ok := constString(call.Args[index], e.consts)
+	if !ok {
+		//动态key，记录常量前缀，避免前缀下的key被当作未使用
+		if prefix, ok := constPrefix(call.Args[index], e.consts); ok && prefix != "" {
+			usage.Key, usage.Prefix = prefix, true
+			return []Usage{usage}
+		}
+		return nil
+	}
+	if kind == KindKey && name != "GetContent" {
+		if matches := contentKeyReg.FindAllStringSubmatch(key, -1); len(matches) > 0 {
+			res := make([]Usage, 0, len(matches))
+			for _, m := range matches {
+				u := usage
+				u.Key = m[1]
+				res = append(res, u)
+			}
+			return res
+		}
+	}
+	usage.Key = key
+	return []Usage{usage}
+}
+
+// mapKeys Tm 的参数是字面量map时返回所有常量key，否则返回nil
+func (e *extractor) mapKeys(expr ast.Expr) []string {
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(lit.Elts))
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil
+		}
+		name, ok := constString(kv.Key, e.consts)
+		if !ok {
+			return nil
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// constString 字符串字面量、包级别常量以及它们的拼接
+func constString(expr ast.Expr, consts map[string]string) (string, bool) {
+	switch v := expr.(type) {
+	case *ast.BasicLit:
+		if v.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(v.Value)
+		return s, err == nil
+	case *ast.Ident:
+		s, ok := consts[v.Name]
+		return s, ok
+	case *ast.ParenExpr:
+		return constString(v.X, consts)
+	case *ast.BinaryExpr:
+		if v.Op != token.ADD {
+			return "", false
+		}
+		x, ok := constString(v.X, consts)
+		if !ok {
+			return "", false
+		}
+		y, ok := constString(v.Y, consts)
+		return x + y, ok
+	}
+	return "", false
+}
+
+// constPrefix 动态拼接的key最左边的常量部分，如 "gift." + name => "gift."
+func constPrefix(expr ast.Expr, consts map[string]string) (string, bool) {
+	if s, ok := constString(expr, consts); ok {
+		return s, true
+	}
+	if v, ok := expr.(*ast.BinaryExpr); ok && v.Op == token.ADD {
+		return constPrefix(v.X, consts)
+	}
+	return "", false
+}
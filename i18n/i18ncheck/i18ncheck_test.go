@@ -0,0 +1,122 @@
+package i18ncheck
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+const testSource = `package app
+
+import (
+	"github.com/gogf/gf/i18n/gi18n"
+	"github.com/olaola-chat/slp-library/i18n"
+)
+
+const keyTitle = "app.title"
+
+func handle(n *i18n.I18n, name string, args []interface{}) {
+	n.T(keyTitle)
+	n.T("app.missing")
+	n.Tf("app.welcome", name)
+	n.Tf("app.balance", 1)
+	n.Tf("app.dynamic", args...)
+	n.Tm("app.gifts", map[string]interface{}{"count": 1})
+	n.T("gift." + name)
+	gi18n.T("{#app.title} - {#app.footer}")
+	gi18n.Tfl("en", "app.welcome", name)
+}
+`
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "app", "app.go"), testSource)
+	writeFile(t, filepath.Join(root, "app", "app_test.go"), "package app\nfunc x(n interface{ T(string) string }) { n.T(\"test.only\") }\n")
+	writeFile(t, filepath.Join(root, "i18n", "en.toml"), `
+[app]
+title = "Title"
+footer = "Footer"
+welcome = "Welcome %s"
+balance = "Balance %d %s"
+dynamic = "%s"
+gifts = "{count, plural, one {# gift} other {# gifts}} from {name}"
+old = "Old"
+[gift]
+rose = "Rose"
+`)
+	writeFile(t, filepath.Join(root, "i18n", "zh-CN", "app.toml"), `
+[app]
+title = "标题"
+welcome = "欢迎"
+balance = "余额 %[2]s %[1]d"
+dynamic = "%s"
+gifts = "{count} 个礼物"
+`)
+
+	usages, err := Extract(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if len(usages) != 10 {
+		t.Fatalf("Extract() = %d usages, want 10: %+v", len(usages), usages)
+	}
+	locales, err := LoadLocales(filepath.Join(root, "i18n"))
+	if err != nil {
+		t.Fatalf("LoadLocales() error = %v", err)
+	}
+
+	var got []string
+	for _, p := range Check(usages, locales, Options{}) {
+		p.Pos = ""
+		got = append(got, p.String())
+	}
+	sort.Strings(got)
+	want := []string{
+		`format: app.balance [en]: Tf called with 1 args, translation "Balance %d %s" needs 2`,
+		`format: app.balance [zh-CN]: Tf called with 1 args, translation "余额 %[2]s %[1]d" needs 2`,
+		`format: app.gifts [en]: Tm missing args name for translation "{count, plural, one {# gift} other {# gifts}} from {name}"`,
+		`format: app.welcome [zh-CN]: Tf called with 1 args, translation "欢迎" needs 0`,
+		`format: app.welcome [zh-CN]: gi18n.Tfl called with 1 args, translation "欢迎" needs 0`,
+		`format: app.welcome: en has 1 format verbs, zh-CN has 0`,
+		`missing: app.footer [zh-CN]`,
+		`missing: app.missing [en]`,
+		`missing: app.missing [zh-CN]`,
+		`unused: app.old [en]`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Check() got %d problems:\n%v", len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Check()[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCountVerbs(t *testing.T) {
+	tests := map[string]int{
+		"":                 0,
+		"100%%":            0,
+		"%s and %d":        2,
+		"%-5.2f%%":         1,
+		"%[2]s %[1]s":      2,
+		"%*d":              2,
+		"%v %+v %#v %T %q": 5,
+	}
+	for format, want := range tests {
+		if got := countVerbs(format); got != want {
+			t.Errorf("countVerbs(%q) = %d, want %d", format, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/os/gfile"
+)
+
+// defaultLanguage 协商不到任何支持的语言时使用，可以通过 SetDefaultLanguage 修改
+var defaultLanguage = "en"
+
+// parentLanguages 地区语言的回退关系，找不到时再去掉地区后缀回退
+// 例如 zh-hk → zh-tw → zh
+var parentLanguages = map[string]string{
+	"zh-mo":   "zh-hk",
+	"zh-hk":   "zh-tw",
+	"zh-hant": "zh-tw",
+	"zh-sg":   "zh-cn",
+	"zh-my":   "zh-cn",
+	"zh-hans": "zh-cn",
+}
+
+var (
+	languagesOnce sync.Once
+	languagesMu   sync.RWMutex
+	// resourceLanguages 小写语言 => i18n资源文件中的语言名字
+	resourceLanguages map[string]string
+	// languages 参与协商的语言，资源文件中的语言加上动态翻译中的语言
+	languages map[string]string
+)
+
+// SetDefaultLanguage 设置默认语言，需要是资源文件中存在的语言
+func SetDefaultLanguage(language string) {
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	defaultLanguage = normalizeLanguage(language)
+}
+
+// GetDefaultLanguage 获取默认语言
+func GetDefaultLanguage() string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	return defaultLanguage
+}
+
+// SetSupportedLanguages 手动指定支持的语言，不再扫描i18n资源目录
+func SetSupportedLanguages(names ...string) {
+	languagesOnce.Do(func() {})
+	m := make(map[string]string, len(names))
+	for _, name := range names {
+		m[normalizeLanguage(name)] = name
+	}
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	resourceLanguages = m
+	rebuildLanguages()
+}
+
+// rebuildLanguages 重新生成参与协商的语言，需要持有 languagesMu
+// 资源文件中没有任何语言时不做过滤，动态翻译中的语言也不加入
+func rebuildLanguages() {
+	m := make(map[string]string, len(resourceLanguages))
+	for k, v := range resourceLanguages {
+		m[k] = v
+	}
+	if len(m) > 0 {
+		for language := range getBundles() {
+			if _, ok := m[language]; !ok {
+				m[language] = language
+			}
+		}
+	}
+	languages = m
+}
+
+// SupportedLanguages 返回i18n资源文件中存在的语言，已排序
+func SupportedLanguages() []string {
+	loadLanguages()
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	res := make([]string, 0, len(languages))
+	for _, name := range languages {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// loadLanguages 和gi18n一样搜索i18n目录，文件名或者子目录名就是语言名
+func loadLanguages() {
+	languagesOnce.Do(func() {
+		m := make(map[string]string)
+		if path, _ := gfile.Search("i18n"); path != "" {
+			entries, _ := os.ReadDir(path)
+			for _, entry := range entries {
+				name := entry.Name()
+				if !entry.IsDir() {
+					name = strings.TrimSuffix(name, filepath.Ext(name))
+				}
+				if name == "" || strings.HasPrefix(name, ".") {
+					continue
+				}
+				m[normalizeLanguage(name)] = name
+			}
+		}
+		languagesMu.Lock()
+		defer languagesMu.Unlock()
+		resourceLanguages = m
+		rebuildLanguages()
+	})
+}
+
+// lookupLanguage 返回资源文件中的语言名字，没有扫描到任何语言时不做过滤
+func lookupLanguage(language string) (string, bool) {
+	loadLanguages()
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	if len(languages) == 0 {
+		return language, true
+	}
+	name, ok := languages[language]
+	return name, ok
+}
+
+// normalizeLanguage 统一成小写，下划线转成中划线，zh_CN => zh-cn
+func normalizeLanguage(language string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(language)), "_", "-")
+}
+
+// ParseAcceptLanguage 解析 Accept-Language，按q值从高到低返回，q=0 的忽略
+// zh-CN,zh;q=0.9,en;q=0.8 => [zh-cn zh en]
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		language string
+		q        float64
+	}
+	items := make([]weighted, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		language := normalizeLanguage(fields[0])
+		if language == "" || language == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		items = append(items, weighted{language: language, q: q})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.language)
+	}
+	return res
+}
+
+// expandLanguage 展开单个语言的回退链，不做可用性过滤
+// area 用于补全没有地区的语言，zh + tw => zh-tw → zh
+func expandLanguage(language, area string) []string {
+	res := make([]string, 0, 4)
+	seen := make(map[string]bool)
+	add := func(l string) {
+		if l != "" && !seen[l] {
+			seen[l] = true
+			res = append(res, l)
+		}
+	}
+	area = normalizeLanguage(area)
+	if area != "" && !strings.Contains(language, "-") {
+		language = language + "-" + area
+	}
+	for l := language; l != ""; {
+		add(l)
+		for p := parentLanguages[l]; p != "" && !seen[p]; p = parentLanguages[p] {
+			add(p)
+		}
+		i := strings.LastIndex(l, "-")
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+	return res
+}
+
+// Negotiate 根据用户偏好的语言(按优先级排列)和地区，生成可用语言的回退链
+// 链上只包含资源文件中存在的语言，最后总是默认语言
+func Negotiate(preferred []string, area string) []string {
+	chain := make([]string, 0, 4)
+	seen := make(map[string]bool)
+	add := func(l string) {
+		name, ok := lookupLanguage(l)
+		if ok && !seen[name] {
+			seen[name] = true
+			chain = append(chain, name)
+		}
+	}
+	for _, language := range preferred {
+		for _, l := range expandLanguage(normalizeLanguage(language), area) {
+			add(l)
+		}
+	}
+	def := GetDefaultLanguage()
+	if name, ok := lookupLanguage(def); ok {
+		def = name
+	}
+	if !seen[def] {
+		chain = append(chain, def)
+	}
+	return chain
+}
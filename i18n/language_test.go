@@ -0,0 +1,49 @@
+package i18n
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{header: "zh-CN,zh;q=0.9,en;q=0.8", want: []string{"zh-cn", "zh", "en"}},
+		{header: "en;q=0.5, ar-SA , ru;q=0", want: []string{"ar-sa", "en"}},
+		{header: "zh_TW;q=0.7,*;q=0.1,id", want: []string{"id", "zh-tw"}},
+		{header: "", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := ParseAcceptLanguage(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAcceptLanguage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	SetSupportedLanguages("zh-CN", "zh-TW", "zh", "en", "ar")
+	tests := []struct {
+		name      string
+		preferred []string
+		area      string
+		want      []string
+	}{
+		{name: "hk falls back to tw", preferred: []string{"zh-hk"}, want: []string{"zh-TW", "zh", "en"}},
+		{name: "area completes language", preferred: []string{"zh"}, area: "TW", want: []string{"zh-TW", "zh", "en"}},
+		{name: "region kept over area", preferred: []string{"zh-cn"}, area: "tw", want: []string{"zh-CN", "zh", "en"}},
+		{name: "script subtag", preferred: []string{"zh-Hant-HK"}, want: []string{"zh-TW", "zh", "en"}},
+		{name: "unsupported skipped", preferred: []string{"ru", "ar-sa"}, want: []string{"ar", "en"}},
+		{name: "default only", preferred: nil, want: []string{"en"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.preferred, tt.area); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Negotiate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,532 @@
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gogf/gf/util/gconv"
+)
+
+// ICU MessageFormat 支持：
+//   简单参数   {name}
+//   数字       {count, number} {count, number, integer} {rate, number, percent}
+//   日期时间   {at, date, short|medium|long|full} {at, time, short|medium}
+//   复数       {count, plural, offset:1 =0 {none} one {# gift} other {# gifts}}
+//   序数       {rank, selectordinal, one {#st} two {#nd} few {#rd} other {#th}}
+//   选择       {gender, select, male {He} female {She} other {They}}
+// 单引号用于转义：'{' '}' '#' 以及 '' 表示单引号本身
+
+// msgNode 消息语法树节点
+type msgNode interface {
+	format(b *strings.Builder, ctx *msgContext)
+}
+
+type message []msgNode
+
+type textNode string
+
+// argNode 简单参数 {name, type, style}
+type argNode struct {
+	name  string
+	typ   string
+	style string
+}
+
+// pluralNode plural/selectordinal
+type pluralNode struct {
+	name    string
+	ordinal bool
+	offset  float64
+	exact   map[float64]message
+	cases   map[string]message
+}
+
+type selectNode struct {
+	name  string
+	cases map[string]message
+}
+
+// poundNode plural 中的 #，替换为减去 offset 之后的数字
+type poundNode struct{}
+
+// msgContext 格式化上下文，pound 为最近一层 plural 减去 offset 之后的数字
+type msgContext struct {
+	language string
+	args     map[string]interface{}
+	inPlural bool
+	pound    string
+}
+
+func (m message) format(b *strings.Builder, ctx *msgContext) {
+	for _, node := range m {
+		node.format(b, ctx)
+	}
+}
+
+func (t textNode) format(b *strings.Builder, _ *msgContext) {
+	b.WriteString(string(t))
+}
+
+func (poundNode) format(b *strings.Builder, ctx *msgContext) {
+	if !ctx.inPlural {
+		b.WriteByte('#')
+		return
+	}
+	b.WriteString(symbolsOf(ctx.language).localize(ctx.pound, true))
+}
+
+func (a *argNode) format(b *strings.Builder, ctx *msgContext) {
+	value, ok := ctx.args[a.name]
+	if !ok {
+		//和ICU一样，缺少参数时原样输出
+		b.WriteString("{" + a.name + "}")
+		return
+	}
+	switch a.typ {
+	case "number":
+		b.WriteString(formatNumberArg(ctx.language, value, a.style))
+	case "date", "time":
+		t, ok := toTime(value)
+		if !ok {
+			b.WriteString(gconv.String(value))
+			return
+		}
+		b.WriteString(formatDate(ctx.language, a.typ, a.style, t))
+	default:
+		b.WriteString(gconv.String(value))
+	}
+}
+
+func (p *pluralNode) format(b *strings.Builder, ctx *msgContext) {
+	value, ok := ctx.args[p.name]
+	if !ok {
+		b.WriteString("{" + p.name + "}")
+		return
+	}
+	num, ok := toNumber(value)
+	if !ok {
+		b.WriteString(gconv.String(value))
+		return
+	}
+	sub, ok := p.exact[num]
+	rel := num - p.offset
+	relStr := numberString(value, rel)
+	if !ok {
+		category := PluralCategory(ctx.language, relStr)
+		if p.ordinal {
+			category = OrdinalCategory(ctx.language, relStr)
+		}
+		if sub, ok = p.cases[category]; !ok {
+			sub = p.cases[PluralOther]
+		}
+	}
+	subCtx := *ctx
+	subCtx.inPlural = true
+	subCtx.pound = relStr
+	sub.format(b, &subCtx)
+}
+
+func (s *selectNode) format(b *strings.Builder, ctx *msgContext) {
+	key := gconv.String(ctx.args[s.name])
+	sub, ok := s.cases[key]
+	if !ok {
+		sub = s.cases[PluralOther]
+	}
+	sub.format(b, ctx)
+}
+
+// toNumber 参数转成数字，字符串必须是合法数字
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return gconv.Float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// numberString 整数类型参数保持没有小数，保证复数规则的 v 操作数正确
+func numberString(value interface{}, num float64) string {
+	switch value.(type) {
+	case float32, float64, string:
+		return decimalString(num, 0, 3)
+	}
+	return strconv.FormatFloat(math.Trunc(num), 'f', 0, 64)
+}
+
+func formatNumberArg(language string, value interface{}, style string) string {
+	num, ok := toNumber(value)
+	if !ok {
+		return gconv.String(value)
+	}
+	symbols := symbolsOf(language)
+	switch style {
+	case "integer":
+		return symbols.localize(decimalString(math.Round(num), 0, 0), true)
+	case "percent":
+		return symbols.localize(decimalString(num*100, 0, 0), true) + symbols.percent
+	default:
+		return symbols.localize(numberString(value, num), true)
+	}
+}
+
+// toTime 支持 time.Time、unix时间戳(秒)以及gconv能解析的时间字符串
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, false
+		}
+		return *v, true
+	case int, int32, int64, uint, uint32, uint64:
+		return time.Unix(gconv.Int64(v), 0), true
+	case string:
+		t := gconv.Time(v)
+		return t, !t.IsZero()
+	}
+	return time.Time{}, false
+}
+
+// msgParser ICU消息解析器
+type msgParser struct {
+	src []rune
+	pos int
+}
+
+func (p *msgParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("message format error at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *msgParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *msgParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *msgParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// word 读取一个标识符，到空白、逗号或大括号为止
+func (p *msgParser) word() string {
+	start := p.pos
+	for !p.eof() {
+		r := p.src[p.pos]
+		if unicode.IsSpace(r) || r == ',' || r == '{' || r == '}' {
+			break
+		}
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+// parseMessage 解析到文本结束或者未匹配的 }，inPlural 时 # 为数字占位
+func (p *msgParser) parseMessage(inPlural bool, nested bool) (message, error) {
+	msg := make(message, 0)
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			msg = append(msg, textNode(text.String()))
+			text.Reset()
+		}
+	}
+	for !p.eof() {
+		r := p.src[p.pos]
+		switch {
+		case r == '\'':
+			p.pos++
+			p.quoted(&text, inPlural)
+		case r == '{':
+			flush()
+			p.pos++
+			node, err := p.parseArgument(inPlural)
+			if err != nil {
+				return nil, err
+			}
+			msg = append(msg, node)
+		case r == '}':
+			if !nested {
+				return nil, p.errorf("unmatched '}'")
+			}
+			flush()
+			return msg, nil
+		case r == '#' && inPlural:
+			flush()
+			p.pos++
+			msg = append(msg, poundNode{})
+		default:
+			text.WriteRune(r)
+			p.pos++
+		}
+	}
+	if nested {
+		return nil, p.errorf("unclosed '{'")
+	}
+	flush()
+	return msg, nil
+}
+
+// quoted 处理单引号，两个连续的单引号表示单引号本身，只有后面是语法字符时才开始转义
+func (p *msgParser) quoted(text *strings.Builder, inPlural bool) {
+	if p.peek() == '\'' {
+		text.WriteByte('\'')
+		p.pos++
+		return
+	}
+	r := p.peek()
+	if !(r == '{' || r == '}' || (r == '#' && inPlural)) {
+		text.WriteByte('\'')
+		return
+	}
+	for !p.eof() {
+		r := p.src[p.pos]
+		p.pos++
+		if r == '\'' {
+			if p.peek() == '\'' {
+				text.WriteByte('\'')
+				p.pos++
+				continue
+			}
+			return
+		}
+		text.WriteRune(r)
+	}
+}
+
+func (p *msgParser) parseArgument(inPlural bool) (msgNode, error) {
+	p.skipSpace()
+	name := p.word()
+	if name == "" {
+		return nil, p.errorf("argument name expected")
+	}
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		return &argNode{name: name}, nil
+	}
+	if p.peek() != ',' {
+		return nil, p.errorf("',' or '}' expected after argument %s", name)
+	}
+	p.pos++
+	p.skipSpace()
+	typ := p.word()
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		return &argNode{name: name, typ: typ}, nil
+	}
+	if p.peek() != ',' {
+		return nil, p.errorf("',' or '}' expected after type %s", typ)
+	}
+	p.pos++
+
+	switch typ {
+	case "plural", "selectordinal":
+		return p.parsePlural(name, typ == "selectordinal")
+	case "select":
+		cases, err := p.parseCases(inPlural, false)
+		if err != nil {
+			return nil, err
+		}
+		return &selectNode{name: name, cases: cases}, nil
+	case "number", "date", "time":
+		start := p.pos
+		for !p.eof() && p.peek() != '}' {
+			p.pos++
+		}
+		if p.eof() {
+			return nil, p.errorf("unclosed argument %s", name)
+		}
+		style := strings.TrimSpace(string(p.src[start:p.pos]))
+		p.pos++
+		return &argNode{name: name, typ: typ, style: style}, nil
+	default:
+		return nil, p.errorf("unknown argument type %s", typ)
+	}
+}
+
+func (p *msgParser) parsePlural(name string, ordinal bool) (msgNode, error) {
+	node := &pluralNode{name: name, ordinal: ordinal, exact: make(map[float64]message)}
+	p.skipSpace()
+	if strings.HasPrefix(string(p.src[p.pos:]), "offset:") {
+		p.pos += len("offset:")
+		p.skipSpace()
+		offset, err := strconv.ParseFloat(p.word(), 64)
+		if err != nil {
+			return nil, p.errorf("invalid plural offset")
+		}
+		node.offset = offset
+	}
+	cases, err := p.parseCases(true, true)
+	if err != nil {
+		return nil, err
+	}
+	node.cases = make(map[string]message)
+	for key, sub := range cases {
+		if strings.HasPrefix(key, "=") {
+			num, err := strconv.ParseFloat(key[1:], 64)
+			if err != nil {
+				return nil, p.errorf("invalid plural selector %s", key)
+			}
+			node.exact[num] = sub
+			continue
+		}
+		node.cases[key] = sub
+	}
+	return node, nil
+}
+
+// parseCases 解析 key {message} 列表直到 }，必须包含 other
+func (p *msgParser) parseCases(inPlural bool, plural bool) (map[string]message, error) {
+	cases := make(map[string]message)
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unclosed select")
+		}
+		if p.peek() == '}' {
+			p.pos++
+			break
+		}
+		key := p.word()
+		if key == "" {
+			return nil, p.errorf("selector expected")
+		}
+		if plural && !strings.HasPrefix(key, "=") && !isPluralCategory(key) {
+			return nil, p.errorf("invalid plural category %s", key)
+		}
+		p.skipSpace()
+		if p.peek() != '{' {
+			return nil, p.errorf("'{' expected after selector %s", key)
+		}
+		p.pos++
+		sub, err := p.parseMessage(inPlural, true)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++ //结尾的 }
+		cases[key] = sub
+	}
+	if _, ok := cases[PluralOther]; !ok {
+		return nil, p.errorf("'other' case is required")
+	}
+	return cases, nil
+}
+
+func isPluralCategory(key string) bool {
+	switch key {
+	case PluralZero, PluralOne, PluralTwo, PluralFew, PluralMany, PluralOther:
+		return true
+	}
+	return false
+}
+
+// maxMessageCache 最多缓存的消息数量，超过后不再缓存，避免动态翻译反复更新时无限增长
+const maxMessageCache = 10000
+
+var (
+	// messageCache 编译后的语法树缓存，语法树和语言无关，按消息文本缓存
+	// 替换动态翻译时清空
+	messageMu    sync.RWMutex
+	messageCache = make(map[string]message)
+)
+
+// compileMessage 解析消息，结果会被缓存
+func compileMessage(pattern string) (message, error) {
+	messageMu.RLock()
+	cached, ok := messageCache[pattern]
+	messageMu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+	p := &msgParser{src: []rune(pattern)}
+	msg, err := p.parseMessage(false, false)
+	if err != nil {
+		return nil, err
+	}
+	messageMu.Lock()
+	if len(messageCache) < maxMessageCache {
+		messageCache[pattern] = msg
+	}
+	messageMu.Unlock()
+	return msg, nil
+}
+
+// resetMessageCache 清空语法树缓存
+func resetMessageCache() {
+	messageMu.Lock()
+	defer messageMu.Unlock()
+	messageCache = make(map[string]message)
+}
+
+// ParseMessage 检查消息格式是否正确
+func ParseMessage(pattern string) error {
+	_, err := compileMessage(pattern)
+	return err
+}
+
+// MessageArgs 返回消息中使用的参数名，已排序去重
+func MessageArgs(pattern string) ([]string, error) {
+	msg, err := compileMessage(pattern)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	msg.collectArgs(seen)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m message) collectArgs(seen map[string]bool) {
+	for _, node := range m {
+		switch n := node.(type) {
+		case *argNode:
+			seen[n.name] = true
+		case *pluralNode:
+			seen[n.name] = true
+			for _, sub := range n.exact {
+				sub.collectArgs(seen)
+			}
+			for _, sub := range n.cases {
+				sub.collectArgs(seen)
+			}
+		case *selectNode:
+			seen[n.name] = true
+			for _, sub := range n.cases {
+				sub.collectArgs(seen)
+			}
+		}
+	}
+}
+
+// FormatMessage 按ICU MessageFormat格式化消息，language 决定复数规则和数字日期格式
+func FormatMessage(language, pattern string, args map[string]interface{}) (string, error) {
+	msg, err := compileMessage(pattern)
+	if err != nil {
+		return pattern, err
+	}
+	var b strings.Builder
+	msg.format(&b, &msgContext{language: language, args: args})
+	return b.String(), nil
+}
@@ -0,0 +1,86 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatMessage(t *testing.T) {
+	gifts := "{count, plural, =0 {no gifts} one {# gift} other {# gifts}}"
+	ruGifts := "{count, plural, one {# подарок} few {# подарка} many {# подарков} other {# подарка}}"
+	arGifts := "{count, plural, zero {لا هدايا} one {هدية واحدة} two {هديتان} few {# هدايا} many {# هدية} other {# هدية}}"
+	at := time.Date(2023, 3, 5, 14, 7, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		language string
+		pattern  string
+		args     map[string]interface{}
+		want     string
+	}{
+		{name: "en exact", language: "en", pattern: gifts, args: map[string]interface{}{"count": 0}, want: "no gifts"},
+		{name: "en one", language: "en", pattern: gifts, args: map[string]interface{}{"count": 1}, want: "1 gift"},
+		{name: "en other", language: "en", pattern: gifts, args: map[string]interface{}{"count": 1200}, want: "1,200 gifts"},
+		{name: "en decimal", language: "en", pattern: gifts, args: map[string]interface{}{"count": 1.5}, want: "1.5 gifts"},
+		{name: "ru one", language: "ru", pattern: ruGifts, args: map[string]interface{}{"count": 21}, want: "21 подарок"},
+		{name: "ru few", language: "ru", pattern: ruGifts, args: map[string]interface{}{"count": 3}, want: "3 подарка"},
+		{name: "ru many", language: "ru", pattern: ruGifts, args: map[string]interface{}{"count": 11}, want: "11 подарков"},
+		{name: "ar two", language: "ar", pattern: arGifts, args: map[string]interface{}{"count": 2}, want: "هديتان"},
+		{name: "ar few", language: "ar", pattern: arGifts, args: map[string]interface{}{"count": 5}, want: "٥ هدايا"},
+		{name: "ar many", language: "ar", pattern: arGifts, args: map[string]interface{}{"count": 11}, want: "١١ هدية"},
+		{name: "zh other", language: "zh-cn", pattern: "{count, plural, other {# 个礼物}}", args: map[string]interface{}{"count": 1}, want: "1 个礼物"},
+		{
+			name:     "offset",
+			language: "en",
+			pattern:  "{count, plural, offset:1 =0 {nobody} =1 {{name}} one {{name} and # other} other {{name} and # others}}",
+			args:     map[string]interface{}{"count": 3, "name": "Tom"},
+			want:     "Tom and 2 others",
+		},
+		{
+			name:     "select",
+			language: "en",
+			pattern:  "{gender, select, male {He} female {She} other {They}} sent {count, plural, one {a gift} other {# gifts}}",
+			args:     map[string]interface{}{"gender": "female", "count": 2},
+			want:     "She sent 2 gifts",
+		},
+		{
+			name:     "ordinal",
+			language: "en",
+			pattern:  "{rank, selectordinal, one {#st} two {#nd} few {#rd} other {#th}}",
+			args:     map[string]interface{}{"rank": 23},
+			want:     "23rd",
+		},
+		{name: "number", language: "ru", pattern: "{v, number}", args: map[string]interface{}{"v": 1234.5}, want: "1\u00a0234,5"},
+		{name: "percent", language: "en", pattern: "{v, number, percent}", args: map[string]interface{}{"v": 0.256}, want: "26%"},
+		{name: "date", language: "en", pattern: "{at, date, long} {at, time, short}", args: map[string]interface{}{"at": at}, want: "March 5, 2023 2:07 PM"},
+		{name: "date zh", language: "zh", pattern: "{at, date, medium}", args: map[string]interface{}{"at": at}, want: "2023年3月5日"},
+		{name: "quote", language: "en", pattern: "It''s '{name}' {name}", args: map[string]interface{}{"name": "x"}, want: "It's {name} x"},
+		{name: "missing", language: "en", pattern: "hi {name}", args: nil, want: "hi {name}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatMessage(tt.language, tt.pattern, tt.args)
+			if err != nil {
+				t.Fatalf("FormatMessage() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageError(t *testing.T) {
+	patterns := []string{
+		"{count, plural, one {# gift}}",
+		"{count, plural, single {x} other {y}}",
+		"{name",
+		"name}",
+		"{n, unknown, x}",
+	}
+	for _, pattern := range patterns {
+		if err := ParseMessage(pattern); err == nil {
+			t.Errorf("ParseMessage(%q) should fail", pattern)
+		}
+	}
+}
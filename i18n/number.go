@@ -0,0 +1,163 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// numberSymbols 数字格式化使用的符号
+type numberSymbols struct {
+	decimal string
+	group   string
+	percent string
+	digits  []rune //nil表示使用拉丁数字
+}
+
+var (
+	latinSymbols  = numberSymbols{decimal: ".", group: ",", percent: "%"}
+	commaSymbols  = numberSymbols{decimal: ",", group: ".", percent: "%"}
+	spaceSymbols  = numberSymbols{decimal: ",", group: "\u00a0", percent: "%"}
+	arabicSymbols = numberSymbols{decimal: "٫", group: "٬", percent: "٪", digits: []rune("٠١٢٣٤٥٦٧٨٩")}
+)
+
+// numberSymbolsTable 语言 => 数字符号，先找完整语言，再找基础语言，默认英文
+var numberSymbolsTable = map[string]numberSymbols{
+	"en":    latinSymbols,
+	"zh":    latinSymbols,
+	"ja":    latinSymbols,
+	"ko":    latinSymbols,
+	"th":    latinSymbols,
+	"ms":    latinSymbols,
+	"hi":    latinSymbols,
+	"de":    commaSymbols,
+	"es":    commaSymbols,
+	"id":    commaSymbols,
+	"it":    commaSymbols,
+	"nl":    commaSymbols,
+	"pt":    commaSymbols,
+	"tr":    commaSymbols,
+	"vi":    commaSymbols,
+	"fr":    spaceSymbols,
+	"pl":    spaceSymbols,
+	"ru":    spaceSymbols,
+	"uk":    spaceSymbols,
+	"ar":    arabicSymbols,
+	"ar-ma": commaSymbols, //马格里布地区使用拉丁数字
+	"ar-dz": commaSymbols,
+	"ar-tn": commaSymbols,
+}
+
+func symbolsOf(language string) numberSymbols {
+	language = normalizeLanguage(language)
+	if s, ok := numberSymbolsTable[language]; ok {
+		return s
+	}
+	if s, ok := numberSymbolsTable[baseLanguage(language)]; ok {
+		return s
+	}
+	return latinSymbols
+}
+
+// localizeDigits 把拉丁数字替换成该语言的数字
+func (s numberSymbols) localizeDigits(str string) string {
+	if s.digits == nil {
+		return str
+	}
+	var b strings.Builder
+	for _, r := range str {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(s.digits[r-'0'])
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// localize 把 strconv 格式化的数字("-1234.5")加上分组符号，并替换小数点和数字
+func (s numberSymbols) localize(num string, grouping bool) string {
+	negative := strings.HasPrefix(num, "-")
+	num = strings.TrimPrefix(num, "-")
+	intPart, fracPart := num, ""
+	if i := strings.IndexByte(num, '.'); i >= 0 {
+		intPart, fracPart = num[:i], num[i+1:]
+	}
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i := range intPart {
+		if grouping && i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(s.group)
+		}
+		b.WriteByte(intPart[i])
+	}
+	if fracPart != "" {
+		b.WriteString(s.decimal)
+		b.WriteString(fracPart)
+	}
+	return s.localizeDigits(b.String())
+}
+
+// decimalString 按小数位数精确四舍五入，去掉多余的0，至少保留 minFrac 位
+func decimalString(value float64, minFrac, maxFrac int) string {
+	d, ok := toDecimal(value)
+	if !ok {
+		return strconv.FormatFloat(value, 'f', -1, 64) //NaN、Inf
+	}
+	return d.round(maxFrac).String(minFrac)
+}
+
+// dateLayouts 日期格式 short/medium/long/full，时间格式 short/medium
+type dateLayouts struct {
+	date map[string]string
+	time map[string]string
+}
+
+var defaultDateLayouts = dateLayouts{
+	date: map[string]string{"short": "2006-01-02", "medium": "2006-01-02", "long": "2006-01-02", "full": "2006-01-02"},
+	time: map[string]string{"short": "15:04", "medium": "15:04:05"},
+}
+
+// dateLayoutsTable 基础语言 => 日期时间格式
+// 月份星期名称只有英文，其他语言使用数字格式
+var dateLayoutsTable = map[string]dateLayouts{
+	"en": {
+		date: map[string]string{"short": "1/2/06", "medium": "Jan 2, 2006", "long": "January 2, 2006", "full": "Monday, January 2, 2006"},
+		time: map[string]string{"short": "3:04 PM", "medium": "3:04:05 PM"},
+	},
+	"zh": {
+		date: map[string]string{"short": "2006/1/2", "medium": "2006年1月2日", "long": "2006年1月2日", "full": "2006年1月2日"},
+		time: map[string]string{"short": "15:04", "medium": "15:04:05"},
+	},
+	"ja": {
+		date: map[string]string{"short": "2006/01/02", "medium": "2006/01/02", "long": "2006年1月2日", "full": "2006年1月2日"},
+		time: map[string]string{"short": "15:04", "medium": "15:04:05"},
+	},
+	"ru": {
+		date: map[string]string{"short": "02.01.2006", "medium": "02.01.2006", "long": "02.01.2006", "full": "02.01.2006"},
+		time: map[string]string{"short": "15:04", "medium": "15:04:05"},
+	},
+	"ar": {
+		date: map[string]string{"short": "2/1/2006", "medium": "02/01/2006", "long": "02/01/2006", "full": "02/01/2006"},
+		time: map[string]string{"short": "15:04", "medium": "15:04:05"},
+	},
+}
+
+// formatDate kind 为 date 或 time，style 为空时使用 medium
+func formatDate(language, kind, style string, t time.Time) string {
+	layouts, ok := dateLayoutsTable[baseLanguage(language)]
+	if !ok {
+		layouts = defaultDateLayouts
+	}
+	table := layouts.date
+	if kind == "time" {
+		table = layouts.time
+	}
+	layout, ok := table[style]
+	if !ok {
+		layout = table["medium"]
+	}
+	return symbolsOf(language).localizeDigits(t.Format(layout))
+}
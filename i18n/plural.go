@@ -0,0 +1,210 @@
+package i18n
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 复数类别，对应CLDR定义
+const (
+	PluralZero  = "zero"
+	PluralOne   = "one"
+	PluralTwo   = "two"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+// pluralOperands CLDR复数规则的操作数
+// n 绝对值，i 整数部分，v 可见小数位数，f 可见小数部分
+type pluralOperands struct {
+	n float64
+	i int64
+	v int
+	f int64
+}
+
+// newPluralOperands 根据格式化后的数字字符串计算操作数，1.50 和 1.5 的 v 不同
+func newPluralOperands(num string) pluralOperands {
+	num = strings.TrimPrefix(num, "-")
+	ops := pluralOperands{}
+	ops.n, _ = strconv.ParseFloat(num, 64)
+	intPart, fracPart := num, ""
+	if i := strings.IndexByte(num, '.'); i >= 0 {
+		intPart, fracPart = num[:i], num[i+1:]
+	}
+	ops.i, _ = strconv.ParseInt(intPart, 10, 64)
+	ops.v = len(fracPart)
+	if ops.v > 0 {
+		ops.f, _ = strconv.ParseInt(fracPart, 10, 64)
+	}
+	return ops
+}
+
+func inRange(v, from, to int64) bool {
+	return v >= from && v <= to
+}
+
+// pluralRule 返回数字对应的复数类别
+type pluralRule func(ops pluralOperands) string
+
+func pluralOtherOnly(pluralOperands) string {
+	return PluralOther
+}
+
+// pluralOneV0 en/de/nl/sv/it 等：i=1 且没有小数
+func pluralOneV0(ops pluralOperands) string {
+	if ops.i == 1 && ops.v == 0 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+// pluralOneN1 es/tr 等：n=1
+func pluralOneN1(ops pluralOperands) string {
+	if ops.n == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+// pluralOneI01 fr/pt：i=0,1
+func pluralOneI01(ops pluralOperands) string {
+	if ops.i == 0 || ops.i == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+// pluralOneI0N1 hi/bn：i=0 或 n=1
+func pluralOneI0N1(ops pluralOperands) string {
+	if ops.i == 0 || ops.n == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+// pluralRussian ru/uk
+func pluralRussian(ops pluralOperands) string {
+	if ops.v != 0 {
+		return PluralOther
+	}
+	mod10, mod100 := ops.i%10, ops.i%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return PluralOne
+	case inRange(mod10, 2, 4) && !inRange(mod100, 12, 14):
+		return PluralFew
+	default:
+		return PluralMany
+	}
+}
+
+// pluralPolish pl
+func pluralPolish(ops pluralOperands) string {
+	if ops.v != 0 {
+		return PluralOther
+	}
+	mod10, mod100 := ops.i%10, ops.i%100
+	switch {
+	case ops.i == 1:
+		return PluralOne
+	case inRange(mod10, 2, 4) && !inRange(mod100, 12, 14):
+		return PluralFew
+	default:
+		return PluralMany
+	}
+}
+
+// pluralArabic ar
+func pluralArabic(ops pluralOperands) string {
+	n := ops.n
+	isInt := n == math.Trunc(n)
+	mod100 := int64(n) % 100
+	switch {
+	case n == 0:
+		return PluralZero
+	case n == 1:
+		return PluralOne
+	case n == 2:
+		return PluralTwo
+	case isInt && inRange(mod100, 3, 10):
+		return PluralFew
+	case isInt && inRange(mod100, 11, 99):
+		return PluralMany
+	default:
+		return PluralOther
+	}
+}
+
+// ordinalEnglish en序数词：1st 2nd 3rd 4th
+func ordinalEnglish(ops pluralOperands) string {
+	mod10, mod100 := ops.i%10, ops.i%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return PluralOne
+	case mod10 == 2 && mod100 != 12:
+		return PluralTwo
+	case mod10 == 3 && mod100 != 13:
+		return PluralFew
+	default:
+		return PluralOther
+	}
+}
+
+// cardinalRules 基础语言 => 基数复数规则，未列出的语言只有 other
+var cardinalRules = map[string]pluralRule{
+	"zh": pluralOtherOnly,
+	"ja": pluralOtherOnly,
+	"ko": pluralOtherOnly,
+	"th": pluralOtherOnly,
+	"vi": pluralOtherOnly,
+	"id": pluralOtherOnly,
+	"ms": pluralOtherOnly,
+	"en": pluralOneV0,
+	"de": pluralOneV0,
+	"nl": pluralOneV0,
+	"sv": pluralOneV0,
+	"it": pluralOneV0,
+	"es": pluralOneN1,
+	"tr": pluralOneN1,
+	"fr": pluralOneI01,
+	"pt": pluralOneI01,
+	"hi": pluralOneI0N1,
+	"bn": pluralOneI0N1,
+	"ru": pluralRussian,
+	"uk": pluralRussian,
+	"pl": pluralPolish,
+	"ar": pluralArabic,
+}
+
+// ordinalRules 基础语言 => 序数复数规则，未列出的语言只有 other
+var ordinalRules = map[string]pluralRule{
+	"en": ordinalEnglish,
+}
+
+// baseLanguage zh-tw => zh
+func baseLanguage(language string) string {
+	language = normalizeLanguage(language)
+	if i := strings.IndexByte(language, '-'); i >= 0 {
+		return language[:i]
+	}
+	return language
+}
+
+// PluralCategory 返回数字在该语言下的基数复数类别，num 为格式化后的数字，如 "1"、"1.50"
+func PluralCategory(language, num string) string {
+	if rule, ok := cardinalRules[baseLanguage(language)]; ok {
+		return rule(newPluralOperands(num))
+	}
+	return PluralOther
+}
+
+// OrdinalCategory 返回数字在该语言下的序数复数类别
+func OrdinalCategory(language, num string) string {
+	if rule, ok := ordinalRules[baseLanguage(language)]; ok {
+		return rule(newPluralOperands(num))
+	}
+	return PluralOther
+}
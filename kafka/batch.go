@@ -0,0 +1,205 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/frame/g"
+)
+
+// ReceiveBatchFunc 批量消息回调，msgs 来自同一个分区并按offset递增，返回nil表示全部成功
+// 部分失败时返回 *BatchError 列出失败的消息，其他消息视为成功；返回其他错误表示全部失败
+// 一批中的消息可能来自不同的链路，ctx 中没有发送方的链路信息
+type ReceiveBatchFunc func(ctx context.Context, msgs []*sarama.ConsumerMessage) error
+
+// BatchError 批量回调中部分消息失败，Failed 为失败消息在 msgs 中的下标 => 错误
+type BatchError struct {
+	Failed map[int]error
+}
+
+// NewBatchError 创建一个空的 BatchError，使用 Add 记录失败的消息
+func NewBatchError() *BatchError {
+	return &BatchError{Failed: make(map[int]error)}
+}
+
+// Add 记录下标为 i 的消息失败
+func (e *BatchError) Add(i int, err error) {
+	e.Failed[i] = err
+}
+
+// Err 没有失败时返回nil，方便作为回调的返回值
+func (e *BatchError) Err() error {
+	if e == nil || len(e.Failed) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	parts := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		parts = append(parts, fmt.Sprintf("%d: %v", i, e.Failed[i]))
+	}
+	return fmt.Sprintf("kafka batch %d failed, %s", len(indexes), strings.Join(parts, "; "))
+}
+
+// NewConsumerWorkerBatch kafka批量消费，每个分区攒够 BatchSize 条或者等待 BatchWindow 后回调一次
+// 一批成功后才提交offset；有重试策略时失败的消息逐条按策略重试，否则整批重新消费
+func NewConsumerWorkerBatch(cfg *ConsumerConf, handler ReceiveBatchFunc) (*Worker, error) {
+	worker, err := NewConsumerWorkerCtx(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	worker.batchCb = handler
+	return worker, nil
+}
+
+// NewBatchWorkerWithGroup 使用已经创建好的消费组的批量消费，一般用于测试
+func NewBatchWorkerWithGroup(cfg *ConsumerConf, group sarama.ConsumerGroup, handler ReceiveBatchFunc) *Worker {
+	worker := NewWorkerWithGroup(cfg, group, nil)
+	worker.batchCb = handler
+	return worker
+}
+
+func (c *ConsumerConf) batchSize() int {
+	if c.BatchSize > 0 {
+		return c.BatchSize
+	}
+	return 100
+}
+
+func (c *ConsumerConf) batchWindow() time.Duration {
+	if c.BatchWindow > 0 {
+		return c.BatchWindow
+	}
+	return time.Second
+}
+
+// consumeBatch 按分区攒批处理，会话结束时处理完已经攒下的消息再返回
+// 重试topic中的消息需要等到期，逐条处理
+func (serv Consumer) consumeBatch(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	conf := ConsumerConf{BatchSize: serv.BatchSize, BatchWindow: serv.BatchWindow}
+	size, window := conf.batchSize(), conf.batchWindow()
+	batch := make([]*sarama.ConsumerMessage, 0, size)
+	timer := time.NewTimer(window)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if err := serv.processBatch(sess.Context(), batch); err != nil {
+			return err
+		}
+		last := batch[len(batch)-1]
+		sess.MarkMessage(last, "")
+		serv.metrics.mark(last.Topic, last.Partition, last.Offset+1)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok || sess.Context().Err() != nil {
+				return flush()
+			}
+			if Header(msg, HeaderRetryTier) != "" {
+				if err := flush(); err != nil {
+					return err
+				}
+				if err := serv.process(sess.Context(), msg); err != nil {
+					return err
+				}
+				sess.MarkMessage(msg, "")
+				serv.metrics.mark(msg.Topic, msg.Partition, msg.Offset+1)
+				continue
+			}
+			if len(batch) == 0 {
+				timer.Reset(window)
+			}
+			batch = append(batch, msg)
+			if len(batch) >= size {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// processBatch 返回nil表示这一批都已经处理完成(成功、进入重试topic或死信)，可以提交
+func (serv Consumer) processBatch(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+	handlerCtx := ctx
+	if serv.handlerCtx != nil {
+		handlerCtx = serv.handlerCtx
+	}
+	start := time.Now()
+	err := serv.BatchHandler(handlerCtx, batch)
+
+	var (
+		batchErr *BatchError
+		failed   map[int]error
+	)
+	switch {
+	case err == nil:
+	case errors.As(err, &batchErr):
+		failed = batchErr.Failed
+	default:
+		failed = make(map[int]error, len(batch))
+		for i := range batch {
+			failed[i] = err
+		}
+	}
+	for i, msg := range batch {
+		serv.metrics.observe(msg, start, failed[i])
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if serv.retry == nil {
+		g.Log().Printf("kafka batch failed, %s[%d]@%d-%d, %v", batch[0].Topic, batch[0].Partition, batch[0].Offset, batch[len(batch)-1].Offset, err)
+		return err
+	}
+
+	//失败的消息逐条按策略重试
+	for i, msg := range batch {
+		if cause, ok := failed[i]; ok && cause != nil {
+			if err := serv.retry.processFailed(ctx, msg, serv.handle, cause); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleSingle 只有一条消息的批量回调，用于重试和重试topic中的消息
+func (serv Consumer) handleSingle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	err := serv.BatchHandler(ctx, []*sarama.ConsumerMessage{msg})
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Failed[0]
+	}
+	return err
+}
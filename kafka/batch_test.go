@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestConsumeBatch(t *testing.T) {
+	var sizes []int
+	consumer := Consumer{
+		BatchSize:   2,
+		BatchWindow: time.Hour,
+		BatchHandler: func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			sizes = append(sizes, len(msgs))
+			return nil
+		},
+	}
+	sess := &fakeSession{}
+	if err := consumer.ConsumeClaim(sess, newFakeClaim("a", "b", "c", "d", "e")); err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[2] != 1 || sess.markedOffset() != 5 {
+		t.Errorf("sizes = %v, marked = %d", sizes, sess.markedOffset())
+	}
+}
+
+func TestConsumeBatchFailed(t *testing.T) {
+	failed := errors.New("es down")
+	consumer := Consumer{
+		BatchSize: 3,
+		BatchHandler: func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			return failed
+		},
+	}
+	sess := &fakeSession{}
+	//没有重试策略时整批重新消费
+	if err := consumer.ConsumeClaim(sess, newFakeClaim("a", "b", "c")); err != failed {
+		t.Fatalf("ConsumeClaim() error = %v, want %v", err, failed)
+	}
+	if sess.markedOffset() != 0 {
+		t.Errorf("marked = %d, want 0", sess.markedOffset())
+	}
+}
+
+func TestConsumeBatchPartialFailure(t *testing.T) {
+	client, producer := newMockClient(t, 0)
+	defer client.Close()
+	var dead []*sarama.ProducerMessage
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		dead = append(dead, msg)
+		return nil
+	})
+
+	calls := 0
+	consumer := Consumer{
+		BatchSize: 3,
+		retry:     &retrier{policy: &RetryPolicy{Attempts: 1, Backoff: time.Millisecond}, group: "group", client: client},
+		BatchHandler: func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			calls++
+			res := NewBatchError()
+			for i, msg := range msgs {
+				if string(msg.Key) == "bad" {
+					res.Add(i, errors.New("invalid document"))
+				}
+			}
+			return res.Err()
+		},
+	}
+	sess := &fakeSession{}
+	if err := consumer.ConsumeClaim(sess, newFakeClaim("a", "bad", "c")); err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	//一次整批，一次原地重试，之后进入死信
+	if calls != 2 || len(dead) != 1 || sess.markedOffset() != 3 {
+		t.Fatalf("calls = %d, dead = %d, marked = %d", calls, len(dead), sess.markedOffset())
+	}
+	if string(dead[0].Topic) != "group.dlq" || headerValue(dead[0], HeaderOriginalOffset) != "1" || headerValue(dead[0], HeaderError) != "invalid document" {
+		t.Errorf("dead letter = %+v", dead[0])
+	}
+}
+
+func headerValue(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
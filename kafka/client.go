@@ -1,100 +1,278 @@
 package kafka
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"time"
 
-	"github.com/gogf/gf/frame/g"
-
 	"github.com/Shopify/sarama"
-	"github.com/gogf/gf/util/gconv"
+	"github.com/gogf/gf/frame/g"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/silenceper/pool"
 )
 
-// NewClientWithPool 根据 name 实例创建一个kafka连接池
+// ErrClosed 客户端已关闭
+var ErrClosed = errors.New("kafka client closed")
+
+// Callback 消息投递结果回调，err 为nil表示broker已确认，msg.Partition/Offset 为写入的位置
+// 回调在客户端的分发协程中执行，不要阻塞
+type Callback func(msg *sarama.ProducerMessage, err error)
+
+// NewClientWithPool 根据 name 实例创建一个kafka客户端，失败panic
+// 历史原因保留这个名字，内部已经是一个共享的异步生产者，不再是连接池
 func NewClientWithPool(name string) *Client {
-	config, err := GetConfig(name)
-	if err != nil {
-		panic(err)
-	}
-	version, err := sarama.ParseKafkaVersion(config.Version)
+	client, err := NewClient(name)
 	if err != nil {
 		panic(err)
 	}
+	return client
+}
 
-	factory := func() (interface{}, error) {
-		cfg := sarama.NewConfig()
-		cfg.Producer.RequiredAcks = sarama.WaitForLocal
-		cfg.Producer.Partitioner = sarama.NewHashPartitioner
-		cfg.Producer.Return.Successes = true
-		cfg.Producer.Return.Errors = true
-		cfg.Version = version
-		return sarama.NewSyncProducer(config.Host, cfg)
-	}
-	close := func(v interface{}) error {
-		return v.(sarama.SyncProducer).Close()
+// NewClient 根据 name 实例创建一个kafka客户端，使用异步生产者攒批发送
+func NewClient(name string) (*Client, error) {
+	config, err := GetConfig(name)
+	if err != nil {
+		return nil, err
 	}
-
-	poolConfig := &pool.Config{
-		InitialCap: 1,  //资源池初始连接数
-		MaxIdle:    20, //最大空闲连接数
-		MaxCap:     50, //最大并发连接数
-		Factory:    factory,
-		Close:      close,
-		//连接最大空闲时间，超过该时间的连接 将会关闭，可避免空闲时连接EOF，自动失效的问题
-		IdleTimeout: 60 * time.Second,
+	cfg, err := config.producerConfig()
+	if err != nil {
+		return nil, err
 	}
-
-	kafkaPool, err := pool.NewChannelPool(poolConfig)
+	producer, err := sarama.NewAsyncProducer(config.Host, cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return NewClientWithProducer(config, producer), nil
+}
+
+// NewClientWithProducer 使用已经创建好的异步生产者，生产者必须开启 Return.Successes 和 Return.Errors
+func NewClientWithProducer(config *Config, producer sarama.AsyncProducer) *Client {
 	client := &Client{
-		Config: config,
-		Pool:   kafkaPool,
+		Config:   config,
+		producer: producer,
+		slots:    make(chan struct{}, config.maxInflight()),
 	}
-
+	client.Pool = &producerPool{producer: &syncProducer{client: client}}
+	client.dispatch.Add(2)
+	go client.dispatchSuccesses()
+	go client.dispatchErrors()
 	return client
 }
 
-// Client kafka连接池对象
+// Client kafka客户端，多个协程共享一个异步生产者
 type Client struct {
 	Config *Config
-	Pool   pool.Pool
+	// Pool 兼容旧的连接池用法，取出的 sarama.SyncProducer 使用共享的异步生产者发送，不支持事务
+	//
+	// Deprecated: 使用 Send、SendCtx 或者 Produce
+	Pool pool.Pool
+
+	producer sarama.AsyncProducer
+	slots    chan struct{} //未确认消息的名额，满了之后发送阻塞
+	dispatch sync.WaitGroup
+
+	mu     sync.RWMutex //写锁保护 closed，读锁保护向 producer.Input() 发送，避免向已关闭的channel写入
+	closed bool
+
+	countMu  sync.Mutex
+	seq      uint64 //已提交消息的序号
+	inflight int
+	flushes  []*flushWaiter
 }
 
-// Send 发送消息，更快捷方式见下面
-func (serv *Client) Send(topic string, value sarama.Encoder, key ...interface{}) (int32, int64, error) {
-	message := &sarama.ProducerMessage{
-		Topic:     topic,
-		Value:     value,
-		Timestamp: time.Now(),
+// flushWaiter 等待中的 Flush，只等待调用前提交的消息
+type flushWaiter struct {
+	seq       uint64 //调用时最后提交的序号，之后提交的消息不等待
+	remaining int    //序号不超过 seq 并且还没有完成的消息数
+	done      chan struct{}
+}
+
+// pending 投递中的消息，通过 Metadata 带到结果里
+type pending struct {
+	metadata interface{} //调用方原来的 Metadata
+	callback Callback
+	span     opentracing.Span
+	seq      uint64
+}
+
+// Produce 异步发送消息，投递结果通过 cb 返回，cb 可以为nil
+// ctx 中的链路、TraceId、UID和语言会写入消息头，见 ContextFromMessage
+// 未确认的消息达到 MaxInflight 或者生产者的输入队列满时阻塞，直到可以发送或者 ctx 结束
+func (serv *Client) Produce(ctx context.Context, msg *sarama.ProducerMessage, cb Callback) error {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	select {
+	case serv.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 
-	if len(key) > 0 {
-		hashKey := gconv.String(key[0])
-		message.Key = sarama.StringEncoder(hashKey)
+	serv.mu.RLock()
+	defer serv.mu.RUnlock()
+	if serv.closed {
+		<-serv.slots
+		return ErrClosed
+	}
+	seq := serv.begin()
+	span := injectHeaders(ctx, msg)
+	p := &pending{metadata: msg.Metadata, callback: cb, span: span, seq: seq}
+	msg.Metadata = p
+	select {
+	case serv.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		//没有进入生产者，释放名额，错误直接返回，不执行回调
+		p.callback = nil
+		serv.finish(msg, ctx.Err())
+		return ctx.Err()
 	}
+}
 
-	v, err := serv.Pool.Get()
+// Future 异步发送的结果
+type Future struct {
+	done      chan struct{}
+	partition int32
+	offset    int64
+	err       error
+}
+
+// Done 投递完成后关闭
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get 等待投递结果
+func (f *Future) Get() (int32, int64, error) {
+	<-f.done
+	return f.partition, f.offset, f.err
+}
+
+// SendFuture 异步发送消息，返回 Future
+func (serv *Client) SendFuture(ctx context.Context, msg *sarama.ProducerMessage) *Future {
+	f := &Future{done: make(chan struct{})}
+	err := serv.Produce(ctx, msg, func(msg *sarama.ProducerMessage, err error) {
+		f.partition, f.offset, f.err = msg.Partition, msg.Offset, err
+		close(f.done)
+	})
 	if err != nil {
-		return 0, 0, err
+		f.err = err
+		close(f.done)
 	}
-	prod, _ := v.(sarama.SyncProducer)
+	return f
+}
 
-	partition, offset, err := prod.SendMessage(message)
+// Flush 等待调用前已提交的消息投递完成，之后提交的消息不等待
+func (serv *Client) Flush(ctx context.Context) error {
+	serv.countMu.Lock()
+	if serv.inflight == 0 {
+		serv.countMu.Unlock()
+		return nil
+	}
+	w := &flushWaiter{seq: serv.seq, remaining: serv.inflight, done: make(chan struct{})}
+	serv.flushes = append(serv.flushes, w)
+	serv.countMu.Unlock()
 
-	if err != nil {
-		g.Log().Error("Kafka send message error", err)
-		serv.Pool.Close(prod)
-		return 0, 0, err
-	} else {
-		err := serv.Pool.Put(prod)
-		if err != nil {
-			g.Log().Error("Kafka Pool put error", err)
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 不再接收新消息，等待已提交的消息投递完成后关闭生产者
+func (serv *Client) Close() error {
+	serv.mu.Lock()
+	if serv.closed {
+		serv.mu.Unlock()
+		return nil
+	}
+	serv.closed = true
+	serv.mu.Unlock()
+
+	_ = serv.Flush(context.Background())
+	err := serv.producer.Close()
+	serv.dispatch.Wait()
+	return err
+}
+
+// begin 记录一条投递中的消息，返回消息的序号
+func (serv *Client) begin() uint64 {
+	serv.countMu.Lock()
+	defer serv.countMu.Unlock()
+	serv.seq++
+	serv.inflight++
+	return serv.seq
+}
+
+// finish 投递完成，先释放名额再执行回调，回调中可以继续 Produce
+// 等待的 Flush 在回调之后返回
+func (serv *Client) finish(msg *sarama.ProducerMessage, err error) {
+	var (
+		cb  Callback
+		seq uint64
+	)
+	if p, ok := msg.Metadata.(*pending); ok {
+		msg.Metadata = p.metadata
+		cb, seq = p.callback, p.seq
+		if p.span != nil {
+			if err != nil {
+				ext.Error.Set(p.span, true)
+				p.span.SetTag("error.message", err.Error())
+			}
+			p.span.SetTag("partition", msg.Partition)
+			p.span.SetTag("offset", msg.Offset)
+			p.span.Finish()
+		}
+	}
+	<-serv.slots
+
+	serv.countMu.Lock()
+	serv.inflight--
+	var done []*flushWaiter
+	waiters := serv.flushes[:0]
+	for _, w := range serv.flushes {
+		if seq > 0 && seq <= w.seq {
+			w.remaining--
 		}
+		if w.remaining <= 0 {
+			done = append(done, w)
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	serv.flushes = waiters
+	serv.countMu.Unlock()
+
+	if cb != nil {
+		cb(msg, err)
+	}
+	for _, w := range done {
+		close(w.done)
 	}
+}
+
+func (serv *Client) dispatchSuccesses() {
+	defer serv.dispatch.Done()
+	for msg := range serv.producer.Successes() {
+		serv.finish(msg, nil)
+	}
+}
 
-	return partition, offset, err
+func (serv *Client) dispatchErrors() {
+	defer serv.dispatch.Done()
+	for perr := range serv.producer.Errors() {
+		g.Log().Error("Kafka send message error", perr.Msg.Topic, perr.Err)
+		serv.finish(perr.Msg, perr.Err)
+	}
+}
+
+// Send 发送消息并等待broker确认，需要传递链路时使用 SendCtx，更快捷方式见下面
+func (serv *Client) Send(topic string, value sarama.Encoder, key ...interface{}) (int32, int64, error) {
+	return serv.SendCtx(context.Background(), topic, value, key...)
 }
 
 // SendString 发送字符串消息
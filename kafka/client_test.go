@@ -0,0 +1,210 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+func newMockClient(t *testing.T, maxInflight int) (*Client, *mocks.AsyncProducer) {
+	config := &Config{MaxInflight: maxInflight}
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+	producer := mocks.NewAsyncProducer(t, cfg)
+	return NewClientWithProducer(config, producer), producer
+}
+
+func TestClientSend(t *testing.T) {
+	client, producer := newMockClient(t, 0)
+	failed := errors.New("broker down")
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(failed)
+
+	_, offset, err := client.SendString("topic", "hello", 1)
+	if err != nil || offset != 1 {
+		t.Fatalf("Send() = %d, %v", offset, err)
+	}
+	if _, _, err := client.SendString("topic", "hello"); !errors.Is(err, failed) {
+		t.Fatalf("Send() error = %v, want %v", err, failed)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, _, err := client.SendString("topic", "hello"); err != ErrClosed {
+		t.Fatalf("Send() after close error = %v", err)
+	}
+}
+
+func TestClientProduceFlush(t *testing.T) {
+	client, producer := newMockClient(t, 0)
+	const count = 100
+	var delivered int32
+	for i := 0; i < count; i++ {
+		producer.ExpectInputAndSucceed()
+	}
+	for i := 0; i < count; i++ {
+		msg := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("v"), Metadata: i}
+		err := client.Produce(context.Background(), msg, func(msg *sarama.ProducerMessage, err error) {
+			if err != nil || msg.Metadata == nil {
+				t.Errorf("callback msg = %+v, err = %v", msg, err)
+			}
+			atomic.AddInt32(&delivered, 1)
+		})
+		if err != nil {
+			t.Fatalf("Produce() error = %v", err)
+		}
+	}
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&delivered); n != count {
+		t.Fatalf("delivered = %d, want %d", n, count)
+	}
+	_ = client.Close()
+}
+
+func TestClientBackpressure(t *testing.T) {
+	client, _ := newMockClient(t, 1)
+	client.slots <- struct{}{} //名额已经用完
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	msg := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("v")}
+	if err := client.Produce(ctx, msg, nil); err != context.DeadlineExceeded {
+		t.Fatalf("Produce() error = %v, want deadline exceeded", err)
+	}
+	<-client.slots
+	_ = client.Close()
+}
+
+func TestClientProduceInCallback(t *testing.T) {
+	client, producer := newMockClient(t, 1)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	done := make(chan error, 1)
+	msg := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("v")}
+	err := client.Produce(context.Background(), msg, func(*sarama.ProducerMessage, error) {
+		//名额已经释放，回调中继续发送不会死锁
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		done <- client.Produce(ctx, &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("next")}, nil)
+	})
+	if err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Produce() in callback error = %v", err)
+	}
+	_ = client.Close()
+}
+
+func TestClientFlushBefore(t *testing.T) {
+	client := &Client{slots: make(chan struct{}, 3)}
+	produce := func() *sarama.ProducerMessage {
+		client.slots <- struct{}{}
+		return &sarama.ProducerMessage{Metadata: &pending{seq: client.begin()}}
+	}
+	msgs := []*sarama.ProducerMessage{produce(), produce(), nil}
+	flushed := make(chan error, 1)
+	go func() { flushed <- client.Flush(context.Background()) }()
+	for {
+		client.countMu.Lock()
+		n := len(client.flushes)
+		client.countMu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	//Flush 之后提交的消息不等待
+	msgs[2] = produce()
+	client.finish(msgs[0], nil)
+	client.finish(msgs[1], nil)
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush() waits for messages produced after it")
+	}
+	client.finish(msgs[2], nil)
+	if client.inflight != 0 || len(client.flushes) != 0 {
+		t.Errorf("inflight = %d, flushes = %d", client.inflight, len(client.flushes))
+	}
+}
+
+// blockedProducer 输入队列没有人读取
+type blockedProducer struct {
+	*mocks.AsyncProducer
+	input chan *sarama.ProducerMessage
+}
+
+func (p blockedProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func TestClientProduceInputCanceled(t *testing.T) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	producer := blockedProducer{AsyncProducer: mocks.NewAsyncProducer(t, cfg), input: make(chan *sarama.ProducerMessage)}
+	client := NewClientWithProducer(&Config{MaxInflight: 1}, producer)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	msg := &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("v"), Metadata: "meta"}
+	called := false
+	if err := client.Produce(ctx, msg, func(*sarama.ProducerMessage, error) { called = true }); err != context.DeadlineExceeded {
+		t.Fatalf("Produce() error = %v, want deadline exceeded", err)
+	}
+	if called || msg.Metadata != "meta" || len(client.slots) != 0 || client.inflight != 0 {
+		t.Errorf("called = %v, metadata = %v, slots = %d, inflight = %d", called, msg.Metadata, len(client.slots), client.inflight)
+	}
+	_ = client.Close()
+}
+
+func TestClientPool(t *testing.T) {
+	client, producer := newMockClient(t, 0)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	v, err := client.Pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := v.(sarama.SyncProducer)
+	if _, offset, err := prod.SendMessage(&sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("v")}); err != nil || offset != 1 {
+		t.Fatalf("SendMessage() = %d, %v", offset, err)
+	}
+	msgs := []*sarama.ProducerMessage{
+		{Topic: "topic", Value: sarama.StringEncoder("a")},
+		{Topic: "topic", Value: sarama.StringEncoder("b")},
+	}
+	if err := prod.SendMessages(msgs); err != nil {
+		t.Fatalf("SendMessages() error = %v", err)
+	}
+	if err := client.Pool.Put(prod); err != nil || prod.BeginTxn() == nil {
+		t.Errorf("Put() error = %v", err)
+	}
+	_ = client.Close()
+}
+
+func TestProducerConfig(t *testing.T) {
+	config := &Config{Version: "2.1.0", LingerMs: 5, BatchMessages: 100, Compression: "lz4"}
+	cfg, err := config.producerConfig()
+	if err != nil {
+		t.Fatalf("producerConfig() error = %v", err)
+	}
+	if cfg.Producer.Flush.Frequency != 5*time.Millisecond || cfg.Producer.Flush.Messages != 100 ||
+		cfg.Producer.Compression != sarama.CompressionLZ4 || cfg.ChannelBufferSize != defaultMaxInflight {
+		t.Errorf("producerConfig() = %+v", cfg.Producer)
+	}
+	config.Compression = "brotli"
+	if _, err := config.producerConfig(); err == nil {
+		t.Errorf("producerConfig() should fail with unknown compression")
+	}
+}
@@ -0,0 +1,198 @@
+// kafkactl kafka运维命令，kafka集群使用配置文件中的 go-kafka.<name>
+//
+//	kafkactl --gf.gcfg.file config.toml redrive --name default --topic mygroup.dlq --dry-run
+//	kafkactl --gf.gcfg.file config.toml groups --name default mygroup
+//	kafkactl --gf.gcfg.file config.toml topics --name default --create
+//	kafkactl --gf.gcfg.file config.toml reset-offsets --group mygroup --topic orders --to "2024-01-02 15:04:05" --dry-run
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/Shopify/sarama"
+	"github.com/urfave/cli"
+
+	"github.com/olaola-chat/slp-library/kafka"
+)
+
+func main() {
+	ca := cli.NewApp()
+	ca.Name = "kafkactl"
+	ca.Usage = "kafka operation tools"
+	ca.Version = "0.0.1"
+	ca.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "gf.gcfg.file",
+			Usage: "config name",
+			Value: "config.toml",
+		},
+	}
+	ca.Commands = []cli.Command{
+		redriveCommand(),
+		groupsCommand(),
+		resetOffsetsCommand(),
+		topicsCommand(),
+	}
+	if err := ca.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// signalContext 收到退出信号时取消
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sign := make(chan os.Signal, 1)
+	signal.Notify(sign, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sign:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func redriveCommand() cli.Command {
+	return cli.Command{
+		Name:  "redrive",
+		Usage: "send dead letter messages back to their original topic",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "name", Usage: "kafka config name", Value: "default"},
+			cli.StringFlag{Name: "topic", Usage: "dead letter topic, e.g. <group>.dlq"},
+			cli.StringFlag{Name: "to", Usage: "target topic, default the original topic in headers"},
+			cli.StringFlag{Name: "group", Usage: "group to record progress, default <topic>.redrive"},
+			cli.IntFlag{Name: "limit", Usage: "max messages, 0 means all"},
+			cli.BoolFlag{Name: "dry-run", Usage: "only print messages"},
+		},
+		Action: func(c *cli.Context) error {
+			topic := c.String("topic")
+			if topic == "" {
+				return cli.NewExitError("--topic is required", 2)
+			}
+			ctx, cancel := signalContext()
+			defer cancel()
+
+			opt := kafka.RedriveOptions{
+				Group:  c.String("group"),
+				To:     c.String("to"),
+				Limit:  c.Int("limit"),
+				DryRun: c.Bool("dry-run"),
+			}
+			count, err := kafka.Redrive(ctx, c.String("name"), topic, opt, func(msg *sarama.ConsumerMessage, target string) {
+				fmt.Printf("%s[%d]@%d -> %s error=%q\n", msg.Topic, msg.Partition, msg.Offset, target, kafka.Header(msg, kafka.HeaderError))
+			})
+			fmt.Printf("%d messages redriven, dry-run=%v\n", count, opt.DryRun)
+			return err
+		},
+	}
+}
+
+func groupsCommand() cli.Command {
+	return cli.Command{
+		Name:      "groups",
+		Usage:     "list consumer groups and their lag",
+		ArgsUsage: "[group...]",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "name", Usage: "kafka config name", Value: "default"},
+			cli.BoolFlag{Name: "partitions", Usage: "print lag of every partition"},
+		},
+		Action: func(c *cli.Context) error {
+			groups, err := kafka.ListGroups(c.String("name"), c.Args()...)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "GROUP\tSTATE\tMEMBERS\tLAG")
+			for _, group := range groups {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", group.Group, group.State, group.Members, group.Lag)
+				if !c.Bool("partitions") {
+					continue
+				}
+				for _, p := range group.Partitions {
+					fmt.Fprintf(w, "  %s[%d]\t\tcommitted=%d high=%d\t%d\n", p.Topic, p.Partition, p.Committed, p.HighWater, p.Lag)
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func resetOffsetsCommand() cli.Command {
+	return cli.Command{
+		Name:  "reset-offsets",
+		Usage: "reset offsets of a consumer group without active members",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "name", Usage: "kafka config name", Value: "default"},
+			cli.StringFlag{Name: "group", Usage: "consumer group"},
+			cli.StringFlag{Name: "topic", Usage: "topic to reset"},
+			cli.StringFlag{Name: "to", Usage: "earliest, latest, time (RFC3339 or 2006-01-02 15:04:05) or partition:offset[,partition:offset]"},
+			cli.BoolFlag{Name: "dry-run", Usage: "only print the new offsets"},
+		},
+		Action: func(c *cli.Context) error {
+			group, topic := c.String("group"), c.String("topic")
+			if group == "" || topic == "" {
+				return cli.NewExitError("--group and --topic are required", 2)
+			}
+			reset, err := kafka.ParseOffsetReset(c.String("to"))
+			if err != nil {
+				return cli.NewExitError(err.Error(), 2)
+			}
+			dryRun := c.Bool("dry-run")
+			changes, err := kafka.ResetOffsets(c.String("name"), group, topic, reset, dryRun)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "PARTITION\tFROM\tTO")
+			for _, change := range changes {
+				fmt.Fprintf(w, "%s[%d]\t%d\t%d\n", change.Topic, change.Partition, change.From, change.To)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Printf("%d partitions reset, dry-run=%v\n", len(changes), dryRun)
+			return nil
+		},
+	}
+}
+
+func topicsCommand() cli.Command {
+	return cli.Command{
+		Name:  "topics",
+		Usage: "verify topics declared in config and code, create missing ones with --create",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "name", Usage: "kafka config name", Value: "default"},
+			cli.BoolFlag{Name: "create", Usage: "create missing topics"},
+		},
+		Action: func(c *cli.Context) error {
+			reports, err := kafka.EnsureTopics(c.String("name"), c.Bool("create"))
+			drift := 0
+			for _, report := range reports {
+				status := "ok"
+				if !report.OK() {
+					status = "drift"
+					drift++
+				}
+				switch {
+				case report.Missing:
+					status = "missing"
+				case report.Created:
+					status = "created"
+				}
+				fmt.Printf("%-8s %s\n", status, report)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%d topics checked, %d differ from declaration\n", len(reports), drift)
+			return nil
+		},
+	}
+}
@@ -1,24 +1,271 @@
 package kafka
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/gogf/gf/errors/gerror"
 	"github.com/gogf/gf/frame/g"
 )
 
 // Config config配置中的kafka定义
 type Config struct {
-	Host    []string
-	Version string
+	Host     []string
+	Version  string
+	ClientID string //默认 sarama
+	SASL     SASLConfig
+	TLS      TLSConfig
+
+	Acks       string //none、local、all，默认local，开启幂等时必须为all
+	Idempotent bool   //幂等生产，broker 去重，需要 0.11 以上版本
+
+	//生产者参数，0 表示使用默认值
+	LingerMs      int    //消息攒批的最长等待时间，默认不等待
+	BatchBytes    int    //攒够多少字节发送一批
+	BatchMessages int    //攒够多少条发送一批
+	MaxMessages   int    //一批最多多少条，默认不限制
+	Compression   string //none、gzip、snappy、lz4、zstd，默认none
+	MaxInflight   int    //已提交未确认的消息上限，超过后发送阻塞，默认10000
+
+	//消费者参数，0 表示使用默认值
+	InitialOffset      string //消费组没有提交过offset时从哪里开始，oldest、newest，默认oldest
+	CommitIntervalMs   int    //offset提交间隔，默认1000
+	SessionTimeoutMs   int    //消费组会话超时，默认10000
+	HeartbeatMs        int    //心跳间隔，需要小于会话超时的三分之一，默认3000
+	RebalanceTimeoutMs int    //重新平衡时等待成员加入的时间，默认60000
+	Rebalance          string //分区分配策略，range、roundrobin、sticky，多个用逗号分隔按优先级，默认range
+	ReadCommitted      bool   //只读取已提交事务中的消息，消费事务管道的输出时打开
+
+	Topics       []TopicSpec //这个集群上需要的topic，见 EnsureTopics
+	EnsureTopics bool        //创建消费者时检查并创建声明的topic
+	StrictTopics bool        //消费的topic不存在时创建消费者失败，默认只记录警告
+}
+
+// SASLConfig SASL认证，Mechanism 为空表示不认证
+type SASLConfig struct {
+	Mechanism string //PLAIN、SCRAM-SHA-256、SCRAM-SHA-512
+	User      string
+	Password  string
+}
+
+// TLSConfig TLS连接，Enable 为false时其他参数无效
+type TLSConfig struct {
+	Enable             bool
+	CAFile             string //服务端证书的CA，默认使用系统CA
+	CertFile           string //客户端证书，双向认证时使用
+	KeyFile            string
+	ServerName         string //校验证书的域名，默认使用连接的地址
+	InsecureSkipVerify bool   //不校验服务端证书，只用于测试
 }
 
+// defaultMaxInflight 默认的未确认消息上限
+const defaultMaxInflight = 10000
+
 // GetConfig 根据名字解析配置
 func GetConfig(name string) (*Config, error) {
 	config := &Config{}
 	err := g.Cfg().GetStruct(fmt.Sprintf("go-kafka.%s", name), config)
 	if err != nil {
-		return config, gerror.Wrap(err, "redis config error")
+		return config, gerror.Wrap(err, "kafka config error")
 	}
 	return config, nil
 }
+
+// saramaConfig 生产者和消费者共用的连接配置
+func (c *Config) saramaConfig() (*sarama.Config, error) {
+	version, err := sarama.ParseKafkaVersion(c.Version)
+	if err != nil {
+		return nil, gerror.Wrapf(err, "kafka version %s error", c.Version)
+	}
+	cfg := sarama.NewConfig()
+	cfg.Version = version
+	if c.ClientID != "" {
+		cfg.ClientID = c.ClientID
+	}
+	if err := c.SASL.apply(cfg); err != nil {
+		return nil, err
+	}
+	if err := c.TLS.apply(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// producerConfig 生成异步生产者的sarama配置
+func (c *Config) producerConfig() (*sarama.Config, error) {
+	cfg, err := c.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Producer.RequiredAcks, err = parseAcks(c.Acks)
+	if err != nil {
+		return nil, err
+	}
+	if c.Idempotent {
+		if c.Acks != "" && cfg.Producer.RequiredAcks != sarama.WaitForAll {
+			return nil, gerror.Newf("kafka idempotent producer requires acks all, got %s", c.Acks)
+		}
+		cfg.Producer.Idempotent = true
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+		cfg.Net.MaxOpenRequests = 1
+	}
+	cfg.Producer.Partitioner = sarama.NewHashPartitioner
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+	cfg.Producer.Flush.Frequency = time.Duration(c.LingerMs) * time.Millisecond
+	cfg.Producer.Flush.Bytes = c.BatchBytes
+	cfg.Producer.Flush.Messages = c.BatchMessages
+	cfg.Producer.Flush.MaxMessages = c.MaxMessages
+	if c.Compression != "" {
+		if err := cfg.Producer.Compression.UnmarshalText([]byte(c.Compression)); err != nil {
+			return nil, gerror.Wrapf(err, "kafka compression %s error", c.Compression)
+		}
+	}
+	cfg.ChannelBufferSize = c.maxInflight()
+	if err := cfg.Validate(); err != nil {
+		return nil, gerror.Wrap(err, "kafka producer config error")
+	}
+	return cfg, nil
+}
+
+// consumerConfig 生成消费组的sarama配置
+func (c *Config) consumerConfig() (*sarama.Config, error) {
+	cfg, err := c.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Consumer.Return.Errors = true
+	cfg.Consumer.Offsets.CommitInterval = time.Second
+	if c.CommitIntervalMs > 0 {
+		cfg.Consumer.Offsets.CommitInterval = time.Duration(c.CommitIntervalMs) * time.Millisecond
+	}
+	switch strings.ToLower(c.InitialOffset) {
+	case "", "oldest", "earliest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case "newest", "latest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return nil, gerror.Newf("kafka initial offset %s error", c.InitialOffset)
+	}
+	if c.ReadCommitted {
+		cfg.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
+	if c.SessionTimeoutMs > 0 {
+		cfg.Consumer.Group.Session.Timeout = time.Duration(c.SessionTimeoutMs) * time.Millisecond
+	}
+	if c.HeartbeatMs > 0 {
+		cfg.Consumer.Group.Heartbeat.Interval = time.Duration(c.HeartbeatMs) * time.Millisecond
+	}
+	if c.RebalanceTimeoutMs > 0 {
+		cfg.Consumer.Group.Rebalance.Timeout = time.Duration(c.RebalanceTimeoutMs) * time.Millisecond
+	}
+	if c.Rebalance != "" {
+		strategies, err := parseRebalance(c.Rebalance)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Consumer.Group.Rebalance.GroupStrategies = strategies
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, gerror.Wrap(err, "kafka consumer config error")
+	}
+	return cfg, nil
+}
+
+func parseAcks(acks string) (sarama.RequiredAcks, error) {
+	switch strings.ToLower(acks) {
+	case "", "local", "1":
+		return sarama.WaitForLocal, nil
+	case "none", "0":
+		return sarama.NoResponse, nil
+	case "all", "-1":
+		return sarama.WaitForAll, nil
+	}
+	return 0, gerror.Newf("kafka acks %s error", acks)
+}
+
+func parseRebalance(names string) ([]sarama.BalanceStrategy, error) {
+	var strategies []sarama.BalanceStrategy
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "range":
+			strategies = append(strategies, sarama.BalanceStrategyRange)
+		case "roundrobin":
+			strategies = append(strategies, sarama.BalanceStrategyRoundRobin)
+		case "sticky":
+			strategies = append(strategies, sarama.BalanceStrategySticky)
+		default:
+			return nil, gerror.Newf("kafka rebalance strategy %s error", name)
+		}
+	}
+	return strategies, nil
+}
+
+// apply 设置SASL认证，SCRAM 使用 github.com/xdg-go/scram
+func (s SASLConfig) apply(cfg *sarama.Config) error {
+	if s.Mechanism == "" {
+		return nil
+	}
+	cfg.Net.SASL.Enable = true
+	cfg.Net.SASL.Handshake = true
+	cfg.Net.SASL.User = s.User
+	cfg.Net.SASL.Password = s.Password
+	switch strings.ToUpper(s.Mechanism) {
+	case sarama.SASLTypePlaintext:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{HashGeneratorFcn: scramSHA256} }
+	case sarama.SASLTypeSCRAMSHA512:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{HashGeneratorFcn: scramSHA512} }
+	default:
+		return gerror.Newf("kafka sasl mechanism %s error", s.Mechanism)
+	}
+	return nil
+}
+
+// apply 设置TLS连接，证书文件在创建连接前读取，文件错误时直接返回
+func (t TLSConfig) apply(cfg *sarama.Config) error {
+	if !t.Enable {
+		return nil
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return gerror.Wrapf(err, "kafka tls ca %s error", t.CAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return gerror.Newf("kafka tls ca %s has no certificate", t.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return gerror.Wrapf(err, "kafka tls cert %s error", t.CertFile)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	cfg.Net.TLS.Enable = true
+	cfg.Net.TLS.Config = tlsCfg
+	return nil
+}
+
+func (c *Config) maxInflight() int {
+	if c.MaxInflight > 0 {
+		return c.MaxInflight
+	}
+	return defaultMaxInflight
+}
@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestProducerConfigAcks(t *testing.T) {
+	tests := []struct {
+		config  Config
+		acks    sarama.RequiredAcks
+		wantErr bool
+	}{
+		{Config{Version: "2.1.0"}, sarama.WaitForLocal, false},
+		{Config{Version: "2.1.0", Acks: "all"}, sarama.WaitForAll, false},
+		{Config{Version: "2.1.0", Acks: "none"}, sarama.NoResponse, false},
+		{Config{Version: "2.1.0", Idempotent: true}, sarama.WaitForAll, false},
+		{Config{Version: "2.1.0", Idempotent: true, Acks: "local"}, 0, true},
+		{Config{Version: "0.10.2.0", Idempotent: true}, 0, true},
+		{Config{Version: "2.1.0", Acks: "some"}, 0, true},
+	}
+	for _, tt := range tests {
+		cfg, err := tt.config.producerConfig()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("producerConfig(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+			continue
+		}
+		if err == nil && cfg.Producer.RequiredAcks != tt.acks {
+			t.Errorf("producerConfig(%+v) acks = %v, want %v", tt.config, cfg.Producer.RequiredAcks, tt.acks)
+		}
+	}
+}
+
+func TestConsumerConfig(t *testing.T) {
+	config := &Config{
+		Version:          "2.1.0",
+		ClientID:         "room-service",
+		InitialOffset:    "newest",
+		CommitIntervalMs: 500,
+		SessionTimeoutMs: 30000,
+		HeartbeatMs:      5000,
+		Rebalance:        "sticky, range",
+		SASL:             SASLConfig{Mechanism: "scram-sha-512", User: "user", Password: "pass"},
+		TLS:              TLSConfig{Enable: true, ServerName: "kafka.example.com"},
+	}
+	cfg, err := config.consumerConfig()
+	if err != nil {
+		t.Fatalf("consumerConfig() error = %v", err)
+	}
+	if cfg.ClientID != "room-service" || cfg.Consumer.Offsets.Initial != sarama.OffsetNewest ||
+		cfg.Consumer.Offsets.CommitInterval != 500*time.Millisecond ||
+		cfg.Consumer.Group.Session.Timeout != 30*time.Second || cfg.Consumer.Group.Heartbeat.Interval != 5*time.Second {
+		t.Errorf("consumerConfig() = %+v", cfg.Consumer)
+	}
+	strategies := cfg.Consumer.Group.Rebalance.GroupStrategies
+	if len(strategies) != 2 || strategies[0].Name() != sarama.StickyBalanceStrategyName || strategies[1].Name() != sarama.RangeBalanceStrategyName {
+		t.Errorf("rebalance strategies = %v", strategies)
+	}
+	if !cfg.Net.SASL.Enable || cfg.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 || cfg.Net.SASL.SCRAMClientGeneratorFunc == nil {
+		t.Errorf("sasl = %+v", cfg.Net.SASL)
+	}
+	if !cfg.Net.TLS.Enable || cfg.Net.TLS.Config.ServerName != "kafka.example.com" {
+		t.Errorf("tls = %+v", cfg.Net.TLS)
+	}
+
+	for _, bad := range []Config{
+		{Version: "2.1.0", InitialOffset: "middle"},
+		{Version: "2.1.0", Rebalance: "random"},
+		{Version: "2.1.0", SASL: SASLConfig{Mechanism: "GSSAPI"}},
+		{Version: "2.1.0", TLS: TLSConfig{Enable: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{Version: "2.1.0", SessionTimeoutMs: 3000, HeartbeatMs: 3000},
+	} {
+		if _, err := bad.consumerConfig(); err == nil {
+			t.Errorf("consumerConfig(%+v) should fail", bad)
+		}
+	}
+}
+
+// TestScramClient RFC 7677 中 SCRAM-SHA-256 的例子
+func TestScramClient(t *testing.T) {
+	client := &scramClient{HashGeneratorFcn: scramSHA256}
+	if err := client.Begin("user", "pencil", ""); err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	//使用RFC中的客户端随机数
+	client.ClientConversation = client.Client.WithNonceGenerator(func() string { return "rOprNGfwEbeRWgbNEkqO" }).NewConversation()
+	first, _ := client.Step("")
+	if first != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Errorf("client-first = %s", first)
+	}
+	final, err := client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if final != want {
+		t.Errorf("client-final = %s, want %s", final, want)
+	}
+	if _, err := client.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil || !client.Done() {
+		t.Errorf("server-final error = %v, done = %v", err, client.Done())
+	}
+
+	//服务端签名不对时认证失败
+	bad := &scramClient{HashGeneratorFcn: scramSHA256}
+	_ = bad.Begin("user", "pencil", "")
+	bad.ClientConversation = bad.Client.WithNonceGenerator(func() string { return "rOprNGfwEbeRWgbNEkqO" }).NewConversation()
+	_, _ = bad.Step("")
+	_, _ = bad.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if _, err := bad.Step("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err == nil {
+		t.Errorf("server-final with bad signature error = nil")
+	}
+}
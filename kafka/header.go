@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/util/gconv"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/olaola-chat/slp-library/i18n"
+	context2 "github.com/olaola-chat/slp-library/server/http/context"
+	"github.com/olaola-chat/slp-library/tracer/wrap"
+)
+
+// 消息头，链路追踪的头由tracer决定，jaeger是 uber-trace-id
+const (
+	HeaderTraceID     = "trace-id"
+	HeaderUID         = "uid"
+	HeaderLanguage    = "language"
+	HeaderContentType = "content-type"
+)
+
+// 消息内容的格式
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// headerCarrier 把sarama的消息头适配成 opentracing.TextMapWriter/TextMapReader
+type headerCarrier struct {
+	headers *[]sarama.RecordHeader
+}
+
+// Set 实现 opentracing.TextMapWriter
+func (c headerCarrier) Set(key, val string) {
+	setHeader(c.headers, key, val)
+}
+
+// ForeachKey 实现 opentracing.TextMapReader
+func (c headerCarrier) ForeachKey(handler func(key, val string) error) error {
+	for _, h := range *c.headers {
+		if err := handler(string(h.Key), string(h.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setHeader 设置消息头，已经存在的覆盖
+func setHeader(headers *[]sarama.RecordHeader, key, value string) {
+	for i := range *headers {
+		if strings.EqualFold(string((*headers)[i].Key), key) {
+			(*headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*headers = append(*headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Header 读取消费消息的头，不存在返回空字符串
+func Header(msg *sarama.ConsumerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if h != nil && strings.EqualFold(string(h.Key), key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// injectHeaders 把ctx中的链路、TraceId、UID和语言写入消息头，返回发送的span，没有链路时为nil
+func injectHeaders(ctx context.Context, msg *sarama.ProducerMessage) opentracing.Span {
+	span, _ := wrap.StartOpentracingSpan(ctx, "Kafka Send "+msg.Topic)
+	if span != nil {
+		ext.SpanKindProducer.Set(span)
+		ext.MessageBusDestination.Set(span, msg.Topic)
+		err := span.Tracer().Inject(span.Context(), opentracing.TextMap, headerCarrier{headers: &msg.Headers})
+		if err != nil {
+			span.SetTag("error", err.Error())
+		}
+	}
+	if traceID, ok := ctx.Value(wrap.TrackKey).(string); ok && traceID != "" {
+		setHeader(&msg.Headers, HeaderTraceID, traceID)
+	}
+	if user := context2.ContextSrv.GetUserCtx(ctx); user != nil {
+		if user.UID > 0 {
+			setHeader(&msg.Headers, HeaderUID, gconv.String(user.UID))
+		}
+		if user.Language != "" {
+			setHeader(&msg.Headers, HeaderLanguage, user.Language)
+		}
+	}
+	return span
+}
+
+// ContextFromMessage 从消息头还原链路、TraceId、UID和语言，放到handler的ctx中
+// 之后使用这个ctx的redis、sql等调用会加入发送方的链路，返回的span需要在处理完成后Finish，可能为nil
+func ContextFromMessage(ctx context.Context, msg *sarama.ConsumerMessage) (context.Context, opentracing.Span) {
+	var span opentracing.Span
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers = append(headers, *h)
+		}
+	}
+	tracer := opentracing.GlobalTracer()
+	if parent, err := tracer.Extract(opentracing.TextMap, headerCarrier{headers: &headers}); err == nil {
+		span = tracer.StartSpan("Kafka Receive "+msg.Topic, opentracing.FollowsFrom(parent), ext.SpanKindConsumer)
+		ext.MessageBusDestination.Set(span, msg.Topic)
+		span.SetTag("partition", msg.Partition)
+		span.SetTag("offset", msg.Offset)
+		ctx = opentracing.ContextWithSpan(ctx, span)
+		ctx = context.WithValue(ctx, wrap.TraceingEnabled, true)
+	}
+
+	traceID := Header(msg, HeaderTraceID)
+	if span != nil {
+		if sc, ok := span.Context().(jaeger.SpanContext); ok {
+			traceID = sc.TraceID().String()
+		}
+	}
+	if traceID != "" {
+		ctx = context.WithValue(ctx, wrap.TrackKey, traceID)
+	}
+
+	uid, language := gconv.Uint32(Header(msg, HeaderUID)), Header(msg, HeaderLanguage)
+	if uid > 0 || language != "" {
+		user := &context2.ContextUser{UID: uid, Language: language}
+		if language != "" {
+			user.Languages = []string{language}
+		}
+		ctx = context.WithValue(ctx, context2.ContextUserKey, user)
+		n := i18n.NewI18n()
+		n.SetLanguage(language)
+		ctx = context.WithValue(ctx, context2.ContextI18nKey, n)
+	}
+	return ctx, span
+}
+
+// Unmarshal 按消息头 content-type 解码消息，没有 content-type 时按json解码
+func Unmarshal(msg *sarama.ConsumerMessage, value interface{}) error {
+	switch contentType := Header(msg, HeaderContentType); contentType {
+	case ContentTypeProtobuf:
+		m, ok := value.(proto.Message)
+		if !ok {
+			return gerror.Newf("kafka message %s is protobuf, %T is not proto.Message", msg.Topic, value)
+		}
+		return proto.Unmarshal(msg.Value, m)
+	case ContentTypeJSON, "":
+		return json.Unmarshal(msg.Value, value)
+	default:
+		return gerror.Newf("kafka message %s unsupported content-type %s", msg.Topic, contentType)
+	}
+}
+
+// SendCtx 发送消息并等待broker确认，ctx中的链路、UID和语言会写入消息头
+func (serv *Client) SendCtx(ctx context.Context, topic string, value sarama.Encoder, key ...interface{}) (int32, int64, error) {
+	message := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: value,
+	}
+	if len(key) > 0 {
+		message.Key = sarama.StringEncoder(gconv.String(key[0]))
+	}
+	return serv.SendFuture(ctx, message).Get()
+}
+
+// SendJSON 按json编码后发送，消息头 content-type 为 application/json
+func (serv *Client) SendJSON(ctx context.Context, topic string, value interface{}, key ...interface{}) (int32, int64, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, 0, gerror.Wrapf(err, "kafka marshal %T error", value)
+	}
+	return serv.sendEncoded(ctx, topic, data, ContentTypeJSON, key...)
+}
+
+// SendProto 按protobuf编码后发送，消息头 content-type 为 application/x-protobuf
+func (serv *Client) SendProto(ctx context.Context, topic string, value proto.Message, key ...interface{}) (int32, int64, error) {
+	data, err := proto.Marshal(value)
+	if err != nil {
+		return 0, 0, gerror.Wrapf(err, "kafka marshal %T error", value)
+	}
+	return serv.sendEncoded(ctx, topic, data, ContentTypeProtobuf, key...)
+}
+
+func (serv *Client) sendEncoded(ctx context.Context, topic string, data []byte, contentType string, key ...interface{}) (int32, int64, error) {
+	message := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(data),
+		Headers: []sarama.RecordHeader{{Key: []byte(HeaderContentType), Value: []byte(contentType)}},
+	}
+	if len(key) > 0 {
+		message.Key = sarama.StringEncoder(gconv.String(key[0]))
+	}
+	return serv.SendFuture(ctx, message).Get()
+}
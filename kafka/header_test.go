@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/olaola-chat/slp-library/i18n"
+	context2 "github.com/olaola-chat/slp-library/server/http/context"
+	"github.com/olaola-chat/slp-library/tracer/wrap"
+)
+
+func toConsumerMessage(msg *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	value, _ := msg.Value.Encode()
+	res := &sarama.ConsumerMessage{Topic: msg.Topic, Value: value}
+	for i := range msg.Headers {
+		res.Headers = append(res.Headers, &msg.Headers[i])
+	}
+	return res
+}
+
+func TestHeadersPropagation(t *testing.T) {
+	tracer := mocktracer.New()
+	old := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(old)
+
+	root := tracer.StartSpan("http")
+	ctx := opentracing.ContextWithSpan(context.Background(), root)
+	ctx = context.WithValue(ctx, wrap.TraceingEnabled, true)
+	ctx = context.WithValue(ctx, wrap.TrackKey, "abc123")
+	ctx = context.WithValue(ctx, context2.ContextUserKey, &context2.ContextUser{UID: 42, Language: "ar"})
+
+	client, producer := newMockClient(t, 0)
+	producer.ExpectInputAndSucceed()
+	var sent *sarama.ProducerMessage
+	err := client.Produce(ctx, &sarama.ProducerMessage{Topic: "topic", Value: sarama.StringEncoder("v")}, func(msg *sarama.ProducerMessage, err error) {
+		sent = msg
+	})
+	if err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+	_ = client.Close()
+	root.Finish()
+
+	msg := toConsumerMessage(sent)
+	if Header(msg, HeaderUID) != "42" || Header(msg, HeaderLanguage) != "ar" || Header(msg, HeaderTraceID) != "abc123" {
+		t.Fatalf("headers = %v", sent.Headers)
+	}
+
+	consumeCtx, span := ContextFromMessage(context.Background(), msg)
+	if span == nil {
+		t.Fatalf("ContextFromMessage() span is nil")
+	}
+	span.Finish()
+	sendSpan := tracer.FinishedSpans()[0]
+	receiveSpan := span.(*mocktracer.MockSpan)
+	if sendSpan.OperationName != "Kafka Send topic" || receiveSpan.ParentID != sendSpan.SpanContext.SpanID ||
+		receiveSpan.SpanContext.TraceID != root.(*mocktracer.MockSpan).SpanContext.TraceID {
+		t.Errorf("spans not linked, send = %+v, receive = %+v", sendSpan, receiveSpan)
+	}
+	if !wrap.GetOpentracingEnabled(consumeCtx) || opentracing.SpanFromContext(consumeCtx) != span {
+		t.Errorf("consume ctx has no span")
+	}
+	user := context2.ContextSrv.GetUserCtx(consumeCtx)
+	if user == nil || user.UID != 42 || user.Language != "ar" {
+		t.Errorf("consume ctx user = %+v", user)
+	}
+	if n, ok := consumeCtx.Value(context2.ContextI18nKey).(*i18n.I18n); !ok || n.GetLanguage() == "" {
+		t.Errorf("consume ctx has no i18n")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	data, _ := proto.Marshal(wrapperspb.String("hello"))
+	msg := &sarama.ConsumerMessage{
+		Value:   data,
+		Headers: []*sarama.RecordHeader{{Key: []byte(HeaderContentType), Value: []byte(ContentTypeProtobuf)}},
+	}
+	pb := &wrapperspb.StringValue{}
+	if err := Unmarshal(msg, pb); err != nil || pb.Value != "hello" {
+		t.Errorf("Unmarshal() protobuf = %v, %v", pb, err)
+	}
+	var m map[string]int
+	if err := Unmarshal(msg, &m); err == nil {
+		t.Errorf("Unmarshal() protobuf into map should fail")
+	}
+
+	msg = &sarama.ConsumerMessage{Value: []byte(`{"a":1}`)}
+	if err := Unmarshal(msg, &m); err != nil || m["a"] != 1 {
+		t.Errorf("Unmarshal() json = %v, %v", m, err)
+	}
+}
@@ -0,0 +1,296 @@
+// Package kafkatest 内存中的kafka，用于测试 kafka.Client 和 kafka.Worker，不需要真实的集群
+//
+//	broker := kafkatest.NewBroker()
+//	worker := broker.NewWorker(&kafka.ConsumerConf{GroupName: "group", Topics: []string{"topic"}}, handler)
+//	stop := broker.Run(worker)
+//	defer stop()
+//	broker.Publish("topic", "key", "value")
+//	broker.WaitIdle(t, "group", time.Second)
+//	broker.Committed("group", "topic", 0)
+package kafkatest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+
+	"github.com/olaola-chat/slp-library/kafka"
+)
+
+// Record 写入broker的一条消息
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []sarama.RecordHeader
+	Timestamp time.Time
+}
+
+// Header 取消息头，不存在时返回空字符串
+func (r *Record) Header(key string) string {
+	for _, h := range r.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// consumerMessage 转换成消费者收到的消息
+func (r *Record) consumerMessage() *sarama.ConsumerMessage {
+	msg := &sarama.ConsumerMessage{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		Key:       r.Key,
+		Value:     r.Value,
+		Timestamp: r.Timestamp,
+	}
+	for i := range r.Headers {
+		h := r.Headers[i]
+		msg.Headers = append(msg.Headers, &h)
+	}
+	return msg
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// Broker 内存中的topic、分区和消费组offset，并发安全
+type Broker struct {
+	// Partitions 自动创建topic时的分区数，默认1
+	Partitions int
+
+	mu        sync.Mutex
+	topics    map[string][][]*Record
+	committed map[string]map[topicPartition]int64 //group => 下一条要消费的offset
+	changed   chan struct{}                       //有新消息或者提交offset时关闭并替换
+}
+
+// NewBroker 创建一个空的broker
+func NewBroker() *Broker {
+	return &Broker{
+		Partitions: 1,
+		topics:     make(map[string][][]*Record),
+		committed:  make(map[string]map[topicPartition]int64),
+		changed:    make(chan struct{}),
+	}
+}
+
+// CreateTopic 创建指定分区数的topic，已经存在时只增加分区
+func (b *Broker) CreateTopic(topic string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.topics[topic]) < partitions {
+		b.topics[topic] = append(b.topics[topic], nil)
+	}
+}
+
+// partitions 返回topic的分区，不存在时自动创建，需要持有锁
+func (b *Broker) partitions(topic string) [][]*Record {
+	if _, ok := b.topics[topic]; !ok {
+		n := b.Partitions
+		if n < 1 {
+			n = 1
+		}
+		b.topics[topic] = make([][]*Record, n)
+	}
+	return b.topics[topic]
+}
+
+// notify 唤醒等待的消费者，需要持有锁
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// produce 写入一条消息，分区和 sarama 默认的一样按key哈希，没有key时随机
+func (b *Broker) produce(msg *sarama.ProducerMessage) (*Record, error) {
+	record := &Record{Topic: msg.Topic, Timestamp: msg.Timestamp, Headers: append([]sarama.RecordHeader{}, msg.Headers...)}
+	var err error
+	if msg.Key != nil {
+		if record.Key, err = msg.Key.Encode(); err != nil {
+			return nil, gerror.Wrap(err, "kafkatest encode key error")
+		}
+	}
+	if msg.Value != nil {
+		if record.Value, err = msg.Value.Encode(); err != nil {
+			return nil, gerror.Wrap(err, "kafkatest encode value error")
+		}
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	partitions := b.partitions(msg.Topic)
+	partition, err := sarama.NewHashPartitioner(msg.Topic).Partition(msg, int32(len(partitions)))
+	if err != nil {
+		return nil, err
+	}
+	record.Partition = partition
+	record.Offset = int64(len(partitions[partition]))
+	partitions[partition] = append(partitions[partition], record)
+	b.notify()
+	return record, nil
+}
+
+// Publish 写入一条消息，key 为空时随机分区
+func (b *Broker) Publish(topic, key, value string, headers ...sarama.RecordHeader) *Record {
+	msg := &sarama.ProducerMessage{Topic: topic, Value: sarama.StringEncoder(value), Headers: headers}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	record, err := b.produce(msg)
+	if err != nil {
+		panic(err)
+	}
+	return record
+}
+
+// Records 按分区、offset排序的所有消息
+func (b *Broker) Records(topic string) []*Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []*Record
+	for _, records := range b.topics[topic] {
+		res = append(res, records...)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Partition != res[j].Partition {
+			return res[i].Partition < res[j].Partition
+		}
+		return res[i].Offset < res[j].Offset
+	})
+	return res
+}
+
+// HighWater 分区下一条写入的offset
+func (b *Broker) HighWater(topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	partitions := b.topics[topic]
+	if int(partition) >= len(partitions) {
+		return 0
+	}
+	return int64(len(partitions[partition]))
+}
+
+// Committed 消费组提交的下一条要消费的offset，没有提交过时返回-1
+func (b *Broker) Committed(group, topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	offset, ok := b.committed[group][topicPartition{topic: topic, partition: partition}]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+// commit 提交offset，需要持有锁
+func (b *Broker) commit(group, topic string, partition int32, offset int64) {
+	offsets, ok := b.committed[group]
+	if !ok {
+		offsets = make(map[topicPartition]int64)
+		b.committed[group] = offsets
+	}
+	offsets[topicPartition{topic: topic, partition: partition}] = offset
+	b.notify()
+}
+
+// idle 消费组在 topics 的所有分区都已经提交到最新
+func (b *Broker) idle(group string, topics []string) (bool, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, topic := range topics {
+		for partition, records := range b.topics[topic] {
+			if len(records) == 0 {
+				continue
+			}
+			offset := b.committed[group][topicPartition{topic: topic, partition: int32(partition)}]
+			if offset < int64(len(records)) {
+				return false, b.changed
+			}
+		}
+	}
+	return true, b.changed
+}
+
+// WaitIdle 等待消费组把 topics 中已有的消息都处理完并提交，topics 为空时使用所有topic，超时测试失败
+func (b *Broker) WaitIdle(t testing.TB, group string, timeout time.Duration, topics ...string) {
+	t.Helper()
+	if err := b.WaitIdleCtx(context.Background(), group, timeout, topics...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// WaitIdleCtx 同 WaitIdle，超时返回错误
+func (b *Broker) WaitIdleCtx(ctx context.Context, group string, timeout time.Duration, topics ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if len(topics) == 0 {
+		b.mu.Lock()
+		for topic := range b.topics {
+			topics = append(topics, topic)
+		}
+		b.mu.Unlock()
+	}
+	for {
+		ok, changed := b.idle(group, topics)
+		if ok {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return gerror.Newf("kafkatest group %s not idle on %v after %v", group, topics, timeout)
+		}
+	}
+}
+
+// NewClient 创建一个写入broker的客户端，用完需要 Close
+func (b *Broker) NewClient() *kafka.Client {
+	return kafka.NewClientWithProducer(&kafka.Config{}, newProducer(b))
+}
+
+// NewWorker 创建一个从broker消费的worker，同一个消费组同时只能运行一个worker
+// 有重试策略时重试和死信消息也写入broker
+func (b *Broker) NewWorker(cfg *kafka.ConsumerConf, handler kafka.ReceiveCtxFunc) *kafka.Worker {
+	worker := kafka.NewWorkerWithGroup(cfg, newGroup(b, cfg.GroupName), handler)
+	if cfg.Retry != nil {
+		worker.SetRetryClient(b.NewClient())
+	}
+	return worker
+}
+
+// NewBatchWorker 创建一个从broker批量消费的worker，见 NewWorker
+func (b *Broker) NewBatchWorker(cfg *kafka.ConsumerConf, handler kafka.ReceiveBatchFunc) *kafka.Worker {
+	worker := kafka.NewBatchWorkerWithGroup(cfg, newGroup(b, cfg.GroupName), handler)
+	if cfg.Retry != nil {
+		worker.SetRetryClient(b.NewClient())
+	}
+	return worker
+}
+
+// Run 在后台运行worker，返回的函数停止worker并返回 Run 的错误
+func (b *Broker) Run(worker *kafka.Worker) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- worker.Run(ctx)
+	}()
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
@@ -0,0 +1,152 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/olaola-chat/slp-library/kafka"
+	"github.com/olaola-chat/slp-library/tracer/wrap"
+)
+
+func TestClientProduce(t *testing.T) {
+	broker := NewBroker()
+	broker.CreateTopic("events", 4)
+	client := broker.NewClient()
+	defer client.Close()
+
+	ctx := context.WithValue(context.Background(), wrap.TrackKey, "trace-1")
+	partition, offset, err := client.SendJSON(ctx, "events", map[string]int{"id": 1}, "room-1")
+	if err != nil {
+		t.Fatalf("SendJSON() error = %v", err)
+	}
+	records := broker.Records("events")
+	if len(records) != 1 || records[0].Partition != partition || records[0].Offset != offset {
+		t.Fatalf("records = %+v", records)
+	}
+	record := records[0]
+	if string(record.Key) != "room-1" || string(record.Value) != `{"id":1}` ||
+		record.Header(kafka.HeaderTraceID) != "trace-1" || record.Header(kafka.HeaderContentType) != kafka.ContentTypeJSON {
+		t.Errorf("record = %+v", record)
+	}
+
+	//同一个key写入同一个分区
+	again := broker.Publish("events", "room-1", "v")
+	if again.Partition != partition || again.Offset != offset+1 {
+		t.Errorf("Publish() = %+v, want partition %d offset %d", again, partition, offset+1)
+	}
+}
+
+func TestWorkerConsume(t *testing.T) {
+	broker := NewBroker()
+	broker.CreateTopic("orders", 2)
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]string)
+	)
+	cfg := &kafka.ConsumerConf{GroupName: "group", Topics: []string{"orders"}}
+	worker := broker.NewWorker(cfg, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		traceID, _ := ctx.Value(wrap.TrackKey).(string)
+		mu.Lock()
+		seen[string(msg.Value)] = traceID
+		mu.Unlock()
+		return nil
+	})
+	stop := broker.Run(worker)
+
+	trace := sarama.RecordHeader{Key: []byte(kafka.HeaderTraceID), Value: []byte("trace-2")}
+	broker.Publish("orders", "a", "1", trace)
+	broker.Publish("orders", "b", "2")
+	broker.Publish("orders", "c", "3")
+	broker.WaitIdle(t, "group", time.Second)
+	if err := stop(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(seen) != 3 || seen["1"] != "trace-2" {
+		t.Errorf("seen = %v", seen)
+	}
+	var total int64
+	for partition := int32(0); partition < 2; partition++ {
+		if committed, high := broker.Committed("group", "orders", partition), broker.HighWater("orders", partition); high > 0 && committed != high {
+			t.Errorf("partition %d committed = %d, want %d", partition, committed, high)
+		}
+		total += broker.HighWater("orders", partition)
+	}
+	if total != 3 {
+		t.Errorf("total = %d, want 3", total)
+	}
+
+	//重新启动后从提交的位置继续
+	again := broker.NewWorker(cfg, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		mu.Lock()
+		seen["again-"+string(msg.Value)] = ""
+		mu.Unlock()
+		return nil
+	})
+	stop = broker.Run(again)
+	broker.Publish("orders", "d", "4")
+	broker.WaitIdle(t, "group", time.Second)
+	_ = stop()
+	if _, ok := seen["again-4"]; !ok || len(seen) != 4 {
+		t.Errorf("seen = %v", seen)
+	}
+}
+
+func TestWorkerDeadLetter(t *testing.T) {
+	broker := NewBroker()
+	cfg := &kafka.ConsumerConf{
+		GroupName: "group",
+		Topics:    []string{"orders"},
+		Retry:     &kafka.RetryPolicy{Attempts: 1, Backoff: time.Millisecond},
+	}
+	worker := broker.NewWorker(cfg, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errors.New("poison")
+	})
+	stop := broker.Run(worker)
+	broker.Publish("orders", "a", "1")
+	broker.WaitIdle(t, "group", time.Second, "orders")
+	_ = stop()
+
+	dead := broker.Records("group.dlq")
+	if len(dead) != 1 || dead[0].Header(kafka.HeaderOriginalTopic) != "orders" || dead[0].Header(kafka.HeaderError) != "poison" {
+		t.Errorf("dead letters = %+v", dead)
+	}
+}
+
+func TestBatchWorker(t *testing.T) {
+	broker := NewBroker()
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	cfg := &kafka.ConsumerConf{GroupName: "stats", Topics: []string{"clicks"}, BatchSize: 10, BatchWindow: 20 * time.Millisecond}
+	worker := broker.NewBatchWorker(cfg, func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		values := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			values = append(values, string(msg.Value))
+		}
+		mu.Lock()
+		batches = append(batches, values)
+		mu.Unlock()
+		return nil
+	})
+	stop := broker.Run(worker)
+	for _, v := range []string{"1", "2", "3"} {
+		broker.Publish("clicks", "", v)
+	}
+	//不够一批时等待 BatchWindow 后提交
+	broker.WaitIdle(t, "stats", time.Second)
+	_ = stop()
+	total := 0
+	for _, batch := range batches {
+		total += len(batch)
+	}
+	if total != 3 || broker.Committed("stats", "clicks", 0) != 3 {
+		t.Errorf("batches = %v, committed = %d", batches, broker.Committed("stats", "clicks", 0))
+	}
+}
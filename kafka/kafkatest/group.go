@@ -0,0 +1,205 @@
+package kafkatest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// group 从broker消费的消费组，实现 sarama.ConsumerGroup
+// 只有一个成员，订阅的topic的所有分区都分配给它，MarkOffset 立即提交
+type group struct {
+	broker     *Broker
+	name       string
+	errors     chan error
+	mu         sync.Mutex
+	closed     bool
+	generation int32
+}
+
+func newGroup(broker *Broker, name string) *group {
+	return &group{broker: broker, name: name, errors: make(chan error, 16)}
+}
+
+// Consume 一次会话，直到 ctx 结束或者任何一个分区的处理返回
+func (g *group) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return sarama.ErrClosedConsumerGroup
+	}
+	g.generation++
+	generation := g.generation
+	g.mu.Unlock()
+	if len(topics) == 0 {
+		return sarama.ConfigurationError("no topics provided")
+	}
+
+	claims := make(map[string][]int32, len(topics))
+	g.broker.mu.Lock()
+	for _, topic := range topics {
+		for partition := range g.broker.partitions(topic) {
+			claims[topic] = append(claims[topic], int32(partition))
+		}
+	}
+	g.broker.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sess := &session{group: g, ctx: ctx, claims: claims, generation: generation}
+	if err := handler.Setup(sess); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			c := newClaim(g.broker, topic, partition, g.broker.Committed(g.name, topic, partition))
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				c.feed(ctx)
+			}()
+			go func() {
+				defer wg.Done()
+				err := handler.ConsumeClaim(sess, c)
+				if err != nil {
+					g.handleError(err)
+				}
+				//和 sarama 一样，任何一个分区处理结束会话就结束
+				cancel()
+				c.drain()
+			}()
+		}
+	}
+	<-ctx.Done()
+	wg.Wait()
+	return handler.Cleanup(sess)
+}
+
+func (g *group) handleError(err error) {
+	select {
+	case g.errors <- err:
+	default:
+	}
+}
+
+func (g *group) Errors() <-chan error {
+	return g.errors
+}
+
+func (g *group) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return sarama.ErrClosedConsumerGroup
+	}
+	g.closed = true
+	close(g.errors)
+	return nil
+}
+
+func (g *group) Pause(partitions map[string][]int32)  {}
+func (g *group) Resume(partitions map[string][]int32) {}
+func (g *group) PauseAll()                            {}
+func (g *group) ResumeAll()                           {}
+
+// session 实现 sarama.ConsumerGroupSession
+type session struct {
+	group      *group
+	ctx        context.Context
+	claims     map[string][]int32
+	generation int32
+}
+
+func (s *session) Claims() map[string][]int32 { return s.claims }
+func (s *session) MemberID() string           { return "kafkatest-" + s.group.name }
+func (s *session) GenerationID() int32        { return s.generation }
+func (s *session) Context() context.Context   { return s.ctx }
+func (s *session) Commit()                    {}
+
+func (s *session) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	b := s.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if offset > b.committed[s.group.name][topicPartition{topic: topic, partition: partition}] {
+		b.commit(s.group.name, topic, partition, offset)
+	}
+}
+
+func (s *session) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	b := s.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commit(s.group.name, topic, partition, offset)
+}
+
+func (s *session) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// claim 实现 sarama.ConsumerGroupClaim，从提交的位置开始按顺序投递分区中的消息
+type claim struct {
+	broker    *Broker
+	topic     string
+	partition int32
+	initial   int64
+	messages  chan *sarama.ConsumerMessage
+}
+
+func newClaim(broker *Broker, topic string, partition int32, committed int64) *claim {
+	if committed < 0 {
+		committed = 0
+	}
+	return &claim{
+		broker:    broker,
+		topic:     topic,
+		partition: partition,
+		initial:   committed,
+		messages:  make(chan *sarama.ConsumerMessage),
+	}
+}
+
+func (c *claim) Topic() string                            { return c.topic }
+func (c *claim) Partition() int32                         { return c.partition }
+func (c *claim) InitialOffset() int64                     { return c.initial }
+func (c *claim) HighWaterMarkOffset() int64               { return c.broker.HighWater(c.topic, c.partition) }
+func (c *claim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// feed 投递消息直到 ctx 结束，结束时关闭 Messages
+func (c *claim) feed(ctx context.Context) {
+	defer close(c.messages)
+	next := c.initial
+	for {
+		c.broker.mu.Lock()
+		records := c.broker.topics[c.topic][c.partition]
+		var record *Record
+		if next < int64(len(records)) {
+			record = records[next]
+		}
+		changed := c.broker.changed
+		c.broker.mu.Unlock()
+
+		if record == nil {
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case c.messages <- record.consumerMessage():
+			next++
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drain ConsumeClaim 提前返回时丢弃剩下的消息，让 feed 结束
+func (c *claim) drain() {
+	for range c.messages {
+	}
+}
@@ -0,0 +1,82 @@
+package kafkatest
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// errNoTransaction 内存broker不支持事务
+var errNoTransaction = gerror.New("kafkatest does not support transactions")
+
+// producer 写入broker的异步生产者，实现 sarama.AsyncProducer
+type producer struct {
+	broker    *Broker
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newProducer(broker *Broker) *producer {
+	p := &producer{
+		broker:    broker,
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage, 256),
+		errors:    make(chan *sarama.ProducerError, 256),
+		done:      make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+func (p *producer) loop() {
+	defer func() {
+		close(p.successes)
+		close(p.errors)
+		close(p.done)
+	}()
+	for msg := range p.input {
+		record, err := p.broker.produce(msg)
+		if err != nil {
+			p.errors <- &sarama.ProducerError{Msg: msg, Err: err}
+			continue
+		}
+		msg.Partition, msg.Offset = record.Partition, record.Offset
+		p.successes <- msg
+	}
+}
+
+func (p *producer) AsyncClose() {
+	p.closeOnce.Do(func() {
+		close(p.input)
+	})
+}
+
+func (p *producer) Close() error {
+	p.AsyncClose()
+	<-p.done
+	return nil
+}
+
+func (p *producer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *producer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *producer) Errors() <-chan *sarama.ProducerError      { return p.errors }
+
+func (p *producer) IsTransactional() bool { return false }
+
+func (p *producer) TxnStatus() sarama.ProducerTxnStatusFlag { return sarama.ProducerTxnFlagReady }
+
+func (p *producer) BeginTxn() error  { return errNoTransaction }
+func (p *producer) CommitTxn() error { return errNoTransaction }
+func (p *producer) AbortTxn() error  { return errNoTransaction }
+
+func (p *producer) AddOffsetsToTxn(offsets map[string][]*sarama.PartitionOffsetMetadata, groupID string) error {
+	return errNoTransaction
+}
+
+func (p *producer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupID string, metadata *string) error {
+	return errNoTransaction
+}
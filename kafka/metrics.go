@@ -0,0 +1,285 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/rcrowley/go-metrics"
+)
+
+// lagRefreshInterval 主动查询分区最新offset的间隔，回调卡住时 claim 中的高水位不会更新
+const lagRefreshInterval = 10 * time.Second
+
+// PartitionStats 分区的消费统计
+type PartitionStats struct {
+	Group      string
+	Topic      string
+	Partition  int32
+	Active     bool          //是否还分配在当前进程
+	Consumed   int64         //回调次数，包括失败和重试
+	Failed     int64         //回调返回错误的次数
+	Rate1      float64       //最近一分钟每秒回调次数
+	ErrorRate1 float64       //最近一分钟失败比例
+	Offset     int64         //已提交的下一条offset，-1 表示还没有消费
+	HighWater  int64         //分区的高水位，即下一条写入的offset
+	Lag        int64         //积压的消息数
+	LatencyP50 time.Duration //回调耗时
+	LatencyP99 time.Duration
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// partitionMetrics 单个分区的统计，consumed、failed、latency 注册到 registry，重新分配后继续累加
+type partitionMetrics struct {
+	prefix    string
+	consumed  metrics.Meter
+	failed    metrics.Meter
+	latency   metrics.Timer
+	offset    int64 //atomic，已提交的下一条offset
+	highWater int64 //atomic
+	active    int32 //atomic
+}
+
+func (p *partitionMetrics) lag() int64 {
+	offset, high := atomic.LoadInt64(&p.offset), atomic.LoadInt64(&p.highWater)
+	if offset < 0 || high <= offset {
+		return 0
+	}
+	return high - offset
+}
+
+// updateHighWater 高水位只增不减
+func (p *partitionMetrics) updateHighWater(high int64) {
+	for {
+		old := atomic.LoadInt64(&p.highWater)
+		if high <= old || atomic.CompareAndSwapInt64(&p.highWater, old, high) {
+			return
+		}
+	}
+}
+
+// consumerMetrics 一个消费组的统计，同一进程中同组的多个 Worker 共用，分区不会重叠
+// 方法允许 nil，直接构造的 Consumer 不统计
+type consumerMetrics struct {
+	group        string
+	registry     metrics.Registry
+	maxLag       int64
+	maxErrorRate float64
+
+	mu         sync.RWMutex
+	partitions map[topicPartition]*partitionMetrics
+}
+
+var (
+	groupMetricsMu sync.Mutex
+	groupMetrics   = make(map[string]*consumerMetrics)
+)
+
+// metricsOf 取消费组的统计，第一次使用时注册健康检查 kafka.consumer.<group>.health
+func metricsOf(cfg *ConsumerConf) *consumerMetrics {
+	groupMetricsMu.Lock()
+	defer groupMetricsMu.Unlock()
+	if m, ok := groupMetrics[cfg.GroupName]; ok {
+		return m
+	}
+	m := newConsumerMetrics(metrics.DefaultRegistry, cfg)
+	groupMetrics[cfg.GroupName] = m
+	return m
+}
+
+func newConsumerMetrics(registry metrics.Registry, cfg *ConsumerConf) *consumerMetrics {
+	m := &consumerMetrics{
+		group:        cfg.GroupName,
+		registry:     registry,
+		maxLag:       cfg.MaxLag,
+		maxErrorRate: cfg.MaxErrorRate,
+		partitions:   make(map[topicPartition]*partitionMetrics),
+	}
+	_ = registry.Register(m.name("health"), metrics.NewHealthcheck(func(h metrics.Healthcheck) {
+		if err := m.check(); err != nil {
+			h.Unhealthy(err)
+			return
+		}
+		h.Healthy()
+	}))
+	return m
+}
+
+func (m *consumerMetrics) name(parts ...string) string {
+	return "kafka.consumer." + m.group + "." + strings.Join(parts, ".")
+}
+
+// partition 取分区的统计，不存在时创建
+func (m *consumerMetrics) partition(topic string, partition int32) *partitionMetrics {
+	key := topicPartition{topic: topic, partition: partition}
+	m.mu.RLock()
+	p, ok := m.partitions[key]
+	m.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok = m.partitions[key]; ok {
+		return p
+	}
+	prefix := m.name(topic, fmt.Sprint(partition))
+	p = &partitionMetrics{
+		prefix:   prefix,
+		consumed: metrics.GetOrRegisterMeter(prefix+".consumed", m.registry),
+		failed:   metrics.GetOrRegisterMeter(prefix+".failed", m.registry),
+		latency:  metrics.GetOrRegisterTimer(prefix+".latency", m.registry),
+		offset:   -1,
+	}
+	m.partitions[key] = p
+	return p
+}
+
+// claim 分区分配到当前进程，开始统计积压
+func (m *consumerMetrics) claim(claim sarama.ConsumerGroupClaim) *partitionMetrics {
+	if m == nil {
+		return nil
+	}
+	p := m.partition(claim.Topic(), claim.Partition())
+	if offset := claim.InitialOffset(); offset >= 0 {
+		atomic.StoreInt64(&p.offset, offset)
+	}
+	p.updateHighWater(claim.HighWaterMarkOffset())
+	if atomic.CompareAndSwapInt32(&p.active, 0, 1) {
+		_ = m.registry.Register(p.prefix+".lag", metrics.NewFunctionalGauge(p.lag))
+	}
+	return p
+}
+
+// release 分区被回收，不再统计积压
+func (m *consumerMetrics) release(p *partitionMetrics) {
+	if m == nil || p == nil {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&p.active, 1, 0) {
+		m.registry.Unregister(p.prefix + ".lag")
+	}
+}
+
+// observe 记录一次回调
+func (m *consumerMetrics) observe(msg *sarama.ConsumerMessage, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	p := m.partition(msg.Topic, msg.Partition)
+	p.consumed.Mark(1)
+	if err != nil {
+		p.failed.Mark(1)
+	}
+	p.latency.UpdateSince(start)
+	//还没有提交过时，从第一条消息开始算积压
+	atomic.CompareAndSwapInt64(&p.offset, -1, msg.Offset)
+}
+
+// mark 提交offset，offset 为下一条要消费的位置
+// 分区内并发时提交的顺序可能和offset不一致，只向前移动
+func (m *consumerMetrics) mark(topic string, partition int32, offset int64) {
+	if m == nil {
+		return
+	}
+	p := m.partition(topic, partition)
+	for {
+		old := atomic.LoadInt64(&p.offset)
+		if old >= offset || atomic.CompareAndSwapInt64(&p.offset, old, offset) {
+			return
+		}
+	}
+}
+
+// active 当前分配在进程中的分区
+func (m *consumerMetrics) active() map[topicPartition]*partitionMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make(map[topicPartition]*partitionMetrics, len(m.partitions))
+	for key, p := range m.partitions {
+		if atomic.LoadInt32(&p.active) == 1 {
+			res[key] = p
+		}
+	}
+	return res
+}
+
+// refreshHighWater 查询分配中的分区的最新offset
+func (m *consumerMetrics) refreshHighWater(client sarama.Client) {
+	for key, p := range m.active() {
+		high, err := client.GetOffset(key.topic, key.partition, sarama.OffsetNewest)
+		if err != nil {
+			continue
+		}
+		p.updateHighWater(high)
+	}
+}
+
+// check 积压或者最近一分钟的失败比例超过阈值时返回错误，阈值为0表示不检查
+func (m *consumerMetrics) check() error {
+	var (
+		problems       []string
+		consumed, fail float64
+	)
+	for key, p := range m.active() {
+		if lag := p.lag(); m.maxLag > 0 && lag > m.maxLag {
+			problems = append(problems, fmt.Sprintf("%s[%d] lag %d > %d", key.topic, key.partition, lag, m.maxLag))
+		}
+		consumed += p.consumed.Rate1()
+		fail += p.failed.Rate1()
+	}
+	if m.maxErrorRate > 0 && consumed > 0 && fail/consumed > m.maxErrorRate {
+		problems = append(problems, fmt.Sprintf("error rate %.4f > %.4f", fail/consumed, m.maxErrorRate))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return gerror.Newf("kafka group %s unhealthy: %s", m.group, strings.Join(problems, "; "))
+}
+
+// stats 所有统计过的分区，按 topic、分区排序
+func (m *consumerMetrics) stats() []PartitionStats {
+	m.mu.RLock()
+	res := make([]PartitionStats, 0, len(m.partitions))
+	for key, p := range m.partitions {
+		consumed, failed := p.consumed.Snapshot(), p.failed.Snapshot()
+		latency := p.latency.Snapshot()
+		stat := PartitionStats{
+			Group:      m.group,
+			Topic:      key.topic,
+			Partition:  key.partition,
+			Active:     atomic.LoadInt32(&p.active) == 1,
+			Consumed:   consumed.Count(),
+			Failed:     failed.Count(),
+			Rate1:      consumed.Rate1(),
+			Offset:     atomic.LoadInt64(&p.offset),
+			HighWater:  atomic.LoadInt64(&p.highWater),
+			Lag:        p.lag(),
+			LatencyP50: time.Duration(latency.Percentile(0.5)),
+			LatencyP99: time.Duration(latency.Percentile(0.99)),
+		}
+		if stat.Rate1 > 0 {
+			stat.ErrorRate1 = failed.Rate1() / stat.Rate1
+		}
+		res = append(res, stat)
+	}
+	m.mu.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Topic != res[j].Topic {
+			return res[i].Topic < res[j].Topic
+		}
+		return res[i].Partition < res[j].Partition
+	})
+	return res
+}
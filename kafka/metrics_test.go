@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestConsumerMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := newConsumerMetrics(registry, &ConsumerConf{GroupName: "group", MaxLag: 5})
+	failed := errors.New("failed")
+	consumer := Consumer{
+		metrics: m,
+		CtxHandler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			if msg.Offset == 2 {
+				return failed
+			}
+			return nil
+		},
+	}
+	claim := newFakeClaim("a", "b", "c", "d")
+	claim.highWater = 20
+	sess := &fakeSession{}
+	if err := consumer.ConsumeClaim(sess, claim); err != failed {
+		t.Fatalf("ConsumeClaim() error = %v, want %v", err, failed)
+	}
+
+	stats := m.stats()
+	if len(stats) != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	stat := stats[0]
+	if stat.Topic != "topic" || stat.Consumed != 3 || stat.Failed != 1 || stat.Offset != 2 || stat.Lag != 18 || stat.Active {
+		t.Errorf("stats = %+v", stat)
+	}
+	if registry.Get("kafka.consumer.group.topic.0.latency") == nil {
+		t.Errorf("latency timer not registered")
+	}
+	if registry.Get("kafka.consumer.group.topic.0.lag") != nil {
+		t.Errorf("lag gauge should be unregistered after the partition is released")
+	}
+
+	//重新分配后从 InitialOffset 开始算积压，超过阈值时不健康
+	active := m.claim(claim)
+	registry.RunHealthchecks()
+	h := registry.Get("kafka.consumer.group.health").(metrics.Healthcheck)
+	if h.Error() == nil || !strings.Contains(h.Error().Error(), "topic[0] lag 20 > 5") {
+		t.Errorf("health error = %v", h.Error())
+	}
+	if lag := registry.Get("kafka.consumer.group.topic.0.lag").(metrics.Gauge).Value(); lag != 20 {
+		t.Errorf("lag gauge = %d, want 20", lag)
+	}
+	m.mark("topic", 0, 18)
+	m.mark("topic", 0, 15) //并发时较早的提交后到，不会回退
+	if offset := atomic.LoadInt64(&active.offset); offset != 18 {
+		t.Errorf("offset = %d after out of order mark, want 18", offset)
+	}
+	registry.RunHealthchecks()
+	if h.Error() != nil {
+		t.Errorf("health error = %v, want nil", h.Error())
+	}
+	m.release(active)
+}
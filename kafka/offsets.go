@@ -0,0 +1,356 @@
+package kafka
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+)
+
+// 重置offset的目标
+const (
+	ResetEarliest = "earliest"
+	ResetLatest   = "latest"
+)
+
+// PartitionLag 消费组在一个分区上的进度，Committed 为-1表示没有提交过
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Committed int64
+	HighWater int64
+	Lag       int64
+}
+
+// GroupLag 消费组的状态和每个分区的积压
+type GroupLag struct {
+	Group      string
+	State      string
+	Members    int
+	Lag        int64
+	Partitions []PartitionLag
+}
+
+// OffsetReset 重置offset的目标，To、Time、Offsets 三选一
+type OffsetReset struct {
+	To      string          //earliest 或 latest
+	Time    time.Time       //重置到这个时间之后的第一条消息
+	Offsets map[int32]int64 //指定分区的offset，没有列出的分区不变
+}
+
+// OffsetChange 一个分区重置前后的offset
+type OffsetChange struct {
+	Topic     string
+	Partition int32
+	From      int64
+	To        int64
+}
+
+// offsetAdmin 查询消费组用到的 sarama.ClusterAdmin 方法
+type offsetAdmin interface {
+	ListConsumerGroups() (map[string]string, error)
+	DescribeConsumerGroups(groups []string) ([]*sarama.GroupDescription, error)
+	ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error)
+}
+
+// offsetSource 查询分区offset用到的 sarama.Client 方法
+type offsetSource interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+}
+
+// ParseOffsetReset 解析重置目标:
+// earliest、latest、时间(RFC3339 或本地时间 2006-01-02 15:04:05)、分区:offset[,分区:offset]
+func ParseOffsetReset(s string) (*OffsetReset, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "":
+		return nil, gerror.New("kafka offset reset target is empty")
+	case ResetEarliest, "oldest":
+		return &OffsetReset{To: ResetEarliest}, nil
+	case ResetLatest, "newest":
+		return &OffsetReset{To: ResetLatest}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &OffsetReset{Time: t}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return &OffsetReset{Time: t}, nil
+	}
+
+	offsets := make(map[int32]int64)
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			return nil, gerror.Newf("kafka offset reset target %s error", s)
+		}
+		partition, err := strconv.ParseInt(parts[0], 10, 32)
+		if err != nil || partition < 0 {
+			return nil, gerror.Newf("kafka offset reset partition %s error", parts[0])
+		}
+		offset, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || offset < 0 {
+			return nil, gerror.Newf("kafka offset reset offset %s error", parts[1])
+		}
+		if _, ok := offsets[int32(partition)]; ok {
+			return nil, gerror.Newf("kafka offset reset partition %d duplicated", partition)
+		}
+		offsets[int32(partition)] = offset
+	}
+	return &OffsetReset{Offsets: offsets}, nil
+}
+
+// newAdmin 根据配置创建运维用的客户端，关闭 admin 时同时关闭 client
+func newAdmin(name string) (sarama.Client, sarama.ClusterAdmin, error) {
+	conf, err := GetConfig(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := conf.consumerConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sarama.NewClient(conf.Host, cfg)
+	if err != nil {
+		return nil, nil, gerror.Wrap(err, "kafka new client error")
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, gerror.Wrap(err, "kafka new cluster admin error")
+	}
+	return client, admin, nil
+}
+
+// ListGroups 查询消费组的状态和积压，groups 为空时查询所有消费组
+func ListGroups(name string, groups ...string) ([]*GroupLag, error) {
+	client, admin, err := newAdmin(name)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	return listGroups(admin, client, groups)
+}
+
+func listGroups(admin offsetAdmin, src offsetSource, groups []string) ([]*GroupLag, error) {
+	if len(groups) == 0 {
+		all, err := admin.ListConsumerGroups()
+		if err != nil {
+			return nil, gerror.Wrap(err, "kafka list consumer groups error")
+		}
+		for group := range all {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+	}
+	res := make([]*GroupLag, 0, len(groups))
+	for _, group := range groups {
+		lag, err := groupLag(admin, src, group)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, lag)
+	}
+	return res, nil
+}
+
+// groupLag 查询一个消费组，只包含提交过offset的topic
+func groupLag(admin offsetAdmin, src offsetSource, group string) (*GroupLag, error) {
+	desc, err := describeGroup(admin, group)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := admin.ListConsumerGroupOffsets(group, nil)
+	if err != nil {
+		return nil, gerror.Wrapf(err, "kafka list offsets of group %s error", group)
+	}
+	if offsets.Err != sarama.ErrNoError {
+		return nil, gerror.Wrapf(offsets.Err, "kafka list offsets of group %s error", group)
+	}
+
+	res := &GroupLag{Group: group, State: desc.State, Members: len(desc.Members)}
+	for topic, blocks := range offsets.Blocks {
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, gerror.Wrapf(block.Err, "kafka offset of group %s %s[%d] error", group, topic, partition)
+			}
+			high, err := src.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, gerror.Wrapf(err, "kafka high water of %s[%d] error", topic, partition)
+			}
+			p := PartitionLag{Topic: topic, Partition: partition, Committed: block.Offset, HighWater: high, Lag: high}
+			if block.Offset >= 0 {
+				p.Lag = high - block.Offset
+			}
+			if p.Lag < 0 {
+				p.Lag = 0
+			}
+			res.Lag += p.Lag
+			res.Partitions = append(res.Partitions, p)
+		}
+	}
+	sort.Slice(res.Partitions, func(i, j int) bool {
+		if res.Partitions[i].Topic != res.Partitions[j].Topic {
+			return res.Partitions[i].Topic < res.Partitions[j].Topic
+		}
+		return res.Partitions[i].Partition < res.Partitions[j].Partition
+	})
+	return res, nil
+}
+
+func describeGroup(admin offsetAdmin, group string) (*sarama.GroupDescription, error) {
+	descs, err := admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, gerror.Wrapf(err, "kafka describe group %s error", group)
+	}
+	if len(descs) != 1 {
+		return nil, gerror.Newf("kafka describe group %s returns %d groups", group, len(descs))
+	}
+	if descs[0].Err != sarama.ErrNoError {
+		return nil, gerror.Wrapf(descs[0].Err, "kafka describe group %s error", group)
+	}
+	return descs[0], nil
+}
+
+// ResetOffsets 重置消费组在 topic 上的offset，返回每个分区的变化
+// 消费组还有在线成员时拒绝执行，dryRun 时只计算不提交
+func ResetOffsets(name, group, topic string, reset *OffsetReset, dryRun bool) ([]OffsetChange, error) {
+	client, admin, err := newAdmin(name)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	changes, err := planReset(admin, client, group, topic, reset, dryRun)
+	if err != nil || dryRun || len(changes) == 0 {
+		return changes, err
+	}
+	return changes, commitOffsets(client, group, changes)
+}
+
+// planReset 计算每个分区的目标offset，超出分区现有范围的offset取边界值
+func planReset(admin offsetAdmin, src offsetSource, group, topic string, reset *OffsetReset, dryRun bool) ([]OffsetChange, error) {
+	desc, err := describeGroup(admin, group)
+	if err != nil {
+		return nil, err
+	}
+	if len(desc.Members) > 0 && !dryRun {
+		return nil, gerror.Newf("kafka group %s is %s with %d active members, stop consumers before reset", group, desc.State, len(desc.Members))
+	}
+
+	partitions, err := src.Partitions(topic)
+	if err != nil {
+		return nil, gerror.Wrapf(err, "kafka partitions of %s error", topic)
+	}
+	for partition := range reset.Offsets {
+		if !containsPartition(partitions, partition) {
+			return nil, gerror.Newf("kafka topic %s has no partition %d", topic, partition)
+		}
+	}
+	offsets, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, gerror.Wrapf(err, "kafka list offsets of group %s error", group)
+	}
+
+	var changes []OffsetChange
+	for _, partition := range partitions {
+		from := int64(-1)
+		if block := offsets.GetBlock(topic, partition); block != nil && block.Err == sarama.ErrNoError {
+			from = block.Offset
+		}
+		oldest, err := src.GetOffset(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, gerror.Wrapf(err, "kafka oldest offset of %s[%d] error", topic, partition)
+		}
+		newest, err := src.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, gerror.Wrapf(err, "kafka newest offset of %s[%d] error", topic, partition)
+		}
+
+		var to int64
+		switch {
+		case reset.To == ResetEarliest:
+			to = oldest
+		case reset.To == ResetLatest:
+			to = newest
+		case !reset.Time.IsZero():
+			to, err = src.GetOffset(topic, partition, reset.Time.UnixMilli())
+			if err != nil {
+				return nil, gerror.Wrapf(err, "kafka offset of %s[%d] at %v error", topic, partition, reset.Time)
+			}
+			//这个时间之后没有消息
+			if to < 0 {
+				to = newest
+			}
+		case reset.Offsets != nil:
+			offset, ok := reset.Offsets[partition]
+			if !ok {
+				continue
+			}
+			to = offset
+		default:
+			return nil, gerror.New("kafka offset reset target is empty")
+		}
+		if to < oldest {
+			to = oldest
+		}
+		if to > newest {
+			to = newest
+		}
+		changes = append(changes, OffsetChange{Topic: topic, Partition: partition, From: from, To: to})
+	}
+	return changes, nil
+}
+
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// commitOffsets 以消费组外部的身份提交offset，只能用于没有成员的消费组
+func commitOffsets(client sarama.Client, group string, changes []OffsetChange) error {
+	om, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		return gerror.Wrap(err, "kafka new offset manager error")
+	}
+	poms := make([]sarama.PartitionOffsetManager, 0, len(changes))
+	for _, change := range changes {
+		pom, err := om.ManagePartition(change.Topic, change.Partition)
+		if err != nil {
+			for _, pom := range poms {
+				pom.AsyncClose()
+			}
+			om.Close()
+			return gerror.Wrapf(err, "kafka manage partition %s[%d] error", change.Topic, change.Partition)
+		}
+		//ResetOffset 只能往回，MarkOffset 只能往前
+		if next, _ := pom.NextOffset(); change.To > next {
+			pom.MarkOffset(change.To, "")
+		} else {
+			pom.ResetOffset(change.To, "")
+		}
+		poms = append(poms, pom)
+	}
+	om.Commit()
+
+	var errs []string
+	for _, pom := range poms {
+		if err := pom.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := om.Close(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return gerror.Newf("kafka commit offsets of group %s error, %s", group, strings.Join(errs, "; "))
+	}
+	return nil
+}
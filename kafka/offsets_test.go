@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeOffsets 一个topic的分区范围和消费组提交的offset
+type fakeOffsets struct {
+	members   int
+	oldest    map[int32]int64
+	newest    map[int32]int64
+	committed map[int32]int64
+	byTime    int64
+}
+
+func (f *fakeOffsets) ListConsumerGroups() (map[string]string, error) {
+	return map[string]string{"group": "consumer"}, nil
+}
+
+func (f *fakeOffsets) DescribeConsumerGroups(groups []string) ([]*sarama.GroupDescription, error) {
+	desc := &sarama.GroupDescription{GroupId: groups[0], State: "Empty", Members: map[string]*sarama.GroupMemberDescription{}}
+	for i := 0; i < f.members; i++ {
+		desc.State = "Stable"
+		desc.Members[string(rune('a'+i))] = &sarama.GroupMemberDescription{}
+	}
+	return []*sarama.GroupDescription{desc}, nil
+}
+
+func (f *fakeOffsets) ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	res := &sarama.OffsetFetchResponse{}
+	for partition, offset := range f.committed {
+		res.AddBlock("orders", partition, &sarama.OffsetFetchResponseBlock{Offset: offset})
+	}
+	return res, nil
+}
+
+func (f *fakeOffsets) Partitions(topic string) ([]int32, error) {
+	return []int32{0, 1}, nil
+}
+
+func (f *fakeOffsets) GetOffset(topic string, partition int32, t int64) (int64, error) {
+	switch t {
+	case sarama.OffsetOldest:
+		return f.oldest[partition], nil
+	case sarama.OffsetNewest:
+		return f.newest[partition], nil
+	}
+	return f.byTime, nil
+}
+
+func TestParseOffsetReset(t *testing.T) {
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		s       string
+		want    *OffsetReset
+		wantErr bool
+	}{
+		{"earliest", &OffsetReset{To: ResetEarliest}, false},
+		{"Latest", &OffsetReset{To: ResetLatest}, false},
+		{"2024-01-02T15:04:05Z", &OffsetReset{Time: at}, false},
+		{"0:10, 2:20", &OffsetReset{Offsets: map[int32]int64{0: 10, 2: 20}}, false},
+		{"", nil, true},
+		{"0:10,0:20", nil, true},
+		{"0:-1", nil, true},
+		{"yesterday", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOffsetReset(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseOffsetReset(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseOffsetReset(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestGroupLag(t *testing.T) {
+	f := &fakeOffsets{
+		members:   1,
+		newest:    map[int32]int64{0: 10, 1: 5},
+		committed: map[int32]int64{0: 4, 1: -1},
+	}
+	groups, err := listGroups(f, f, nil)
+	if err != nil {
+		t.Fatalf("listGroups() error = %v", err)
+	}
+	want := &GroupLag{
+		Group: "group", State: "Stable", Members: 1, Lag: 11,
+		Partitions: []PartitionLag{
+			{Topic: "orders", Partition: 0, Committed: 4, HighWater: 10, Lag: 6},
+			{Topic: "orders", Partition: 1, Committed: -1, HighWater: 5, Lag: 5},
+		},
+	}
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0], want) {
+		t.Errorf("listGroups() = %+v, want %+v", groups[0], want)
+	}
+}
+
+func TestPlanReset(t *testing.T) {
+	f := &fakeOffsets{
+		oldest:    map[int32]int64{0: 2, 1: 0},
+		newest:    map[int32]int64{0: 10, 1: 5},
+		committed: map[int32]int64{0: 4},
+		byTime:    -1,
+	}
+	tests := []struct {
+		name  string
+		reset *OffsetReset
+		want  []OffsetChange
+	}{
+		{"earliest", &OffsetReset{To: ResetEarliest}, []OffsetChange{{"orders", 0, 4, 2}, {"orders", 1, -1, 0}}},
+		{"latest", &OffsetReset{To: ResetLatest}, []OffsetChange{{"orders", 0, 4, 10}, {"orders", 1, -1, 5}}},
+		{"time after last message", &OffsetReset{Time: time.Now()}, []OffsetChange{{"orders", 0, 4, 10}, {"orders", 1, -1, 5}}},
+		{"explicit clamped", &OffsetReset{Offsets: map[int32]int64{0: 1}}, []OffsetChange{{"orders", 0, 4, 2}}},
+	}
+	for _, tt := range tests {
+		got, err := planReset(f, f, "group", "orders", tt.reset, false)
+		if err != nil {
+			t.Errorf("%s: planReset() error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: planReset() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := planReset(f, f, "group", "orders", &OffsetReset{Offsets: map[int32]int64{3: 1}}, false); err == nil {
+		t.Error("planReset() unknown partition error = nil")
+	}
+	//有在线成员时只能预览
+	f.members = 2
+	if _, err := planReset(f, f, "group", "orders", &OffsetReset{To: ResetLatest}, false); err == nil {
+		t.Error("planReset() with active members error = nil")
+	}
+	if _, err := planReset(f, f, "group", "orders", &OffsetReset{To: ResetLatest}, true); err != nil {
+		t.Errorf("planReset() dry-run error = %v", err)
+	}
+}
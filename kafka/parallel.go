@@ -0,0 +1,135 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// KeyFunc 从消息中取分发的key，同一个key的消息按顺序处理，返回空字符串表示不需要顺序
+type KeyFunc func(msg *sarama.ConsumerMessage) string
+
+// MessageKey 默认的分发key，即消息的key
+func MessageKey(msg *sarama.ConsumerMessage) string {
+	return string(msg.Key)
+}
+
+// laneBuffer 每个处理协程排队的消息数，满了之后分区的消费暂停
+const laneBuffer = 64
+
+// offsetTracker 记录分区内已分发和已完成的offset，只提交到最小的连续完成位置
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int64 //已分发未提交的offset，升序
+	done    map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{done: make(map[int64]bool)}
+}
+
+// add 分发消息前调用，offset 必须递增
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	t.pending = append(t.pending, offset)
+	t.mu.Unlock()
+}
+
+// complete 标记完成，返回可以提交的最大offset，ok 为false表示前面还有未完成的消息
+func (t *offsetTracker) complete(offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done[offset] = true
+	n := 0
+	for n < len(t.pending) && t.done[t.pending[n]] {
+		delete(t.done, t.pending[n])
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	last := t.pending[n-1]
+	t.pending = t.pending[n:]
+	return last, true
+}
+
+// consumeParallel 分区内按key分发到多个协程并发处理，同一个key顺序处理
+// 任何一条消息处理失败都会停止分发，等待处理中的消息完成后返回错误，失败的消息和之后未连续完成的消息会重新消费
+func (serv Consumer) consumeParallel(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	keyFunc := serv.KeyFunc
+	if keyFunc == nil {
+		keyFunc = MessageKey
+	}
+	tracker := newOffsetTracker()
+	lanes := make([]chan *sarama.ConsumerMessage, serv.Concurrency)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		failed   = make(chan struct{})
+	)
+	for i := range lanes {
+		lanes[i] = make(chan *sarama.ConsumerMessage, laneBuffer)
+		wg.Add(1)
+		go func(lane chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for msg := range lane {
+				select {
+				case <-failed:
+					continue //已经失败，剩下的消息不再处理，之后重新消费
+				case <-sess.Context().Done():
+					continue //会话结束，排队的消息不再处理，之后重新消费
+				default:
+				}
+				if err := serv.process(sess.Context(), msg); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+					continue
+				}
+				if offset, ok := tracker.complete(msg.Offset); ok {
+					sess.MarkOffset(msg.Topic, msg.Partition, offset+1, "")
+					serv.metrics.mark(msg.Topic, msg.Partition, offset+1)
+				}
+			}
+		}(lanes[i])
+	}
+
+	var next uint32
+dispatch:
+	for {
+		var msg *sarama.ConsumerMessage
+		select {
+		case m, ok := <-claim.Messages():
+			if !ok {
+				break dispatch
+			}
+			msg = m
+		case <-failed:
+			break dispatch
+		}
+		var lane int
+		if key := keyFunc(msg); key != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(key))
+			lane = int(h.Sum32() % uint32(len(lanes)))
+		} else {
+			lane = int(next % uint32(len(lanes)))
+			next++
+		}
+		tracker.add(msg.Offset)
+		select {
+		case lanes[lane] <- msg:
+		case <-failed:
+			break dispatch
+		}
+	}
+	for _, lane := range lanes {
+		close(lane)
+	}
+	wg.Wait()
+	return firstErr
+}
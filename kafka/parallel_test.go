@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeSession 记录提交的offset
+type fakeSession struct {
+	mu        sync.Mutex
+	marked    int64
+	committed int
+	ctx       context.Context
+	claims    map[string][]int32
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return s.claims }
+func (s *fakeSession) MemberID() string           { return "member" }
+func (s *fakeSession) GenerationID() int32        { return 1 }
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offset > s.marked {
+		s.marked = offset
+	}
+}
+func (s *fakeSession) Commit() {
+	s.mu.Lock()
+	s.committed++
+	s.mu.Unlock()
+}
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+func (s *fakeSession) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *fakeSession) markedOffset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.marked
+}
+
+type fakeClaim struct {
+	messages  chan *sarama.ConsumerMessage
+	highWater int64
+}
+
+func (c *fakeClaim) Topic() string                            { return "topic" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return c.highWater }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func newFakeClaim(keys ...string) *fakeClaim {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(keys))}
+	for i, key := range keys {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: int64(i), Key: []byte(key), Value: []byte(strconv.Itoa(i))}
+	}
+	close(claim.messages)
+	return claim
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tracker := newOffsetTracker()
+	for i := int64(10); i < 15; i++ {
+		tracker.add(i)
+	}
+	if _, ok := tracker.complete(12); ok {
+		t.Errorf("complete(12) should wait for 10")
+	}
+	if _, ok := tracker.complete(11); ok {
+		t.Errorf("complete(11) should wait for 10")
+	}
+	if offset, ok := tracker.complete(10); !ok || offset != 12 {
+		t.Errorf("complete(10) = %d, %v, want 12", offset, ok)
+	}
+	if offset, ok := tracker.complete(14); ok {
+		t.Errorf("complete(14) = %d, should wait for 13", offset)
+	}
+	if offset, ok := tracker.complete(13); !ok || offset != 14 {
+		t.Errorf("complete(13) = %d, %v, want 14", offset, ok)
+	}
+}
+
+func TestConsumeParallel(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string][]string)
+	)
+	consumer := Consumer{
+		Concurrency: 4,
+		CtxHandler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			//后面的消息更快完成，检查同一个key的顺序
+			time.Sleep(time.Duration(10-msg.Offset%10) * time.Millisecond)
+			mu.Lock()
+			seen[string(msg.Key)] = append(seen[string(msg.Key)], string(msg.Value))
+			mu.Unlock()
+			return nil
+		},
+	}
+	keys := make([]string, 0, 40)
+	for i := 0; i < 40; i++ {
+		keys = append(keys, "room"+strconv.Itoa(i%5))
+	}
+	sess := &fakeSession{}
+	if err := consumer.ConsumeClaim(sess, newFakeClaim(keys...)); err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	for key, values := range seen {
+		for i := 1; i < len(values); i++ {
+			prev, _ := strconv.Atoi(values[i-1])
+			cur, _ := strconv.Atoi(values[i])
+			if prev >= cur {
+				t.Errorf("key %s out of order: %v", key, values)
+				break
+			}
+		}
+	}
+	if sess.markedOffset() != 40 {
+		t.Errorf("marked = %d, want 40", sess.markedOffset())
+	}
+}
+
+func TestConsumeParallelError(t *testing.T) {
+	failed := errors.New("failed")
+	consumer := Consumer{
+		Concurrency: 2,
+		KeyFunc:     func(msg *sarama.ConsumerMessage) string { return "" },
+		CtxHandler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			if msg.Offset == 3 {
+				return failed
+			}
+			return nil
+		},
+	}
+	sess := &fakeSession{}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 10)}
+	for i := 0; i < 10; i++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: int64(i)}
+	}
+	//不关闭 claim，失败之后也要返回
+	if err := consumer.ConsumeClaim(sess, claim); err != failed {
+		t.Fatalf("ConsumeClaim() error = %v, want %v", err, failed)
+	}
+	if sess.markedOffset() > 3 {
+		t.Errorf("marked = %d, should not pass the failed offset 3", sess.markedOffset())
+	}
+}
@@ -0,0 +1,306 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/frame/g"
+)
+
+// TransformFunc 把一条输入消息转换成若干条输出消息，可以为空
+// 返回错误时按 Retry 策略重试，仍然失败的消息进入重试topic或者死信，不影响同一批的其他消息
+type TransformFunc func(ctx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error)
+
+// PipelineConf 读一个topic写另一个topic的管道参数
+type PipelineConf struct {
+	ConsumerConf
+
+	Transactional bool          //输出和消费offset在一个事务中提交，精确一次；false 时使用幂等生产者，至少一次
+	BatchMessages int           //一个事务最多包含的输入消息数，默认100
+	BatchInterval time.Duration //一个事务最长的时间，默认100ms
+}
+
+// pipeline 管道的处理逻辑，挂在 Worker 上，由 Consumer.ConsumeClaim 调用
+type pipeline struct {
+	cfg       *PipelineConf
+	transform TransformFunc
+	client    *Client //非事务时共享的幂等生产者
+
+	//newProducer 创建事务生产者，每个输入分区一个 transactional.id，分区重新分配后旧的生产者被隔离
+	newProducer func(txnID string) (sarama.AsyncProducer, error)
+}
+
+// NewPipelineWorker 创建一个管道worker，消费 Topics 中的消息，transform 的输出发送到各自的topic
+// 不需要在回调中发送消息或者提交offset，Worker 的 Run、重新平衡回调、统计等都可以正常使用
+// 开启事务时下游消费者需要设置 ReadCommitted，否则会读到回滚的消息
+// transform 失败的消息按 Retry 策略处理，没有设置时直接进入死信topic，避免一条坏消息让整个消费组反复重新平衡
+// 重试和死信消息不在事务中发送，至少一次
+func NewPipelineWorker(cfg *PipelineConf, transform TransformFunc) (*Worker, error) {
+	conf, err := GetConfig(cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	p := &pipeline{cfg: cfg, transform: transform}
+	if cfg.Transactional {
+		p.newProducer = func(txnID string) (sarama.AsyncProducer, error) {
+			producerCfg, err := conf.transactionalConfig(txnID)
+			if err != nil {
+				return nil, err
+			}
+			return sarama.NewAsyncProducer(conf.Host, producerCfg)
+		}
+	} else {
+		idempotent := *conf
+		idempotent.Idempotent = true
+		idempotent.Acks = "all"
+		producerCfg, err := idempotent.producerConfig()
+		if err != nil {
+			return nil, err
+		}
+		producer, err := sarama.NewAsyncProducer(conf.Host, producerCfg)
+		if err != nil {
+			return nil, gerror.Wrap(err, "kafka new producer error")
+		}
+		p.client = NewClientWithProducer(&idempotent, producer)
+	}
+
+	consumerConf := cfg.ConsumerConf
+	if consumerConf.Retry == nil {
+		consumerConf.Retry = &RetryPolicy{}
+	}
+	worker, err := NewConsumerWorkerCtx(&consumerConf, nil)
+	if err != nil {
+		if p.client != nil {
+			_ = p.client.Close()
+		}
+		return nil, err
+	}
+	worker.pipeline = p
+	return worker, nil
+}
+
+// transactionalConfig 事务生产者的sarama配置，事务要求幂等和 acks all
+func (c *Config) transactionalConfig(txnID string) (*sarama.Config, error) {
+	conf := *c
+	conf.Idempotent = true
+	conf.Acks = "all"
+	cfg, err := conf.producerConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Producer.Transaction.ID = txnID
+	if err := cfg.Validate(); err != nil {
+		return nil, gerror.Wrap(err, "kafka transactional producer config error")
+	}
+	return cfg, nil
+}
+
+func (p *pipeline) batchMessages() int {
+	if p.cfg.BatchMessages > 0 {
+		return p.cfg.BatchMessages
+	}
+	return 100
+}
+
+func (p *pipeline) batchInterval() time.Duration {
+	if p.cfg.BatchInterval > 0 {
+		return p.cfg.BatchInterval
+	}
+	return 100 * time.Millisecond
+}
+
+func (p *pipeline) close() {
+	if p.client != nil {
+		_ = p.client.Close()
+	}
+}
+
+// apply 通过 Consumer.process 调用 transform，复用链路、统计、重试策略和停止时的ctx，返回的ctx用于发送输出消息
+// 失败的消息进入重试topic或者死信后返回nil，没有输出，可以提交
+func (p *pipeline) apply(ctx context.Context, serv Consumer, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, context.Context, error) {
+	var (
+		outputs   []*sarama.ProducerMessage
+		outputCtx context.Context
+	)
+	serv.CtxHandler = func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		var err error
+		if outputs, err = p.transform(ctx, msg); err != nil {
+			outputs = nil
+		}
+		outputCtx = ctx
+		return err
+	}
+	err := serv.process(ctx, msg)
+	return outputs, outputCtx, err
+}
+
+// consumeClaim 处理一个分区
+func (p *pipeline) consumeClaim(serv Consumer, sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if p.newProducer != nil {
+		return p.consumeTransactional(serv, sess, claim)
+	}
+	for msg := range claim.Messages() {
+		if sess.Context().Err() != nil {
+			return nil
+		}
+		outputs, ctx, err := p.apply(sess.Context(), serv, msg)
+		if err != nil {
+			return err
+		}
+		futures := make([]*Future, 0, len(outputs))
+		for _, out := range outputs {
+			futures = append(futures, p.client.SendFuture(ctx, out))
+		}
+		for _, f := range futures {
+			if _, _, err := f.Get(); err != nil {
+				return gerror.Wrapf(err, "kafka pipeline %s[%d]@%d send error", msg.Topic, msg.Partition, msg.Offset)
+			}
+		}
+		sess.MarkMessage(msg, "")
+		serv.metrics.mark(msg.Topic, msg.Partition, msg.Offset+1)
+	}
+	return nil
+}
+
+// txnBatch 一个事务中的输入消息
+type txnBatch struct {
+	producer sarama.AsyncProducer
+	client   *Client
+	group    string
+	count    int
+	last     *sarama.ConsumerMessage
+
+	mu      sync.Mutex
+	sendErr error //事务中第一条发送失败的错误
+}
+
+func (b *txnBatch) add(ctx context.Context, msg *sarama.ConsumerMessage, outputs []*sarama.ProducerMessage) error {
+	if b.count == 0 {
+		if err := b.producer.BeginTxn(); err != nil {
+			return gerror.Wrap(err, "kafka begin transaction error")
+		}
+	}
+	b.count++
+	b.last = msg
+	for _, out := range outputs {
+		if err := b.client.Produce(ctx, out, b.sent); err != nil {
+			return err
+		}
+	}
+	//提交的offset为下一条要消费的位置
+	if err := b.producer.AddMessageToTxn(msg, b.group, nil); err != nil {
+		return gerror.Wrap(err, "kafka add offset to transaction error")
+	}
+	return nil
+}
+
+func (b *txnBatch) sent(msg *sarama.ProducerMessage, err error) {
+	if err == nil {
+		return
+	}
+	b.mu.Lock()
+	if b.sendErr == nil {
+		b.sendErr = gerror.Wrapf(err, "kafka pipeline send to %s error", msg.Topic)
+	}
+	b.mu.Unlock()
+}
+
+// commit 等输出消息都确认后提交事务，输出消息和消费offset同时生效，有发送失败时返回错误由调用方回滚
+func (b *txnBatch) commit() error {
+	if b.count == 0 {
+		return nil
+	}
+	_ = b.client.Flush(context.Background())
+	b.mu.Lock()
+	err := b.sendErr
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := b.producer.CommitTxn(); err != nil {
+		return gerror.Wrapf(err, "kafka commit transaction error, last %s[%d]@%d", b.last.Topic, b.last.Partition, b.last.Offset)
+	}
+	b.count = 0
+	return nil
+}
+
+// abort 回滚事务，失败时生产者已经不可用，分区的处理会结束并重新创建
+func (b *txnBatch) abort() {
+	if b.count == 0 {
+		return
+	}
+	_ = b.client.Flush(context.Background())
+	if b.producer.TxnStatus()&sarama.ProducerTxnFlagInTransaction != 0 {
+		if err := b.producer.AbortTxn(); err != nil {
+			g.Log().Printf("kafka abort transaction failed, %v", err)
+		}
+	}
+	b.count = 0
+	b.mu.Lock()
+	b.sendErr = nil
+	b.mu.Unlock()
+}
+
+// consumeTransactional 事务处理，批量提交，失败时回滚并结束会话，重新加入后从提交的位置开始
+func (p *pipeline) consumeTransactional(serv Consumer, sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) (err error) {
+	txnID := fmt.Sprintf("%s-%s-%d", p.cfg.GroupName, claim.Topic(), claim.Partition())
+	producer, err := p.newProducer(txnID)
+	if err != nil {
+		return gerror.Wrapf(err, "kafka transactional producer %s error", txnID)
+	}
+	batch := &txnBatch{producer: producer, client: NewClientWithProducer(&Config{}, producer), group: p.cfg.GroupName}
+	defer func() {
+		if err != nil {
+			batch.abort()
+		}
+		_ = batch.client.Close()
+	}()
+
+	commit := func() error {
+		last := batch.last
+		if err := batch.commit(); err != nil {
+			return err
+		}
+		if last != nil {
+			serv.metrics.mark(last.Topic, last.Partition, last.Offset+1)
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(p.batchInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok || sess.Context().Err() != nil {
+				return commit()
+			}
+			//重试topic的消息要等到期，先提交，等待期间不占用事务
+			if Header(msg, HeaderRetryAt) != "" {
+				if err := commit(); err != nil {
+					return err
+				}
+			}
+			outputs, ctx, err := p.apply(sess.Context(), serv, msg)
+			if err != nil {
+				return err
+			}
+			if err := batch.add(ctx, msg, outputs); err != nil {
+				return err
+			}
+			if batch.count >= p.batchMessages() {
+				if err := commit(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+// txnProducer 记录事务调用的生产者
+type txnProducer struct {
+	*mocks.AsyncProducer
+	begun, committed, aborted int
+	offsets                   []int64
+}
+
+func (p *txnProducer) BeginTxn() error {
+	p.begun++
+	return p.AsyncProducer.BeginTxn()
+}
+
+func (p *txnProducer) CommitTxn() error {
+	p.committed++
+	return p.AsyncProducer.CommitTxn()
+}
+
+func (p *txnProducer) AbortTxn() error {
+	p.aborted++
+	return p.AsyncProducer.AbortTxn()
+}
+
+func (p *txnProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupID string, metadata *string) error {
+	p.offsets = append(p.offsets, msg.Offset)
+	return nil
+}
+
+func newTxnProducer(t *testing.T, txnID string) *txnProducer {
+	cfg, err := (&Config{Version: "2.1.0"}).transactionalConfig(txnID)
+	if err != nil {
+		t.Fatalf("transactionalConfig() error = %v", err)
+	}
+	return &txnProducer{AsyncProducer: mocks.NewAsyncProducer(t, cfg)}
+}
+
+// upper 每条输入输出一条大写的消息，值为 bad 时失败
+func upper(ctx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	if string(msg.Value) == "bad" {
+		return nil, errors.New("bad input")
+	}
+	return []*sarama.ProducerMessage{{Topic: "events", Value: sarama.StringEncoder("OUT" + string(msg.Value))}}, nil
+}
+
+func TestPipelineTransactional(t *testing.T) {
+	var producer *txnProducer
+	p := &pipeline{
+		cfg:       &PipelineConf{ConsumerConf: ConsumerConf{GroupName: "group"}, Transactional: true, BatchMessages: 2, BatchInterval: time.Hour},
+		transform: upper,
+		newProducer: func(txnID string) (sarama.AsyncProducer, error) {
+			if txnID != "group-topic-0" {
+				t.Errorf("txnID = %s", txnID)
+			}
+			producer = newTxnProducer(t, txnID)
+			for i := 0; i < 3; i++ {
+				producer.ExpectInputAndSucceed()
+			}
+			return producer, nil
+		},
+	}
+	consumer := Consumer{pipeline: p}
+	sess := &fakeSession{}
+	if err := consumer.ConsumeClaim(sess, newFakeClaim("a", "b", "c")); err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	//两条一批，结束时提交剩下的一条，offset 在事务中提交而不是会话中
+	if producer.begun != 2 || producer.committed != 2 || producer.aborted != 0 || len(producer.offsets) != 3 || sess.markedOffset() != 0 {
+		t.Errorf("begun = %d, committed = %d, aborted = %d, offsets = %v, marked = %d",
+			producer.begun, producer.committed, producer.aborted, producer.offsets, sess.markedOffset())
+	}
+}
+
+func TestPipelineTransactionalAbort(t *testing.T) {
+	var producer *txnProducer
+	p := &pipeline{
+		cfg:       &PipelineConf{ConsumerConf: ConsumerConf{GroupName: "group"}, Transactional: true, BatchMessages: 10},
+		transform: upper,
+		newProducer: func(txnID string) (sarama.AsyncProducer, error) {
+			producer = newTxnProducer(t, txnID)
+			producer.ExpectInputAndSucceed()
+			return producer, nil
+		},
+	}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: 0, Value: []byte("ok")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: 1, Value: []byte("bad")}
+	consumer := Consumer{pipeline: p}
+	if err := consumer.ConsumeClaim(&fakeSession{}, claim); err == nil {
+		t.Fatalf("ConsumeClaim() should fail")
+	}
+	if producer.committed != 0 || producer.aborted != 1 {
+		t.Errorf("committed = %d, aborted = %d, want 0, 1", producer.committed, producer.aborted)
+	}
+}
+
+func TestPipelineTransactionalDeadLetter(t *testing.T) {
+	var producer *txnProducer
+	p := &pipeline{
+		cfg:       &PipelineConf{ConsumerConf: ConsumerConf{GroupName: "group"}, Transactional: true, BatchMessages: 10},
+		transform: upper,
+		newProducer: func(txnID string) (sarama.AsyncProducer, error) {
+			producer = newTxnProducer(t, txnID)
+			producer.ExpectInputAndSucceed()
+			producer.ExpectInputAndSucceed()
+			return producer, nil
+		},
+	}
+	retryClient, retryProducer := newMockClient(t, 0)
+	defer retryClient.Close()
+	var dead []string
+	retryProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		dead = append(dead, msg.Topic)
+		return nil
+	})
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: 0, Value: []byte("ok")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: 1, Value: []byte("bad")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Offset: 2, Value: []byte("ok")}
+	close(claim.messages)
+	consumer := Consumer{
+		pipeline: p,
+		retry:    &retrier{policy: &RetryPolicy{Attempts: 2, Backoff: time.Millisecond}, group: "group", client: retryClient},
+	}
+	//transform 一直失败的消息进入死信，会话不结束，同一批的其他消息正常提交
+	if err := consumer.ConsumeClaim(&fakeSession{}, claim); err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	if producer.committed != 1 || producer.aborted != 0 || len(producer.offsets) != 3 {
+		t.Errorf("committed = %d, aborted = %d, offsets = %v", producer.committed, producer.aborted, producer.offsets)
+	}
+	if len(dead) != 1 || dead[0] != "group.dlq" {
+		t.Errorf("dead letters = %v", dead)
+	}
+}
+
+func TestPipelineIdempotent(t *testing.T) {
+	client, producer := newMockClient(t, 0)
+	defer client.Close()
+	var sent []string
+	for i := 0; i < 2; i++ {
+		producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			value, _ := msg.Value.Encode()
+			sent = append(sent, string(value))
+			return nil
+		})
+	}
+	p := &pipeline{cfg: &PipelineConf{ConsumerConf: ConsumerConf{GroupName: "group"}}, transform: upper, client: client}
+	consumer := Consumer{pipeline: p}
+	sess := &fakeSession{}
+	if err := consumer.ConsumeClaim(sess, newFakeClaim("a", "b")); err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	if len(sent) != 2 || sent[0] != "OUT0" || sent[1] != "OUT1" || sess.markedOffset() != 2 {
+		t.Errorf("sent = %v, marked = %d", sent, sess.markedOffset())
+	}
+}
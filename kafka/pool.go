@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+)
+
+// producerPool 实现旧的 pool.Pool，Get 总是返回同一个 SyncProducer，Put、Close 不需要做任何事
+type producerPool struct {
+	producer *syncProducer
+}
+
+func (p *producerPool) Get() (interface{}, error) {
+	return p.producer, nil
+}
+
+func (p *producerPool) Put(interface{}) error {
+	return nil
+}
+
+func (p *producerPool) Close(interface{}) error {
+	return nil
+}
+
+func (p *producerPool) Release() {}
+
+func (p *producerPool) Len() int {
+	return 1
+}
+
+// syncProducer 用 Client 实现 sarama.SyncProducer，生产者由 Client 关闭，不支持事务
+type syncProducer struct {
+	client *Client
+}
+
+func (p *syncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return p.client.SendFuture(context.Background(), msg).Get()
+}
+
+func (p *syncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	futures := make([]*Future, 0, len(msgs))
+	for _, msg := range msgs {
+		futures = append(futures, p.client.SendFuture(context.Background(), msg))
+	}
+	var errs sarama.ProducerErrors
+	for i, f := range futures {
+		if _, _, err := f.Get(); err != nil {
+			errs = append(errs, &sarama.ProducerError{Msg: msgs[i], Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *syncProducer) Close() error {
+	return nil
+}
+
+func (p *syncProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return sarama.ProducerTxnFlagReady
+}
+
+func (p *syncProducer) IsTransactional() bool {
+	return false
+}
+
+func (p *syncProducer) BeginTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *syncProducer) CommitTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *syncProducer) AbortTxn() error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *syncProducer) AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata, string) error {
+	return sarama.ErrNonTransactedProducer
+}
+
+func (p *syncProducer) AddMessageToTxn(*sarama.ConsumerMessage, string, *string) error {
+	return sarama.ErrNonTransactedProducer
+}
+
+var _ sarama.SyncProducer = (*syncProducer)(nil)
@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/frame/g"
+)
+
+// RedriveOptions 死信重新投递的参数
+type RedriveOptions struct {
+	Group  string //记录投递进度的消费组，默认 <死信topic>.redrive，重复执行不会重复投递
+	To     string //投递到指定topic，默认投递回消息头中的原始topic
+	Limit  int    //最多投递多少条，0 表示不限制
+	DryRun bool   //只列出，不投递也不记录进度
+}
+
+// redriveStripHeaders 重新投递时去掉的消息头，消息以全新的状态回到原始topic
+var redriveStripHeaders = []string{
+	HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset,
+	HeaderRetryTier, HeaderRetryAt, HeaderError, HeaderFailedAt, HeaderConsumerGroup,
+}
+
+// Redrive 把死信topic中执行时已有的消息重新投递到原始topic，每条消息处理后回调 cb，返回投递的数量
+func Redrive(ctx context.Context, name, dlq string, opt RedriveOptions, cb func(msg *sarama.ConsumerMessage, target string)) (int, error) {
+	conf, err := GetConfig(name)
+	if err != nil {
+		return 0, err
+	}
+	cfg, err := conf.producerConfig()
+	if err != nil {
+		return 0, err
+	}
+	client, err := sarama.NewClient(conf.Host, cfg)
+	if err != nil {
+		return 0, gerror.Wrap(err, "kafka new client error")
+	}
+	defer client.Close()
+	if opt.Group == "" {
+		opt.Group = dlq + ".redrive"
+	}
+
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		return 0, gerror.Wrap(err, "kafka new producer error")
+	}
+	sender := NewClientWithProducer(conf, producer)
+	defer sender.Close()
+
+	return redrive(ctx, client, sender, dlq, opt, cb)
+}
+
+func redrive(ctx context.Context, client sarama.Client, sender *Client, dlq string, opt RedriveOptions, cb func(msg *sarama.ConsumerMessage, target string)) (int, error) {
+	partitions, err := client.Partitions(dlq)
+	if err != nil {
+		return 0, gerror.Wrapf(err, "kafka partitions of %s error", dlq)
+	}
+	offsets, err := sarama.NewOffsetManagerFromClient(opt.Group, client)
+	if err != nil {
+		return 0, gerror.Wrap(err, "kafka new offset manager error")
+	}
+	defer offsets.Close()
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, gerror.Wrap(err, "kafka new consumer error")
+	}
+	defer consumer.Close()
+
+	count := 0
+	for _, partition := range partitions {
+		if opt.Limit > 0 && count >= opt.Limit {
+			break
+		}
+		n, err := redrivePartition(ctx, client, consumer, offsets, sender, dlq, partition, opt, opt.Limit-count, cb)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	if !opt.DryRun {
+		offsets.Commit()
+	}
+	return count, nil
+}
+
+func redrivePartition(
+	ctx context.Context, client sarama.Client, consumer sarama.Consumer, offsets sarama.OffsetManager, sender *Client,
+	dlq string, partition int32, opt RedriveOptions, limit int, cb func(msg *sarama.ConsumerMessage, target string)) (int, error) {
+
+	pom, err := offsets.ManagePartition(dlq, partition)
+	if err != nil {
+		return 0, gerror.Wrapf(err, "kafka manage partition %s[%d] error", dlq, partition)
+	}
+	defer pom.Close()
+
+	next, _ := pom.NextOffset()
+	oldest, err := client.GetOffset(dlq, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, err
+	}
+	if next < oldest {
+		next = oldest
+	}
+	high, err := client.GetOffset(dlq, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, err
+	}
+	if next >= high {
+		return 0, nil
+	}
+
+	pc, err := consumer.ConsumePartition(dlq, partition, next)
+	if err != nil {
+		return 0, gerror.Wrapf(err, "kafka consume %s[%d] error", dlq, partition)
+	}
+	defer pc.Close()
+	return redriveMessages(ctx, pc, pom, sender, dlq, partition, high, opt, limit, cb)
+}
+
+// redriveIdleTimeout 等不到新消息的时间，high 之前的offset可能是事务的控制消息或者已经被压缩，不会收到
+var redriveIdleTimeout = 10 * time.Second
+
+// redriveMessages 投递分区中 high 之前的消息，到达 high、分区的高水位或者一段时间没有新消息时结束
+func redriveMessages(
+	ctx context.Context, pc sarama.PartitionConsumer, pom sarama.PartitionOffsetManager, sender *Client,
+	dlq string, partition int32, high int64, opt RedriveOptions, limit int, cb func(msg *sarama.ConsumerMessage, target string)) (int, error) {
+
+	idle := time.NewTimer(redriveIdleTimeout)
+	defer idle.Stop()
+	count := 0
+	for {
+		var msg *sarama.ConsumerMessage
+		select {
+		case msg = <-pc.Messages():
+		case <-idle.C:
+			g.Log().Warningf("kafka redrive %s[%d] no message before offset %d in %v, stopped", dlq, partition, high, redriveIdleTimeout)
+			return count, nil
+		case <-ctx.Done():
+			return count, ctx.Err()
+		}
+		if !idle.Stop() {
+			<-idle.C
+		}
+		idle.Reset(redriveIdleTimeout)
+
+		target := opt.To
+		if target == "" {
+			target = Header(msg, HeaderOriginalTopic)
+		}
+		if target == "" {
+			g.Log().Warningf("kafka redrive %s[%d]@%d has no original topic, skipped", dlq, partition, msg.Offset)
+		} else if !opt.DryRun {
+			if _, _, err := sender.SendFuture(ctx, redriveMessage(msg, target)).Get(); err != nil {
+				return count, gerror.Wrapf(err, "kafka redrive %s[%d]@%d to %s error", dlq, partition, msg.Offset, target)
+			}
+		}
+		if !opt.DryRun {
+			pom.MarkOffset(msg.Offset+1, "")
+		}
+		if target != "" {
+			count++
+		}
+		if cb != nil {
+			cb(msg, target)
+		}
+		//high 之前最后的offset不是普通消息时，到达高水位就结束
+		if msg.Offset+1 >= high || msg.Offset+1 >= pc.HighWaterMarkOffset() || (limit > 0 && count >= limit) {
+			return count, nil
+		}
+	}
+}
+
+// redriveMessage 复制死信消息，去掉重试和错误相关的消息头
+func redriveMessage(msg *sarama.ConsumerMessage, target string) *sarama.ProducerMessage {
+	res := &sarama.ProducerMessage{
+		Topic: target,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		res.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, h := range msg.Headers {
+		if h == nil || isRedriveStripHeader(string(h.Key)) {
+			continue
+		}
+		res.Headers = append(res.Headers, sarama.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	return res
+}
+
+func isRedriveStripHeader(key string) bool {
+	for _, strip := range redriveStripHeaders {
+		if strings.EqualFold(strip, key) {
+			return true
+		}
+	}
+	return false
+}
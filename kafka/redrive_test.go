@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakePartition 高水位固定的分区
+type fakePartition struct {
+	sarama.PartitionConsumer
+	msgs chan *sarama.ConsumerMessage
+	hwm  int64
+}
+
+func (p *fakePartition) Messages() <-chan *sarama.ConsumerMessage {
+	return p.msgs
+}
+
+func (p *fakePartition) HighWaterMarkOffset() int64 {
+	return p.hwm
+}
+
+func TestRedriveMessagesStop(t *testing.T) {
+	defer func(d time.Duration) { redriveIdleTimeout = d }(redriveIdleTimeout)
+	redriveIdleTimeout = 20 * time.Millisecond
+	tests := []struct {
+		name string
+		hwm  int64
+	}{
+		{"high water mark", 2},
+		{"idle timeout", 4}, //offset 2、3 是事务的控制消息，不会收到
+	}
+	for _, tt := range tests {
+		pc := &fakePartition{msgs: make(chan *sarama.ConsumerMessage, 2), hwm: tt.hwm}
+		for i := int64(0); i < 2; i++ {
+			pc.msgs <- &sarama.ConsumerMessage{Topic: "orders.dlq", Offset: i, Headers: []*sarama.RecordHeader{
+				{Key: []byte(HeaderOriginalTopic), Value: []byte("orders")},
+			}}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		n, err := redriveMessages(ctx, pc, nil, nil, "orders.dlq", 0, 4, RedriveOptions{DryRun: true}, 0, nil)
+		cancel()
+		if n != 2 || err != nil {
+			t.Errorf("%s: redriveMessages() = %d, %v", tt.name, n, err)
+		}
+	}
+}
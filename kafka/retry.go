@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/frame/g"
+	"github.com/gogf/gf/util/gconv"
+)
+
+// 重试和死信消息头
+const (
+	HeaderOriginalTopic     = "original-topic"
+	HeaderOriginalPartition = "original-partition"
+	HeaderOriginalOffset    = "original-offset"
+	HeaderRetryTier         = "retry-tier" //已经进入第几档重试topic，从1开始
+	HeaderRetryAt           = "retry-at"   //到期时间，unix毫秒
+	HeaderError             = "error"
+	HeaderFailedAt          = "failed-at" //进入死信的时间，unix毫秒
+	HeaderConsumerGroup     = "consumer-group"
+)
+
+// RetryPolicy 消费失败的处理策略：
+// 先原地重试 Attempts 次，间隔从 Backoff 开始翻倍，不超过 MaxBackoff
+// 仍然失败时依次发送到 Delays 对应的重试topic，到期后再次消费
+// 所有重试topic都失败后发送到死信topic，消息头中带上错误信息
+type RetryPolicy struct {
+	Attempts   int             //原地重试次数，不含第一次
+	Backoff    time.Duration   //原地重试的初始间隔，默认100ms
+	MaxBackoff time.Duration   //原地重试的最大间隔，默认5s
+	Delays     []time.Duration //重试topic的延迟档位，见 RetryTopic
+	DeadLetter string          //死信topic，默认 <消费组>.dlq，"-" 表示不使用死信，失败后跳过
+}
+
+// RetryTopic 重试topic的名字，整秒为 <消费组>.retry.<秒数>，否则为 <消费组>.retry.<毫秒数>ms
+func RetryTopic(group string, delay time.Duration) string {
+	if delay%time.Second != 0 {
+		return fmt.Sprintf("%s.retry.%dms", group, delay.Milliseconds())
+	}
+	return fmt.Sprintf("%s.retry.%d", group, int64(delay/time.Second))
+}
+
+// DeadLetterTopic 死信topic的名字
+func (p *RetryPolicy) DeadLetterTopic(group string) string {
+	if p.DeadLetter != "" {
+		return p.DeadLetter
+	}
+	return group + ".dlq"
+}
+
+// topics 消费组需要额外订阅的重试topic
+func (p *RetryPolicy) topics(group string) []string {
+	topics := make([]string, 0, len(p.Delays))
+	for _, delay := range p.Delays {
+		topics = append(topics, RetryTopic(group, delay))
+	}
+	return topics
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff, max := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 5 * time.Second
+	}
+	for i := 0; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// retrier 按策略处理失败的消息
+type retrier struct {
+	policy *RetryPolicy
+	group  string
+	client *Client //发送重试和死信消息
+}
+
+// sleep 等待 d，ctx 结束时返回错误
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// process 返回nil表示消息已经处理完成(成功、进入重试topic或死信)，可以提交
+// 返回错误时不能提交，一般是ctx结束或者重试消息发送失败
+func (r *retrier) process(ctx context.Context, msg *sarama.ConsumerMessage, handle ReceiveCtxFunc) error {
+	tier := gconv.Int(Header(msg, HeaderRetryTier))
+	target := msg
+	if tier > 0 {
+		//重试topic的消息，等到期之后再处理，同一个topic的延迟相同，顺序等待即可
+		retryAt := gconv.Int64(Header(msg, HeaderRetryAt))
+		if err := sleep(ctx, time.Until(time.UnixMilli(retryAt))); err != nil {
+			return err
+		}
+		//回调看到的是原始topic
+		copied := *msg
+		if topic := Header(msg, HeaderOriginalTopic); topic != "" {
+			copied.Topic = topic
+		}
+		target = &copied
+	}
+
+	return r.retry(ctx, msg, target, tier, handle, handle(ctx, target))
+}
+
+// processFailed 第一次处理已经失败的原始topic的消息，比如批量处理中失败的消息，继续按策略重试
+func (r *retrier) processFailed(ctx context.Context, msg *sarama.ConsumerMessage, handle ReceiveCtxFunc, err error) error {
+	return r.retry(ctx, msg, msg, 0, handle, err)
+}
+
+// retry 第一次处理的结果为 err，失败时原地重试，仍然失败时进入下一档重试topic或者死信
+// target 是回调看到的消息，重试topic中的消息 Topic 为原始topic
+func (r *retrier) retry(ctx context.Context, msg, target *sarama.ConsumerMessage, tier int, handle ReceiveCtxFunc, err error) error {
+	for attempt := 0; err != nil && attempt < r.policy.Attempts; attempt++ {
+		if e := sleep(ctx, r.policy.backoff(attempt)); e != nil {
+			return e
+		}
+		err = handle(ctx, target)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if tier < len(r.policy.Delays) {
+		delay := r.policy.Delays[tier]
+		topic := RetryTopic(r.group, delay)
+		g.Log().Warningf("kafka consume failed, %s[%d]@%d retry to %s, err:%v", msg.Topic, msg.Partition, msg.Offset, topic, err)
+		retry := r.forward(msg, target.Topic, topic, err)
+		setHeader(&retry.Headers, HeaderRetryTier, strconv.Itoa(tier+1))
+		setHeader(&retry.Headers, HeaderRetryAt, strconv.FormatInt(time.Now().Add(delay).UnixMilli(), 10))
+		return r.send(retry)
+	}
+
+	if r.policy.DeadLetter == "-" {
+		g.Log().Errorf("kafka consume failed, %s[%d]@%d skipped, err:%v", msg.Topic, msg.Partition, msg.Offset, err)
+		return nil
+	}
+	topic := r.policy.DeadLetterTopic(r.group)
+	g.Log().Errorf("kafka consume failed, %s[%d]@%d dead letter to %s, err:%v", msg.Topic, msg.Partition, msg.Offset, topic, err)
+	dead := r.forward(msg, target.Topic, topic, err)
+	setHeader(&dead.Headers, HeaderFailedAt, strconv.FormatInt(time.Now().UnixMilli(), 10))
+	return r.send(dead)
+}
+
+// forward 复制消息到新的topic，保留原来的消息头，并记录原始位置和错误
+func (r *retrier) forward(msg *sarama.ConsumerMessage, original, topic string, cause error) *sarama.ProducerMessage {
+	forward := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		forward.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, h := range msg.Headers {
+		if h != nil {
+			forward.Headers = append(forward.Headers, sarama.RecordHeader{Key: h.Key, Value: h.Value})
+		}
+	}
+	//从重试topic再次转发时保留最初的位置
+	if Header(msg, HeaderOriginalTopic) == "" {
+		setHeader(&forward.Headers, HeaderOriginalTopic, original)
+		setHeader(&forward.Headers, HeaderOriginalPartition, strconv.Itoa(int(msg.Partition)))
+		setHeader(&forward.Headers, HeaderOriginalOffset, strconv.FormatInt(msg.Offset, 10))
+	}
+	setHeader(&forward.Headers, HeaderConsumerGroup, r.group)
+	setHeader(&forward.Headers, HeaderError, cause.Error())
+	return forward
+}
+
+// send 发送失败时返回错误，消息不能提交，之后会重新消费
+func (r *retrier) send(msg *sarama.ProducerMessage) error {
+	//消息头中已经有原来的链路，不再注入消费的ctx
+	if _, _, err := r.client.SendFuture(context.Background(), msg).Get(); err != nil {
+		return gerror.Wrapf(err, "kafka send to %s error", msg.Topic)
+	}
+	return nil
+}
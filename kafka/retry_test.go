@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestRetrierProcess(t *testing.T) {
+	client, producer := newMockClient(t, 0)
+	defer client.Close()
+	policy := &RetryPolicy{Attempts: 2, Backoff: time.Millisecond, Delays: []time.Duration{time.Second, time.Minute}}
+	r := &retrier{policy: policy, group: "group", client: client}
+
+	var sent []*sarama.ProducerMessage
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		sent = append(sent, msg)
+		return nil
+	})
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		sent = append(sent, msg)
+		return nil
+	})
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		sent = append(sent, msg)
+		return nil
+	})
+
+	calls := 0
+	failed := errors.New("poison")
+	handle := func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		calls++
+		if msg.Topic != "orders" {
+			t.Errorf("handler topic = %s, want orders", msg.Topic)
+		}
+		return failed
+	}
+
+	msg := &sarama.ConsumerMessage{Topic: "orders", Partition: 3, Offset: 7, Value: []byte("v"), Key: []byte("k")}
+	if err := r.process(context.Background(), msg, handle); err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+	if calls != 3 || len(sent) != 1 || sent[0].Topic != "group.retry.1" {
+		t.Fatalf("calls = %d, sent = %+v", calls, sent)
+	}
+
+	//进入第二档重试topic，原始位置保持不变
+	setHeader(&sent[0].Headers, HeaderRetryAt, strconv.FormatInt(time.Now().UnixMilli(), 10))
+	retry := toConsumerMessage(sent[0])
+	if err := r.process(context.Background(), retry, handle); err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+	if len(sent) != 2 || sent[1].Topic != "group.retry.60" {
+		t.Fatalf("sent = %+v", sent)
+	}
+
+	setHeader(&sent[1].Headers, HeaderRetryAt, "0")
+	dead := toConsumerMessage(sent[1])
+	if err := r.process(context.Background(), dead, handle); err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+	if len(sent) != 3 || sent[2].Topic != "group.dlq" {
+		t.Fatalf("sent = %+v", sent)
+	}
+	final := toConsumerMessage(sent[2])
+	if Header(final, HeaderOriginalTopic) != "orders" || Header(final, HeaderOriginalPartition) != "3" ||
+		Header(final, HeaderOriginalOffset) != "7" || Header(final, HeaderError) != "poison" || Header(final, HeaderFailedAt) == "" {
+		t.Errorf("dead letter headers = %+v", sent[2].Headers)
+	}
+
+	redriven := redriveMessage(final, "orders")
+	if len(redriven.Headers) != 0 || redriven.Topic != "orders" {
+		t.Errorf("redriveMessage() headers = %+v", redriven.Headers)
+	}
+}
+
+func TestRetrierWaitCanceled(t *testing.T) {
+	r := &retrier{policy: &RetryPolicy{Delays: []time.Duration{time.Hour}}, group: "group"}
+	msg := &sarama.ConsumerMessage{Topic: "group.retry.3600"}
+	at := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+	msg.Headers = []*sarama.RecordHeader{
+		{Key: []byte(HeaderRetryTier), Value: []byte("1")},
+		{Key: []byte(HeaderRetryAt), Value: []byte(at)},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := r.process(ctx, msg, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		t.Errorf("handler should not be called before retry-at")
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("process() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestRetryTopic(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  string
+	}{
+		{time.Second, "group.retry.1"},
+		{time.Minute, "group.retry.60"},
+		{500 * time.Millisecond, "group.retry.500ms"},
+		{200 * time.Millisecond, "group.retry.200ms"},
+		{1500 * time.Millisecond, "group.retry.1500ms"},
+	}
+	for _, tt := range tests {
+		if got := RetryTopic("group", tt.delay); got != tt.want {
+			t.Errorf("RetryTopic(%v) = %s, want %s", tt.delay, got, tt.want)
+		}
+	}
+}
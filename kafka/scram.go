@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+
+	"github.com/xdg-go/scram"
+)
+
+// scram 使用的hash，和sarama示例中的一致
+var (
+	scramSHA256 scram.HashGeneratorFcn = sha256.New
+	scramSHA512 scram.HashGeneratorFcn = sha512.New
+)
+
+// scramClient 实现 sarama.SCRAMClient，握手由 github.com/xdg-go/scram 完成
+type scramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+// Begin 开始认证
+func (s *scramClient) Begin(userName, password, authzID string) error {
+	client, err := s.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	s.Client = client
+	s.ClientConversation = client.NewConversation()
+	return nil
+}
+
+// Step 处理服务端的消息，返回发给服务端的消息
+func (s *scramClient) Step(challenge string) (string, error) {
+	return s.ClientConversation.Step(challenge)
+}
+
+// Done 认证是否完成
+func (s *scramClient) Done() bool {
+	return s.ClientConversation.Done()
+}
@@ -0,0 +1,265 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/frame/g"
+)
+
+// TopicSpec 服务需要的topic，可以写在配置 go-kafka.<name>.Topics 中，也可以用 DeclareTopics 在代码中声明
+type TopicSpec struct {
+	Name              string
+	Partitions        int32             //分区数，默认1
+	ReplicationFactor int16             //副本数，默认使用broker的 default.replication.factor
+	RetentionMs       int64             //消息保留时间，0 表示使用broker的默认值
+	Configs           map[string]string //其他topic配置，如 cleanup.policy
+}
+
+// configs 声明的topic配置
+func (s *TopicSpec) configs() map[string]string {
+	res := make(map[string]string, len(s.Configs)+1)
+	for k, v := range s.Configs {
+		res[k] = v
+	}
+	if s.RetentionMs != 0 {
+		res["retention.ms"] = strconv.FormatInt(s.RetentionMs, 10)
+	}
+	return res
+}
+
+func (s *TopicSpec) detail() *sarama.TopicDetail {
+	detail := &sarama.TopicDetail{NumPartitions: s.Partitions, ReplicationFactor: s.ReplicationFactor}
+	if detail.NumPartitions <= 0 {
+		detail.NumPartitions = 1
+	}
+	if detail.ReplicationFactor <= 0 {
+		detail.ReplicationFactor = -1
+	}
+	configs := s.configs()
+	if len(configs) > 0 {
+		detail.ConfigEntries = make(map[string]*string, len(configs))
+		for k := range configs {
+			v := configs[k]
+			detail.ConfigEntries[k] = &v
+		}
+	}
+	return detail
+}
+
+// ConfigDrift topic配置和声明不一致，Got 为空表示使用broker的默认值
+type ConfigDrift struct {
+	Name string
+	Want string
+	Got  string
+}
+
+// TopicReport 一个topic和声明的对比结果
+type TopicReport struct {
+	Topic                 string
+	Missing               bool //不存在，也没有创建
+	Created               bool
+	Partitions            int32
+	WantPartitions        int32 //0 表示没有声明，不检查
+	ReplicationFactor     int16
+	WantReplicationFactor int16 //0 表示没有声明，不检查
+	Drift                 []ConfigDrift
+}
+
+// OK topic存在并且和声明一致
+func (r *TopicReport) OK() bool {
+	return !r.Missing && len(r.Drift) == 0 &&
+		(r.WantPartitions <= 0 || r.Partitions == r.WantPartitions) &&
+		(r.WantReplicationFactor <= 0 || r.ReplicationFactor == r.WantReplicationFactor)
+}
+
+func (r *TopicReport) String() string {
+	switch {
+	case r.Missing:
+		return fmt.Sprintf("%s missing", r.Topic)
+	case r.Created:
+		return fmt.Sprintf("%s created, partitions=%d", r.Topic, r.Partitions)
+	}
+	s := fmt.Sprintf("%s partitions=%d replication=%d", r.Topic, r.Partitions, r.ReplicationFactor)
+	if r.WantPartitions > 0 && r.Partitions != r.WantPartitions {
+		s += fmt.Sprintf(", want partitions %d", r.WantPartitions)
+	}
+	if r.WantReplicationFactor > 0 && r.ReplicationFactor != r.WantReplicationFactor {
+		s += fmt.Sprintf(", want replication %d", r.WantReplicationFactor)
+	}
+	for _, d := range r.Drift {
+		s += fmt.Sprintf(", %s=%q want %q", d.Name, d.Got, d.Want)
+	}
+	return s
+}
+
+var (
+	declaredMu sync.Mutex
+	declared   = make(map[string][]TopicSpec) //kafka配置名 => 代码中声明的topic
+)
+
+// DeclareTopics 在代码中声明 name 集群上需要的topic，和配置中同名时以代码中的为准
+// 一般在 init 中调用，EnsureTopics 和 kafkactl topics 会检查或创建它们
+func DeclareTopics(name string, specs ...TopicSpec) {
+	declaredMu.Lock()
+	defer declaredMu.Unlock()
+	declared[name] = append(declared[name], specs...)
+}
+
+// Topics name 集群上声明的所有topic，按名字排序
+func Topics(name string) ([]TopicSpec, error) {
+	conf, err := GetConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	return conf.topics(name), nil
+}
+
+func (c *Config) topics(name string) []TopicSpec {
+	merged := make(map[string]TopicSpec)
+	for _, spec := range c.Topics {
+		merged[spec.Name] = spec
+	}
+	declaredMu.Lock()
+	for _, spec := range declared[name] {
+		merged[spec.Name] = spec
+	}
+	declaredMu.Unlock()
+
+	res := make([]TopicSpec, 0, len(merged))
+	for _, spec := range merged {
+		res = append(res, spec)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+var (
+	ensuredMu sync.Mutex
+	ensured   = make(map[string]error) //已经在启动时检查过的集群
+)
+
+// ensureTopicsOnce 进程内每个集群只检查并创建一次
+func ensureTopicsOnce(name string) error {
+	ensuredMu.Lock()
+	defer ensuredMu.Unlock()
+	if err, ok := ensured[name]; ok {
+		return err
+	}
+	_, err := EnsureTopics(name, true)
+	ensured[name] = err
+	return err
+}
+
+// topicAdmin 管理topic用到的 sarama.ClusterAdmin 方法
+type topicAdmin interface {
+	ListTopics() (map[string]sarama.TopicDetail, error)
+	CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error
+}
+
+// EnsureTopics 对比 name 集群上声明的topic，create 为true时创建不存在的topic
+// 分区数和配置不一致时只记录警告，不会修改已有的topic；有topic不存在或者创建失败时返回错误
+func EnsureTopics(name string, create bool) ([]*TopicReport, error) {
+	conf, err := GetConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	specs := conf.topics(name)
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	_, admin, err := newAdmin(name)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	return reconcileTopics(admin, specs, create)
+}
+
+func reconcileTopics(admin topicAdmin, specs []TopicSpec, create bool) ([]*TopicReport, error) {
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return nil, gerror.Wrap(err, "kafka list topics error")
+	}
+
+	var (
+		reports = make([]*TopicReport, 0, len(specs))
+		missing []string
+	)
+	for i := range specs {
+		spec := &specs[i]
+		if spec.Name == "" {
+			return reports, gerror.New("kafka topic declaration without name")
+		}
+		want := spec.detail()
+		report := &TopicReport{Topic: spec.Name, WantPartitions: spec.Partitions, WantReplicationFactor: spec.ReplicationFactor}
+		reports = append(reports, report)
+
+		detail, ok := existing[spec.Name]
+		if !ok {
+			if !create {
+				report.Missing = true
+				missing = append(missing, spec.Name)
+				g.Log().Warningf("kafka topic %s declared but not exists", spec.Name)
+				continue
+			}
+			if err := admin.CreateTopic(spec.Name, want, false); err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+				report.Missing = true
+				return reports, gerror.Wrapf(err, "kafka create topic %s error", spec.Name)
+			}
+			report.Created = true
+			report.Partitions, report.ReplicationFactor = want.NumPartitions, spec.ReplicationFactor
+			g.Log().Infof("kafka topic %s created, partitions=%d", spec.Name, want.NumPartitions)
+			continue
+		}
+
+		report.Partitions, report.ReplicationFactor = detail.NumPartitions, detail.ReplicationFactor
+		for k, v := range spec.configs() {
+			got := ""
+			if p := detail.ConfigEntries[k]; p != nil {
+				got = *p
+			}
+			if got != v {
+				report.Drift = append(report.Drift, ConfigDrift{Name: k, Want: v, Got: got})
+			}
+		}
+		sort.Slice(report.Drift, func(i, j int) bool { return report.Drift[i].Name < report.Drift[j].Name })
+		if !report.OK() {
+			g.Log().Warningf("kafka topic %s differs from declaration: %s", spec.Name, report)
+		}
+	}
+	if len(missing) > 0 {
+		return reports, gerror.Newf("kafka topics %v not exists", missing)
+	}
+	return reports, nil
+}
+
+// checkTopics 确认消费的topic都存在，避免topic名字写错时一直消费不到消息
+func checkTopics(client sarama.Client, topics []string) error {
+	if err := client.RefreshMetadata(); err != nil {
+		return gerror.Wrap(err, "kafka refresh metadata error")
+	}
+	existing, err := client.Topics()
+	if err != nil {
+		return gerror.Wrap(err, "kafka list topics error")
+	}
+	set := make(map[string]bool, len(existing))
+	for _, topic := range existing {
+		set[topic] = true
+	}
+	var missing []string
+	for _, topic := range topics {
+		if !set[topic] {
+			missing = append(missing, topic)
+		}
+	}
+	if len(missing) > 0 {
+		return gerror.Newf("kafka topics %v not exists, check ConsumerConf.Topics or declare them", missing)
+	}
+	return nil
+}
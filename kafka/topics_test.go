@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeTopicAdmin 记录创建的topic
+type fakeTopicAdmin struct {
+	topics  map[string]sarama.TopicDetail
+	created map[string]*sarama.TopicDetail
+}
+
+func (f *fakeTopicAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return f.topics, nil
+}
+
+func (f *fakeTopicAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	if _, ok := f.topics[topic]; ok {
+		return &sarama.TopicError{Err: sarama.ErrTopicAlreadyExists}
+	}
+	f.created[topic] = detail
+	return nil
+}
+
+func TestReconcileTopics(t *testing.T) {
+	retention := "86400000"
+	admin := &fakeTopicAdmin{
+		topics: map[string]sarama.TopicDetail{
+			"orders": {NumPartitions: 6, ReplicationFactor: 3, ConfigEntries: map[string]*string{"retention.ms": &retention}},
+			"clicks": {NumPartitions: 4, ReplicationFactor: 3},
+		},
+		created: make(map[string]*sarama.TopicDetail),
+	}
+	specs := []TopicSpec{
+		{Name: "orders", Partitions: 6, ReplicationFactor: 3, RetentionMs: 86400000},
+		{Name: "clicks", Partitions: 8, Configs: map[string]string{"cleanup.policy": "compact"}},
+		{Name: "payments", Partitions: 3, RetentionMs: 1000},
+	}
+
+	reports, err := reconcileTopics(admin, specs, false)
+	if err == nil || len(reports) != 3 || !reports[2].Missing || len(admin.created) != 0 {
+		t.Fatalf("reconcileTopics(create=false) = %v, %v", reports, err)
+	}
+	if !reports[0].OK() {
+		t.Errorf("orders report = %s", reports[0])
+	}
+	want := []ConfigDrift{{Name: "cleanup.policy", Want: "compact", Got: ""}}
+	if reports[1].OK() || reports[1].Partitions != 4 || !reflect.DeepEqual(reports[1].Drift, want) {
+		t.Errorf("clicks report = %s", reports[1])
+	}
+
+	reports, err = reconcileTopics(admin, specs, true)
+	if err != nil || !reports[2].Created {
+		t.Fatalf("reconcileTopics(create=true) = %v, %v", reports, err)
+	}
+	detail := admin.created["payments"]
+	if detail == nil || detail.NumPartitions != 3 || detail.ReplicationFactor != -1 || *detail.ConfigEntries["retention.ms"] != "1000" {
+		t.Errorf("created = %+v", detail)
+	}
+}
+
+func TestConfigTopics(t *testing.T) {
+	conf := &Config{Topics: []TopicSpec{{Name: "b", Partitions: 1}, {Name: "a", Partitions: 1}}}
+	DeclareTopics("topics-test", TopicSpec{Name: "b", Partitions: 2})
+	got := conf.topics("topics-test")
+	want := []TopicSpec{{Name: "a", Partitions: 1}, {Name: "b", Partitions: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topics() = %+v, want %+v", got, want)
+	}
+}
@@ -2,133 +2,399 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/gogf/gf/frame/g"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
 type ConsumerConf struct {
-	Name      string   //kafka 集群配置名字
-	GroupName string   //消费组名字
-	Topics    []string //对应topic数据
-	Desc      string   //说明信息
+	Name      string       //kafka 集群配置名字
+	GroupName string       //消费组名字
+	Topics    []string     //对应topic数据
+	Desc      string       //说明信息
+	Retry     *RetryPolicy //消费失败的重试策略，nil 表示回调出错时重新消费这条消息
+
+	Concurrency int     //分区内并发处理的协程数，大于1时按key分发，同一个key顺序处理
+	KeyFunc     KeyFunc //分发的key，默认是消息的key，比如按房间ID分发
+
+	DrainTimeout time.Duration //停止时等待处理中消息的时间，超过后回调的ctx结束，默认10秒
+
+	BatchSize   int           //批量消费时一批最多的消息数，默认100
+	BatchWindow time.Duration //批量消费时一批最长的等待时间，默认1秒
+
+	MaxLag       int64   //健康检查允许的单个分区最大积压，0 表示不检查
+	MaxErrorRate float64 //健康检查允许的最近一分钟回调失败比例，如 0.05，0 表示不检查
+}
+
+func (c *ConsumerConf) drainTimeout() time.Duration {
+	if c.DrainTimeout > 0 {
+		return c.DrainTimeout
+	}
+	return 10 * time.Second
 }
 
 // ConsumerConfig 消费者参数定义
 type Worker struct {
 	cfg       *ConsumerConf
-	receiveCb ReceiveFunc //回调函数
+	receiveCb ReceiveCtxFunc //回调函数
+	batchCb   ReceiveBatchFunc
 	group     sarama.ConsumerGroup
+	client    sarama.Client //消费组使用的连接，查询分区最新offset，测试中为nil
+	retry     *retrier
+	pipeline  *pipeline
+	metrics   *consumerMetrics
+
+	onAssigned RebalanceFunc
+	onRevoked  RebalanceFunc
 }
 
+// RebalanceFunc 分区分配和回收的回调，claims 为 topic => 分区
+// 返回错误时本次消费会话结束，稍后重新加入消费组
+type RebalanceFunc func(ctx context.Context, claims map[string][]int32) error
+
 // ConsumerHander 消息回调定义
 type ReceiveFunc func(msg *sarama.ConsumerMessage) error
 
+// ReceiveCtxFunc 带上下文的消息回调，ctx 中有发送方的链路、TraceId、UID和语言，见 ContextFromMessage
+type ReceiveCtxFunc func(ctx context.Context, msg *sarama.ConsumerMessage) error
+
 // NewConsumerWorker kafka消费
 func NewConsumerWorker(cfg *ConsumerConf, handler ReceiveFunc) (*Worker, error) {
+	return NewConsumerWorkerCtx(cfg, func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		return handler(msg)
+	})
+}
+
+// NewConsumerWorkerCtx kafka消费，回调带上下文
+func NewConsumerWorkerCtx(cfg *ConsumerConf, handler ReceiveCtxFunc) (*Worker, error) {
 	conf, err := GetConfig(cfg.Name)
 	if err != nil {
 		g.Log().Printf("read kafka config failed, %v", err)
 		return nil, err
 	}
-	version, err := sarama.ParseKafkaVersion(conf.Version)
+	kafkaCfg, err := conf.consumerConfig()
 	if err != nil {
-		g.Log().Printf(" sarama.ParseKafkaVersion failed,version:%s, err:%v", conf.Version, err)
+		g.Log().Printf("kafka consumer config failed, %v", err)
 		return nil, err
 	}
 
-	kafkaCfg := sarama.NewConfig()
-	kafkaCfg.Version = version
-	kafkaCfg.Consumer.Return.Errors = true
-	kafkaCfg.Consumer.Offsets.CommitInterval = 1 * time.Second
-	kafkaCfg.Consumer.Offsets.Initial = sarama.OffsetOldest
-
-	group, err := sarama.NewConsumerGroup(conf.Host, cfg.GroupName, kafkaCfg)
+	client, err := sarama.NewClient(conf.Host, kafkaCfg)
+	if err != nil {
+		g.Log().Printf("sarama.NewClient failed, %v", err)
+		return nil, err
+	}
+	if conf.EnsureTopics {
+		if err := ensureTopicsOnce(cfg.Name); err != nil {
+			g.Log().Printf("kafka ensure topics failed, %v", err)
+			_ = client.Close()
+			return nil, err
+		}
+	}
+	if err := checkTopics(client, cfg.Topics); err != nil {
+		if conf.StrictTopics {
+			g.Log().Printf("kafka check topics failed, %v", err)
+			_ = client.Close()
+			return nil, err
+		}
+		g.Log().Warningf("kafka check topics failed, %s, %v", cfg.GroupName, err)
+	}
+	group, err := sarama.NewConsumerGroupFromClient(cfg.GroupName, client)
 	if err != nil {
 		g.Log().Printf("sarama.NewConsumerGroup failed, %v", err)
+		_ = client.Close()
 		return nil, err
 	}
 
-	return &Worker{cfg: cfg, receiveCb: handler, group: group}, nil
+	worker := NewWorkerWithGroup(cfg, group, handler)
+	worker.client = client
+	if cfg.Retry != nil {
+		client, err := NewClient(cfg.Name)
+		if err != nil {
+			g.Log().Printf("kafka.NewClient for retry failed, %v", err)
+			_ = group.Close()
+			_ = worker.client.Close()
+			return nil, err
+		}
+		worker.retry = &retrier{policy: cfg.Retry, group: cfg.GroupName, client: client}
+	}
+	return worker, nil
 }
 
-func (w *Worker) Start(stop <-chan bool, wait *sync.WaitGroup) error {
-	if wait != nil {
-		wait.Add(1)
+// NewWorkerWithGroup 使用已经创建好的消费组，一般用于测试，有重试策略时需要调用 SetRetryClient
+func NewWorkerWithGroup(cfg *ConsumerConf, group sarama.ConsumerGroup, handler ReceiveCtxFunc) *Worker {
+	return &Worker{cfg: cfg, receiveCb: handler, group: group, metrics: metricsOf(cfg)}
+}
+
+// Stats 消费组在当前进程中的分区统计，同组的 Worker 共用
+func (w *Worker) Stats() []PartitionStats {
+	return w.metrics.stats()
+}
+
+// SetRetryClient 设置重试和死信消息的发送客户端，Run 结束时关闭，需要在 Run 之前调用
+func (w *Worker) SetRetryClient(client *Client) {
+	if w.cfg.Retry == nil {
+		return
 	}
+	w.retry = &retrier{policy: w.cfg.Retry, group: w.cfg.GroupName, client: client}
+}
+
+// OnAssigned 注册分区分配后的回调，需要在 Run 之前调用
+func (w *Worker) OnAssigned(fn RebalanceFunc) {
+	w.onAssigned = fn
+}
+
+// OnRevoked 注册分区回收前的回调，此时分区内的消息都已处理完成，offset 尚未提交
+func (w *Worker) OnRevoked(fn RebalanceFunc) {
+	w.onRevoked = fn
+}
+
+// topics 订阅的topic，包括重试topic
+func (w *Worker) topics() []string {
+	if w.retry == nil {
+		return w.cfg.Topics
+	}
+	return append(append([]string{}, w.cfg.Topics...), w.retry.policy.topics(w.cfg.GroupName)...)
+}
+
+// Run 加入消费组开始消费，直到 ctx 结束，返回前等待处理中的消息完成并提交offset
+// ctx 结束后回调最多还能执行 DrainTimeout，之后回调的 ctx 也会结束
+// 配置错误或者消费组已经关闭时返回错误，网络等临时错误会记录日志并重试
+func (w *Worker) Run(ctx context.Context) error {
+	handlerCtx, cancel := drainContext(ctx, w.cfg.drainTimeout())
+	defer cancel()
 
 	consumer := Consumer{
-		Handler: w.receiveCb,
+		CtxHandler:   w.receiveCb,
+		BatchHandler: w.batchCb,
+		BatchSize:    w.cfg.BatchSize,
+		BatchWindow:  w.cfg.BatchWindow,
+		Concurrency:  w.cfg.Concurrency,
+		KeyFunc:      w.cfg.KeyFunc,
+		OnAssigned:   w.onAssigned,
+		OnRevoked:    w.onRevoked,
+		retry:        w.retry,
+		handlerCtx:   handlerCtx,
+		metrics:      w.metrics,
+		pipeline:     w.pipeline,
 	}
+	topics := w.topics()
 
-	closed := false
+	errorsDone := make(chan struct{})
 	go func() {
-		for {
-			if closed {
-				return
-			}
-			err := w.group.Consume(context.Background(), w.cfg.Topics, consumer)
-			if err != nil {
-				g.Log().Printf("group.break, %s, %v", w.cfg.GroupName, err)
-			}
-			time.Sleep(time.Second)
+		defer close(errorsDone)
+		for err := range w.group.Errors() {
+			g.Log().Printf("[ERROR]%s, err:%v", w.cfg.GroupName, err)
 		}
 	}()
 
+	//Run 提前返回时 ctx 可能还没有结束，关闭 client 之前先停止刷新积压
+	lagStop, lagDone := make(chan struct{}), make(chan struct{})
+	if w.client != nil {
+		go func() {
+			defer close(lagDone)
+			ticker := time.NewTicker(lagRefreshInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					w.metrics.refreshHighWater(w.client)
+				case <-lagStop:
+					return
+				}
+			}
+		}()
+	} else {
+		close(lagDone)
+	}
+
+	var runErr error
+	g.Log().Printf("worker run, %s", w.cfg.GroupName)
+	for ctx.Err() == nil {
+		err := w.group.Consume(ctx, topics, consumer)
+		if err == nil {
+			continue //重新平衡，加入新的会话
+		}
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			runErr = err
+			break
+		}
+		var cfgErr sarama.ConfigurationError
+		if errors.As(err, &cfgErr) {
+			runErr = err
+			break
+		}
+		g.Log().Printf("group.break, %s, %v", w.cfg.GroupName, err)
+		_ = sleep(ctx, time.Second)
+	}
+
+	g.Log().Printf("close worker, %s", w.cfg.GroupName)
+	if err := w.group.Close(); err != nil && !errors.Is(err, sarama.ErrClosedConsumerGroup) {
+		g.Log().Printf("Error closing client: %v", err)
+		if runErr == nil {
+			runErr = err
+		}
+	}
+	<-errorsDone
+	close(lagStop)
+	<-lagDone
+	if w.client != nil {
+		_ = w.client.Close()
+	}
+	if w.retry != nil {
+		_ = w.retry.client.Close()
+	}
+	if w.pipeline != nil {
+		w.pipeline.close()
+	}
+	g.Log().Printf("worker closed, %s", w.cfg.GroupName)
+	return runErr
+}
+
+// Start 兼容旧的启动方式，stop 收到数据后停止，wait 在完全关闭后 Done，新代码请使用 Run
+func (w *Worker) Start(stop <-chan bool, wait *sync.WaitGroup) error {
+	if wait != nil {
+		wait.Add(1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		<-stop
+	}()
 	go func() {
 		defer func() {
 			if wait != nil {
 				wait.Done()
 			}
 		}()
-
-		g.Log().Printf("worker wait for control, %s", w.cfg.GroupName)
-		for {
-			select {
-			case <-stop:
-				g.Log().Printf("close worker, %s", w.cfg.GroupName)
-				closed = true
-				if err := w.group.Close(); err != nil {
-					g.Log().Printf("Error closing client: %v", err)
-				}
-				g.Log().Printf("worker closed, %s", w.cfg.GroupName)
-				return
-			case err := <-w.group.Errors(): // Track errors
-				g.Log().Printf("[ERROR]%s, err:%v", w.cfg.GroupName, err)
-			}
+		if err := w.Run(ctx); err != nil {
+			g.Log().Printf("worker run failed, %s, %v", w.cfg.GroupName, err)
 		}
 	}()
-
 	return nil
 }
 
-// Consumer kafka消费定义
+// drainContext 回调使用的ctx，parent 结束后再等 timeout 才结束，让处理中的消息有机会完成
+// 只继承结束信号，不继承 parent 中的值
+func drainContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-parent.Done():
+		case <-ctx.Done():
+			return
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Consumer kafka消费定义，CtxHandler 优先于 Handler，BatchHandler 不为nil时按批消费
 type Consumer struct {
-	Handler ReceiveFunc
+	Handler      ReceiveFunc
+	CtxHandler   ReceiveCtxFunc
+	BatchHandler ReceiveBatchFunc
+	BatchSize    int           //见 ConsumerConf
+	BatchWindow  time.Duration //见 ConsumerConf
+	Concurrency  int           //分区内并发数，见 ConsumerConf
+	KeyFunc      KeyFunc       //分发的key，见 ConsumerConf
+	OnAssigned   RebalanceFunc //分区分配后回调
+	OnRevoked    RebalanceFunc //分区回收前回调
+	retry        *retrier
+	handlerCtx   context.Context //回调使用的ctx，nil 时使用会话的ctx
+	metrics      *consumerMetrics
+	pipeline     *pipeline
 }
 
 // Setup kafka连接后回调
-func (serv Consumer) Setup(_ sarama.ConsumerGroupSession) error {
-	//g.Log().Println("kafka to Setup")
+func (serv Consumer) Setup(sess sarama.ConsumerGroupSession) error {
+	g.Log().Printf("kafka partitions assigned, member:%s, generation:%d, claims:%v", sess.MemberID(), sess.GenerationID(), sess.Claims())
+	if serv.OnAssigned != nil {
+		return serv.OnAssigned(sess.Context(), sess.Claims())
+	}
 	return nil
 }
 
-// Cleanup kafka关闭后回调
-func (serv Consumer) Cleanup(_ sarama.ConsumerGroupSession) error {
-	//g.Log().Println("kafka to Cleanup")
-	return nil
+// Cleanup kafka关闭后回调，所有分区的消息都已处理完成，提交offset
+func (serv Consumer) Cleanup(sess sarama.ConsumerGroupSession) error {
+	var err error
+	if serv.OnRevoked != nil {
+		err = serv.OnRevoked(sess.Context(), sess.Claims())
+	}
+	sess.Commit()
+	g.Log().Printf("kafka partitions revoked, member:%s, generation:%d", sess.MemberID(), sess.GenerationID())
+	return err
 }
 
 // ConsumeClaim kafka消费回调
 func (serv Consumer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	stats := serv.metrics.claim(claim)
+	defer serv.metrics.release(stats)
+	if serv.pipeline != nil {
+		return serv.pipeline.consumeClaim(serv, sess, claim)
+	}
+	if serv.BatchHandler != nil {
+		return serv.consumeBatch(sess, claim)
+	}
+	if serv.Concurrency > 1 {
+		return serv.consumeParallel(sess, claim)
+	}
 	for msg := range claim.Messages() {
-		err := serv.Handler(msg)
+		//会话已经结束，剩下的消息不再处理，之后重新消费
+		if sess.Context().Err() != nil {
+			return nil
+		}
+		err := serv.process(sess.Context(), msg)
 		if err != nil {
 			return err
 		}
 		sess.MarkMessage(msg, "")
+		serv.metrics.mark(msg.Topic, msg.Partition, msg.Offset+1)
 	}
 	return nil
 }
+
+// process 有重试策略时按策略处理失败，返回nil表示可以提交
+func (serv Consumer) process(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	if serv.retry == nil {
+		return serv.handle(ctx, msg)
+	}
+	return serv.retry.process(ctx, msg, serv.handle)
+}
+
+// handle 从消息头还原上下文后调用回调
+func (serv Consumer) handle(ctx context.Context, msg *sarama.ConsumerMessage) (err error) {
+	start := time.Now()
+	defer func() {
+		serv.metrics.observe(msg, start, err)
+	}()
+	if serv.CtxHandler == nil && serv.BatchHandler == nil {
+		return serv.Handler(msg)
+	}
+	if serv.handlerCtx != nil {
+		ctx = serv.handlerCtx
+	}
+	ctx, span := ContextFromMessage(ctx, msg)
+	if serv.CtxHandler != nil {
+		err = serv.CtxHandler(ctx, msg)
+	} else {
+		err = serv.handleSingle(ctx, msg)
+	}
+	if span != nil {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.SetTag("error.message", err.Error())
+		}
+		span.Finish()
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeGroup 每次 Consume 模拟一次会话，直到 ctx 结束
+type fakeGroup struct {
+	errs     chan error
+	consume  func(ctx context.Context, handler sarama.ConsumerGroupHandler) error
+	sessions int
+	closed   bool
+}
+
+func newFakeGroup(consume func(ctx context.Context, handler sarama.ConsumerGroupHandler) error) *fakeGroup {
+	return &fakeGroup{errs: make(chan error), consume: consume}
+}
+
+func (f *fakeGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	f.sessions++
+	return f.consume(ctx, handler)
+}
+func (f *fakeGroup) Errors() <-chan error { return f.errs }
+func (f *fakeGroup) Close() error {
+	if f.closed {
+		return sarama.ErrClosedConsumerGroup
+	}
+	f.closed = true
+	close(f.errs)
+	return nil
+}
+func (f *fakeGroup) Pause(partitions map[string][]int32)  {}
+func (f *fakeGroup) Resume(partitions map[string][]int32) {}
+func (f *fakeGroup) PauseAll()                            {}
+func (f *fakeGroup) ResumeAll()                           {}
+
+func TestConsumerRebalanceHooks(t *testing.T) {
+	claims := map[string][]int32{"topic": {0, 1}}
+	var assigned, revoked map[string][]int32
+	consumer := Consumer{
+		OnAssigned: func(ctx context.Context, c map[string][]int32) error {
+			assigned = c
+			return nil
+		},
+		OnRevoked: func(ctx context.Context, c map[string][]int32) error {
+			revoked = c
+			return errors.New("revoke failed")
+		},
+	}
+	sess := &fakeSession{claims: claims}
+	if err := consumer.Setup(sess); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := consumer.Cleanup(sess); err == nil {
+		t.Errorf("Cleanup() should return the hook error")
+	}
+	if !reflect.DeepEqual(assigned, claims) || !reflect.DeepEqual(revoked, claims) {
+		t.Errorf("assigned = %v, revoked = %v, want %v", assigned, revoked, claims)
+	}
+	if sess.committed != 1 {
+		t.Errorf("committed = %d, want 1 even if the hook failed", sess.committed)
+	}
+}
+
+func TestConsumeClaimStopsWhenSessionDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := 0
+	consumer := Consumer{
+		CtxHandler: func(_ context.Context, msg *sarama.ConsumerMessage) error {
+			handled++
+			cancel() //第一条处理中会话结束
+			return nil
+		},
+	}
+	sess := &fakeSession{ctx: ctx}
+	if err := consumer.ConsumeClaim(sess, newFakeClaim("a", "b", "c")); err != nil {
+		t.Fatalf("ConsumeClaim() error = %v", err)
+	}
+	if handled != 1 || sess.markedOffset() != 1 {
+		t.Errorf("handled = %d, marked = %d, want 1, 1", handled, sess.markedOffset())
+	}
+}
+
+func TestWorkerRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var drainErr error
+	group := newFakeGroup(func(ctx context.Context, handler sarama.ConsumerGroupHandler) error {
+		sess := &fakeSession{ctx: ctx}
+		if err := handler.Setup(sess); err != nil {
+			return err
+		}
+		_ = handler.ConsumeClaim(sess, newFakeClaim("a"))
+		<-ctx.Done()
+		return handler.Cleanup(sess)
+	})
+	worker := NewWorkerWithGroup(&ConsumerConf{GroupName: "group", Topics: []string{"topic"}, DrainTimeout: time.Second}, group,
+		func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			//停止后回调的ctx在 DrainTimeout 之后才结束
+			cancel()
+			time.Sleep(10 * time.Millisecond)
+			drainErr = ctx.Err()
+			return nil
+		})
+	assigned := 0
+	worker.OnAssigned(func(ctx context.Context, claims map[string][]int32) error {
+		assigned++
+		return nil
+	})
+	if err := worker.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if assigned != 1 || group.sessions != 1 || !group.closed {
+		t.Errorf("assigned = %d, sessions = %d, closed = %v", assigned, group.sessions, group.closed)
+	}
+	if drainErr != nil {
+		t.Errorf("handler ctx error = %v, want nil while draining", drainErr)
+	}
+}
+
+func TestWorkerRunConfigurationError(t *testing.T) {
+	group := newFakeGroup(func(ctx context.Context, handler sarama.ConsumerGroupHandler) error {
+		return sarama.ConfigurationError("no topics provided")
+	})
+	worker := NewWorkerWithGroup(&ConsumerConf{GroupName: "group"}, group, nil)
+	err := worker.Run(context.Background())
+	var cfgErr sarama.ConfigurationError
+	if !errors.As(err, &cfgErr) || group.sessions != 1 || !group.closed {
+		t.Errorf("Run() error = %v, sessions = %d, closed = %v", err, group.sessions, group.closed)
+	}
+}
+
+func TestDrainContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, stop := drainContext(parent, 10*time.Millisecond)
+	defer stop()
+	cancel()
+	select {
+	case <-ctx.Done():
+		t.Fatalf("drain ctx done before the timeout")
+	case <-time.After(5 * time.Millisecond):
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("drain ctx not done after the timeout")
+	}
+}
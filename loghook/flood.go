@@ -0,0 +1,256 @@
+package loghook
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/frame/g"
+	"github.com/gogf/gf/os/glog"
+)
+
+// FloodRule 一个级别的防刷规则，同一个模板的日志每个周期内前 Burst 条全部输出，之后每 Sample 条输出1条
+type FloodRule struct {
+	Burst  int //默认10
+	Sample int //默认100，小于0表示超过 Burst 后全部丢弃
+}
+
+// FloodConf 日志防刷，配置 server.LogFlood
+//
+//	[server.LogFlood]
+//	IntervalMs = 10000
+//	[server.LogFlood.Levels]
+//	error = {Burst = 10, Sample = 100}
+//	warn  = {Burst = 20, Sample = 100}
+type FloodConf struct {
+	IntervalMs int                  //统计周期，默认10000
+	MaxKeys    int                  //一个周期内最多统计多少个模板，超过后新的模板不限制，默认10000
+	Levels     map[string]FloodRule //级别 => 规则，级别同json日志的 level；为空时限制 warn 以上，没有配置的级别不限制
+}
+
+// defaultFloodLevels 没有配置时限制的级别
+var defaultFloodLevels = map[string]FloodRule{
+	"warn":     {},
+	"error":    {},
+	"critical": {},
+}
+
+func (c *FloodConf) interval() time.Duration {
+	if c.IntervalMs > 0 {
+		return time.Duration(c.IntervalMs) * time.Millisecond
+	}
+	return 10 * time.Second
+}
+
+func (c *FloodConf) maxKeys() int {
+	if c.MaxKeys > 0 {
+		return c.MaxKeys
+	}
+	return 10000
+}
+
+func (c *FloodConf) rule(level string) (FloodRule, bool) {
+	levels := c.Levels
+	if len(levels) == 0 {
+		levels = defaultFloodLevels
+	}
+	rule, ok := levels[level]
+	if rule.Burst <= 0 {
+		rule.Burst = 10
+	}
+	if rule.Sample == 0 {
+		rule.Sample = 100
+	}
+	return rule, ok
+}
+
+// floodConfig 读取配置 server.LogFlood
+func floodConfig() *FloodConf {
+	conf := &FloodConf{}
+	if err := g.Cfg().GetStruct("server.LogFlood", conf); err != nil {
+		g.Log().Warningf("loghook flood config error, %v", err)
+	}
+	return conf
+}
+
+// floodCounter 一个模板在当前周期内的统计
+type floodCounter struct {
+	count      int
+	suppressed int
+	level      int
+	message    string       //最后一条被丢弃的日志，周期结束时作为汇总输出
+	logger     *glog.Logger //输出汇总使用
+}
+
+// flood 按模板统计日志条数，周期结束时输出被丢弃日志的汇总
+type flood struct {
+	conf atomic.Value //*FloodConf，Setup 时替换
+
+	mu       sync.Mutex
+	counters map[string]*floodCounter
+}
+
+type floodSummaryKey struct{}
+
+var (
+	// defaultFlood Setup 使用的实例，多次 Setup 只替换配置，所有logger共用一个统计协程
+	defaultFlood     = newFlood(&FloodConf{})
+	defaultFloodOnce sync.Once
+)
+
+// FloodHandler glog的处理器，按模板限制日志条数，需要放在输出日志的处理器之前
+// 同一个模板每个周期只保留第一条的堆栈，被丢弃的日志在周期结束时汇总成一条 repeated X times
+// 每次调用都会启动一个统计协程，ctx 结束时输出最后一次汇总后退出；Setup 使用的是共享的实例，不需要再调用
+func FloodHandler(ctx context.Context, conf *FloodConf) glog.Handler {
+	f := newFlood(conf)
+	go f.run(ctx)
+	return f.handle
+}
+
+// setupFlood 更新共享实例的配置，第一次调用时启动统计协程
+func setupFlood(conf *FloodConf) glog.Handler {
+	defaultFlood.conf.Store(conf)
+	defaultFloodOnce.Do(func() {
+		go defaultFlood.run(context.Background())
+	})
+	return defaultFlood.handle
+}
+
+func newFlood(conf *FloodConf) *flood {
+	f := &flood{counters: make(map[string]*floodCounter)}
+	f.conf.Store(conf)
+	return f
+}
+
+func (f *flood) config() *FloodConf {
+	return f.conf.Load().(*FloodConf)
+}
+
+// run 每个周期输出一次汇总，周期使用最新的配置，ctx 结束时退出
+func (f *flood) run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(f.config().interval())
+		select {
+		case <-timer.C:
+			f.flush()
+		case <-ctx.Done():
+			timer.Stop()
+			f.flush()
+			return
+		}
+	}
+}
+
+func (f *flood) handle(ctx context.Context, in *glog.HandlerInput) {
+	content, stack := splitStack(in.Content)
+	//汇总日志不限制，也不需要堆栈
+	if ctx != nil && ctx.Value(floodSummaryKey{}) != nil {
+		in.Content = content
+		in.Next()
+		return
+	}
+	pass, keepStack := f.allow(in.Logger, in.Level, in.CallerPath, content)
+	if !pass {
+		return
+	}
+	if !keepStack && len(stack) > 0 {
+		in.Content = content
+	}
+	in.Next()
+}
+
+// allow 返回日志是否输出以及是否保留堆栈
+func (f *flood) allow(logger *glog.Logger, level int, caller, content string) (pass bool, keepStack bool) {
+	conf := f.config()
+	rule, ok := conf.rule(levelOf(level, content))
+	if !ok {
+		return true, true
+	}
+	key := caller + " " + template(content)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.counters[key]
+	if c == nil {
+		if len(f.counters) >= conf.maxKeys() {
+			return true, false
+		}
+		c = &floodCounter{level: level, logger: logger}
+		f.counters[key] = c
+	}
+	c.count++
+	if c.count <= rule.Burst {
+		return true, c.count == 1
+	}
+	if rule.Sample > 0 && (c.count-rule.Burst)%rule.Sample == 0 {
+		return true, false
+	}
+	c.suppressed++
+	c.message = content
+	return false, false
+}
+
+// flush 结束当前周期，输出被丢弃日志的汇总
+func (f *flood) flush() {
+	f.mu.Lock()
+	counters := f.counters
+	f.counters = make(map[string]*floodCounter, len(counters))
+	f.mu.Unlock()
+
+	ctx := context.WithValue(context.Background(), floodSummaryKey{}, true)
+	for _, c := range counters {
+		if c.suppressed == 0 {
+			continue
+		}
+		msg := fmt.Sprintf("%s [repeated %d times in %v]", firstLine(c.message), c.suppressed, f.config().interval())
+		//Ctx 会修改子logger的ctx，使用自己的副本
+		logAt(c.logger.Clone().Ctx(ctx), c.level, msg)
+	}
+}
+
+var (
+	templateNumber = regexp.MustCompile(`\d+`)
+	templateHex    = regexp.MustCompile(`(?i)\b[0-9a-f#]{8,}\b`)
+)
+
+// template 日志模板，数字和较长的十六进制串替换成#，忽略之后的行
+func template(content string) string {
+	s := firstLine(content)
+	if len(s) > 256 {
+		s = s[:256]
+	}
+	s = templateNumber.ReplaceAllString(s, "#")
+	return templateHex.ReplaceAllString(s, "#")
+}
+
+func firstLine(s string) string {
+	s = strings.TrimLeft(s, "\n")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// logAt 按原来的级别输出
+func logAt(logger *glog.Logger, level int, msg string) {
+	switch level {
+	case glog.LEVEL_DEBU:
+		logger.Debug(msg)
+	case glog.LEVEL_INFO:
+		logger.Info(msg)
+	case glog.LEVEL_NOTI:
+		logger.Notice(msg)
+	case glog.LEVEL_WARN:
+		logger.Warning(msg)
+	case glog.LEVEL_ERRO:
+		logger.Error(msg)
+	case glog.LEVEL_CRIT:
+		logger.Critical(msg)
+	default:
+		logger.Print(msg)
+	}
+}
@@ -0,0 +1,102 @@
+package loghook
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogf/gf/os/glog"
+)
+
+func TestFloodAllow(t *testing.T) {
+	f := newFlood(&FloodConf{Levels: map[string]FloodRule{"error": {Burst: 2, Sample: 3}}})
+	var passed, stacks int
+	for i := 0; i < 10; i++ {
+		pass, keepStack := f.allow(nil, glog.LEVEL_ERRO, "redis.go:10:", "redisCli.Get failed key=user:"+strings.Repeat("1", i+1))
+		if pass {
+			passed++
+		}
+		if keepStack {
+			stacks++
+		}
+	}
+	//前2条，之后每3条1条
+	if passed != 4 || stacks != 1 {
+		t.Errorf("passed = %d, stacks = %d", passed, stacks)
+	}
+	if c := f.counters["redis.go:10: redisCli.Get failed key=user:#"]; c == nil || c.suppressed != 6 {
+		t.Errorf("counters = %v", f.counters)
+	}
+	//没有配置的级别不限制
+	for i := 0; i < 5; i++ {
+		if pass, keepStack := f.allow(nil, glog.LEVEL_WARN, "a.go:1:", "slow"); !pass || !keepStack {
+			t.Fatalf("warn allow() = %v, %v", pass, keepStack)
+		}
+	}
+}
+
+func TestFloodHandler(t *testing.T) {
+	var buf bytes.Buffer
+	f := newFlood(&FloodConf{IntervalMs: 1000, Levels: map[string]FloodRule{"error": {Burst: 1, Sample: -1}}})
+	logger := glog.New()
+	logger.SetHeaderPrint(true)
+	logger.SetFlags(glog.F_FILE_SHORT)
+	logger.SetStack(true)
+	logger.SetHandlers(f.handle, TextHandler("SlpTest"))
+	logger.SetWriter(&buf)
+
+	for i := 0; i < 5; i++ {
+		logger.Errorf("redisCli.Get failed, %d", i)
+	}
+	f.flush()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	if !strings.Contains(lines[0], "redisCli.Get failed, 0，Stack: [") {
+		t.Errorf("first line = %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "[ERRO]") || !strings.Contains(lines[1], "redisCli.Get failed, 4 [repeated 4 times in 1s]") ||
+		strings.Contains(lines[1], "Stack") {
+		t.Errorf("summary line = %s", lines[1])
+	}
+}
+
+func TestFloodHandlerStop(t *testing.T) {
+	var buf bytes.Buffer
+	logger := glog.New()
+	logger.SetWriter(&buf)
+	ctx, cancel := context.WithCancel(context.Background())
+	f := newFlood(&FloodConf{IntervalMs: 60000, Levels: map[string]FloodRule{"error": {Burst: 1, Sample: -1}}})
+	done := make(chan struct{})
+	go func() {
+		f.run(ctx)
+		close(done)
+	}()
+	f.allow(logger, glog.LEVEL_ERRO, "a.go:1:", "failed")
+	f.allow(logger, glog.LEVEL_ERRO, "a.go:1:", "failed")
+	//ctx 结束时统计协程退出，并输出最后的汇总
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("run() not stopped")
+	}
+	if !strings.Contains(buf.String(), "failed [repeated 1 times in 1m0s]") {
+		t.Errorf("summary = %q", buf.String())
+	}
+}
+
+func TestSetupFlood(t *testing.T) {
+	defer setupFlood(&FloodConf{})
+	first := &FloodConf{IntervalMs: 60000}
+	second := &FloodConf{IntervalMs: 60000, MaxKeys: 1}
+	setupFlood(first)
+	setupFlood(second)
+	//多次 Setup 共用一个实例，只替换配置
+	if defaultFlood.config() != second {
+		t.Errorf("config = %+v, want %+v", defaultFlood.config(), second)
+	}
+}
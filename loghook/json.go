@@ -0,0 +1,261 @@
+package loghook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/frame/g"
+	"github.com/gogf/gf/net/ghttp"
+	"github.com/gogf/gf/os/glog"
+	"github.com/gogf/gf/text/gregex"
+
+	"github.com/olaola-chat/slp-library/redact"
+	context2 "github.com/olaola-chat/slp-library/server/http/context"
+	"github.com/olaola-chat/slp-library/tracer/wrap"
+)
+
+// 日志格式，配置 server.LogFormat，默认 text
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Fields 附加到日志中的字段
+type Fields map[string]interface{}
+
+type fieldsKey struct{}
+
+// WithFields 把字段放到ctx中，之后使用这个ctx打印的json日志都会带上，和已有的字段合并
+func WithFields(ctx context.Context, fields Fields) context.Context {
+	merged := make(Fields)
+	if parent, ok := ctx.Value(fieldsKey{}).(Fields); ok {
+		for k, v := range parent {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Ctx 带上下文的日志，json格式时自动带上ctx中的 TraceId、UID、路由和 WithFields 设置的字段
+//
+//	loghook.Ctx(ctx, loghook.Fields{"room_id": rid}).Warningf("enter room failed, %v", err)
+func Ctx(ctx context.Context, fields ...Fields) *glog.Logger {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, f := range fields {
+		ctx = WithFields(ctx, f)
+	}
+	return g.Log().Ctx(ctx)
+}
+
+// Setup 按配置设置 logger 的输出，server.LogFormat 为 json 时输出结构化日志，否则输出和 LogWriter 相同的文本
+// 按 server.LogFlood 限制重复的日志，见 FloodHandler；配置了 server.LogSinks 时输出到这些地方，见 SinkConf
+// 日志内容和 Fields 按 redact 的规则脱敏；logger 原来的级别作为基础级别，可以用 SetLevel、SetLevels 按包或用户临时调整
+// Setup 会开启 logger 的 SetStack，错误日志总是带调用方的堆栈，调用前不需要设置
+func Setup(logger *glog.Logger, serverName string) {
+	//错误日志的堆栈在打印时同步获取，异步输出时也是调用方的堆栈
+	logger.SetStack(true)
+	defaultLevels.setup(logger)
+	format := g.Cfg().GetString("server.LogFormat")
+	output := TextHandler(serverName)
+	if strings.EqualFold(format, FormatJSON) {
+		output = JSONHandler(serverName)
+	}
+	if confs := sinksConfig(); len(confs) > 0 {
+		sinks, err := NewSinks(serverName, format, confs)
+		if err != nil {
+			g.Log().Errorf("loghook sinks error, use logger config, %v", err)
+		} else {
+			output = sinks.Handler()
+			setSinks(sinks)
+		}
+	}
+	logger.SetHandlers(defaultLevels.handle, setupFlood(floodConfig()), output)
+	logger.SetWriter(newConfigLogger())
+}
+
+var (
+	sinksMu sync.Mutex
+	current *Sinks //Setup 创建的输出
+)
+
+// setSinks 替换 Setup 创建的输出，关闭之前的
+func setSinks(sinks *Sinks) {
+	sinksMu.Lock()
+	prev := current
+	current = sinks
+	sinksMu.Unlock()
+	if prev != nil {
+		_ = prev.Close(time.Second)
+	}
+}
+
+// Close 进程退出前调用，等待 Setup 创建的输出写完缓冲中的日志
+func Close(timeout time.Duration) error {
+	sinksMu.Lock()
+	sinks := current
+	current = nil
+	sinksMu.Unlock()
+	if sinks == nil {
+		return nil
+	}
+	return sinks.Close(timeout)
+}
+
+// Entry 一条json日志的固定字段，Fields 中的字段平铺在同一层
+type Entry struct {
+	Time    string   `json:"time"`
+	Level   string   `json:"level"`
+	Msg     string   `json:"msg"`
+	Caller  string   `json:"caller,omitempty"`
+	Service string   `json:"service"`
+	TraceID string   `json:"trace_id,omitempty"`
+	UID     uint32   `json:"uid,omitempty"`
+	Route   string   `json:"route,omitempty"`
+	Stack   []string `json:"stack,omitempty"`
+	Fields  Fields   `json:"-"`
+}
+
+// reservedKeys Entry 固定字段的名字，Fields 中同名的字段会被忽略
+var reservedKeys = map[string]bool{
+	"time": true, "level": true, "msg": true, "caller": true, "service": true,
+	"trace_id": true, "uid": true, "route": true, "stack": true,
+}
+
+// MarshalJSON 固定字段在前，其他字段按名字排序
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	type entry Entry
+	head, err := json.Marshal((*entry)(e))
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Fields) == 0 {
+		return head, nil
+	}
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		if !reservedKeys[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(head[:len(head)-1])
+	for _, k := range keys {
+		value, err := json.Marshal(e.Fields[k])
+		if err != nil {
+			value, _ = json.Marshal(err.Error())
+		}
+		key, _ := json.Marshal(k)
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// NewEntry 根据ctx生成日志的公共字段
+func NewEntry(ctx context.Context, serverName string) *Entry {
+	e := &Entry{Service: serverName}
+	if ctx == nil {
+		return e
+	}
+	if traceID, ok := ctx.Value(wrap.TrackKey).(string); ok {
+		e.TraceID = traceID
+	}
+	if user := context2.ContextSrv.GetUserCtx(ctx); user != nil {
+		e.UID = user.UID
+	}
+	if r := ghttp.RequestFromCtx(ctx); r != nil {
+		if r.Router != nil {
+			e.Route = r.Router.Uri
+		} else if r.URL != nil {
+			e.Route = r.URL.Path
+		}
+	}
+	if fields, ok := ctx.Value(fieldsKey{}).(Fields); ok {
+		e.Fields = redact.Map(fields)
+	}
+	return e
+}
+
+// levelNames glog级别对应的json级别
+var levelNames = map[int]string{
+	glog.LEVEL_DEBU: "debug",
+	glog.LEVEL_INFO: "info",
+	glog.LEVEL_NOTI: "notice",
+	glog.LEVEL_WARN: "warn",
+	glog.LEVEL_ERRO: "error",
+	glog.LEVEL_CRIT: "critical",
+	glog.LEVEL_PANI: "panic",
+	glog.LEVEL_FATA: "fatal",
+}
+
+// levelPrefixes Print 打印的日志按内容开头的 [ERROR]、[WARN] 等判断级别
+var levelPrefixes = map[string]string{
+	"DEBU": "debug", "INFO": "info", "NOTI": "notice", "WARN": "warn",
+	"ERRO": "error", "CRIT": "critical", "PANI": "panic", "FATA": "fatal",
+}
+
+// levelOf 日志级别，Print 打印的没有级别，按内容判断，默认 info
+func levelOf(level int, content string) string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	if match, _ := gregex.MatchString(`^\s*\[(DEBU|INFO|NOTI|WARN|ERRO|CRIT|PANI|FATA)`, content); len(match) > 1 {
+		return levelPrefixes[match[1]]
+	}
+	return "info"
+}
+
+// splitStack 拆出 SetStack(true) 时glog追加在内容后面的堆栈
+func splitStack(content string) (string, []string) {
+	i := strings.Index(content, "\nStack:\n")
+	if i < 0 {
+		return strings.TrimRight(content, "\n"), nil
+	}
+	var stack []string
+	for _, line := range strings.Split(strings.Trim(content[i+len("\nStack:\n"):], "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			stack = append(stack, line)
+		}
+	}
+	return strings.TrimRight(content[:i], " \n"), stack
+}
+
+// JSONHandler glog的处理器，把日志编码成一行json，由 logger 原来的输出写出
+func JSONHandler(serverName string) glog.Handler {
+	return func(ctx context.Context, in *glog.HandlerInput) {
+		in.Buffer.Reset()
+		in.Buffer.Write(jsonLine(ctx, in, serverName))
+		in.Next()
+	}
+}
+
+// jsonLine 编码成一行json，以换行结尾
+func jsonLine(ctx context.Context, in *glog.HandlerInput, serverName string) []byte {
+	e := NewEntry(ctx, serverName)
+	e.Time = in.Time.Format(time.RFC3339Nano)
+	e.Level = levelOf(in.Level, in.Content)
+	e.Msg, e.Stack = splitStack(in.Content)
+	e.Msg = redact.String(e.Msg)
+	e.Caller = strings.TrimSuffix(in.CallerPath, ":")
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		data, _ = json.Marshal(&Entry{Time: e.Time, Level: e.Level, Msg: e.Msg, Service: serverName})
+	}
+	return append(data, '\n')
+}
@@ -0,0 +1,98 @@
+package loghook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gogf/gf/os/glog"
+
+	context2 "github.com/olaola-chat/slp-library/server/http/context"
+	"github.com/olaola-chat/slp-library/tracer/wrap"
+)
+
+func newJSONLogger(buf *bytes.Buffer) *glog.Logger {
+	logger := glog.New()
+	logger.SetHeaderPrint(true)
+	logger.SetFlags(glog.F_FILE_SHORT)
+	logger.SetStack(true)
+	logger.SetHandlers(JSONHandler("SlpTest"))
+	logger.SetWriter(buf)
+	return logger
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var res []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("line %q is not json, %v", line, err)
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+func TestJSONHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newJSONLogger(&buf)
+
+	ctx := context.WithValue(context.Background(), wrap.TrackKey, "trace-1")
+	ctx = context.WithValue(ctx, context2.ContextUserKey, &context2.ContextUser{UID: 42})
+	ctx = WithFields(ctx, Fields{"room_id": 7, "msg": "ignored"})
+	ctx = WithFields(ctx, Fields{"op": "enter"})
+	logger.Ctx(ctx).Warningf("enter room %d failed", 7)
+	logger.Printf("[ERROR] legacy line")
+	logger.Error("boom")
+
+	lines := decodeLines(t, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("lines = %v", lines)
+	}
+	first := lines[0]
+	want := map[string]interface{}{
+		"level": "warn", "msg": "enter room 7 failed", "service": "SlpTest",
+		"trace_id": "trace-1", "uid": float64(42), "room_id": float64(7), "op": "enter",
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(first[k], v) {
+			t.Errorf("%s = %v, want %v", k, first[k], v)
+		}
+	}
+	if caller, _ := first["caller"].(string); !strings.HasPrefix(caller, "json_test.go:") {
+		t.Errorf("caller = %v", first["caller"])
+	}
+	if lines[1]["level"] != "error" || lines[1]["stack"] != nil {
+		t.Errorf("legacy line = %v", lines[1])
+	}
+	if stack, _ := lines[2]["stack"].([]interface{}); lines[2]["msg"] != "boom" || len(stack) == 0 {
+		t.Errorf("error line = %v", lines[2])
+	}
+}
+
+func TestEntryMarshalJSON(t *testing.T) {
+	e := &Entry{Time: "t", Level: "info", Msg: "m", Service: "s", Fields: Fields{"b": 1, "a": "x", "level": "debug"}}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"time":"t","level":"info","msg":"m","service":"s","a":"x","b":1}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
+
+func TestJSONHandlerRedact(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newJSONLogger(&buf)
+	ctx := WithFields(context.Background(), Fields{"mobile": "13812345678", "password": "p"})
+	logger.Ctx(ctx).Infof("login token=%s", "abc")
+
+	line := decodeLines(t, &buf)[0]
+	if line["msg"] != "login token=***" || line["mobile"] != "138****678" || line["password"] != "***" {
+		t.Errorf("line = %v", line)
+	}
+}
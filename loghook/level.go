@@ -0,0 +1,446 @@
+package loghook
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/encoding/gjson"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/os/glog"
+
+	context2 "github.com/olaola-chat/slp-library/server/http/context"
+)
+
+// 运行时调整级别的有效期
+const (
+	DefaultLevelTTL = 30 * time.Minute //SetLevel、SetLevels 没有指定有效期时使用
+	MaxLevelTTL     = 24 * time.Hour   //SetLevel、SetLevels 最长的有效期
+)
+
+// 规则的来源
+const (
+	LevelSourceAcm   = "acm"
+	LevelSourceAdmin = "admin"
+)
+
+// LevelRule 运行时调整的日志级别
+// Target 匹配调用方的包路径前缀，如 github.com/olaola-chat/slp-library/redis，也可以是 logger 的前缀(SetPrefix)
+// 多条规则匹配时 Target 最长的生效；UID 规则只能让这个用户的请求输出更多日志
+type LevelRule struct {
+	Target string    `json:"target,omitempty"` //为空表示所有日志
+	UID    uint32    `json:"uid,omitempty"`    //不为0时只对这个用户的请求生效
+	Level  string    `json:"level"`            //最低级别，同json日志的 level
+	Until  time.Time `json:"until,omitempty"`  //失效时间，零值表示不失效
+	Source string    `json:"source,omitempty"`
+}
+
+// levelRule 编译后的规则
+type levelRule struct {
+	LevelRule
+	mask int
+}
+
+func (r *levelRule) matches(prefix, pkg string) bool {
+	if r.Target == "" || r.Target == prefix {
+		return true
+	}
+	return pkg == r.Target || strings.HasPrefix(pkg, r.Target+"/")
+}
+
+// levelState 处理日志时读取的快照，整体替换
+type levelState struct {
+	base  int
+	rules []*levelRule
+}
+
+// levels 按包和用户调整日志级别，有规则时 logger 输出规则需要的级别，由 handle 过滤
+// 没有规则时 logger 保持基础级别，不需要的日志在格式化之前就被丢弃
+type levels struct {
+	state atomic.Value //*levelState
+
+	mu         sync.Mutex
+	ready      bool
+	hideCaller bool //调用方函数名是为了匹配包路径加上的，输出时去掉
+	base       int
+	acm        []*levelRule
+	admin      []*levelRule
+	loggers    []*glog.Logger //setup 过的 logger，规则变化时调整级别
+	expire     *time.Timer    //最早的规则过期时恢复 logger 的级别
+	now        func() time.Time
+}
+
+var defaultLevels = newLevels()
+
+func newLevels() *levels {
+	l := &levels{base: glog.LEVEL_ALL, now: time.Now}
+	l.state.Store(&levelState{base: l.base})
+	return l
+}
+
+// setup 记录 logger 原来的级别作为基础级别，之后由规则调整 logger 的级别
+// 进程内多次 Setup 时以第一次为准
+func (l *levels) setup(logger *glog.Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.ready {
+		l.ready = true
+		l.base = logger.GetLevel()
+		l.hideCaller = logger.GetFlags()&glog.F_CALLER_FN == 0
+	}
+	for _, lg := range l.loggers {
+		if lg == logger {
+			l.store()
+			return
+		}
+	}
+	l.loggers = append(l.loggers, logger)
+	l.store()
+}
+
+// store 去掉过期的规则，更新快照并调整 logger，需要持有 mu
+func (l *levels) store() {
+	now := l.now()
+	l.acm, l.admin = unexpired(l.acm, now), unexpired(l.admin, now)
+	rules := make([]*levelRule, 0, len(l.acm)+len(l.admin))
+	rules = append(append(rules, l.acm...), l.admin...)
+	l.state.Store(&levelState{base: l.base, rules: rules})
+	l.apply(rules)
+
+	//规则过期后重新调整，没有规则时恢复成基础级别
+	if l.expire != nil {
+		l.expire.Stop()
+		l.expire = nil
+	}
+	var until time.Time
+	for _, r := range rules {
+		if !r.Until.IsZero() && (until.IsZero() || r.Until.Before(until)) {
+			until = r.Until
+		}
+	}
+	if !until.IsZero() {
+		l.expire = time.AfterFunc(until.Sub(now), func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.store()
+		})
+	}
+}
+
+// apply 按规则调整 logger：级别为基础级别加上规则需要的级别
+// 有按包匹配的规则时才获取调用方的函数名，和文件名一起获取
+func (l *levels) apply(rules []*levelRule) {
+	level, caller := l.base, false
+	for _, r := range rules {
+		level |= r.mask
+		caller = caller || r.Target != ""
+	}
+	for _, logger := range l.loggers {
+		if logger.GetLevel() != level|glog.LEVEL_CRIT|glog.LEVEL_PANI|glog.LEVEL_FATA {
+			logger.SetLevel(level)
+		}
+		if !l.hideCaller {
+			continue
+		}
+		flags := logger.GetFlags() &^ glog.F_CALLER_FN
+		if caller {
+			flags |= glog.F_CALLER_FN
+		}
+		if flags != logger.GetFlags() {
+			logger.SetFlags(flags)
+		}
+	}
+}
+
+func unexpired(rules []*levelRule, now time.Time) []*levelRule {
+	res := rules[:0:0]
+	for _, r := range rules {
+		if r.Until.IsZero() || now.Before(r.Until) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// handle glog的处理器，需要放在其他处理器之前
+func (l *levels) handle(ctx context.Context, in *glog.HandlerInput) {
+	fn := in.CallerFunc
+	if l.hideCaller {
+		in.CallerFunc = ""
+	}
+	//Print 没有级别，不过滤
+	if _, ok := levelNames[in.Level]; !ok {
+		in.Next()
+		return
+	}
+	if l.mask(ctx, in.Prefix, callerPackage(fn))&in.Level == 0 {
+		return
+	}
+	in.Next()
+}
+
+// mask 日志需要输出的级别
+func (l *levels) mask(ctx context.Context, prefix, pkg string) int {
+	st := l.state.Load().(*levelState)
+	mask := st.base
+	if len(st.rules) == 0 {
+		return mask
+	}
+	var (
+		now     = l.now()
+		longest = -1
+		uidMask int
+		uid     uint32
+		uidDone bool
+	)
+	for _, r := range st.rules {
+		if (!r.Until.IsZero() && !now.Before(r.Until)) || !r.matches(prefix, pkg) {
+			continue
+		}
+		if r.UID == 0 {
+			if len(r.Target) >= longest {
+				longest, mask = len(r.Target), r.mask
+			}
+			continue
+		}
+		if !uidDone {
+			uid, uidDone = uidOf(ctx), true
+		}
+		if uid == r.UID {
+			uidMask |= r.mask
+		}
+	}
+	return mask | uidMask
+}
+
+func uidOf(ctx context.Context) uint32 {
+	if ctx == nil {
+		return 0
+	}
+	if user := context2.ContextSrv.GetUserCtx(ctx); user != nil {
+		return user.UID
+	}
+	return 0
+}
+
+// callerPackage glog的调用方函数名中的包路径，如 [github.com/a/b.(*T).F] 返回 github.com/a/b
+func callerPackage(fn string) string {
+	fn = strings.TrimSuffix(strings.TrimPrefix(fn, "["), "]")
+	i := strings.LastIndexByte(fn, '/') + 1
+	if j := strings.IndexByte(fn[i:], '.'); j >= 0 {
+		return fn[:i+j]
+	}
+	return fn
+}
+
+// levelMask 级别名对应的glog级别掩码，包括这个级别以及更高的级别
+func levelMask(level string) (int, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	switch level {
+	case "all":
+		level = "debug"
+	case "warning":
+		level = "warn"
+	}
+	rank, ok := levelRanks[level]
+	if !ok {
+		return 0, gerror.Newf("unknown log level %q", level)
+	}
+	mask := 0
+	for l, name := range levelNames {
+		if levelRanks[name] >= rank {
+			mask |= l
+		}
+	}
+	return mask, nil
+}
+
+func compileLevel(rule LevelRule) (*levelRule, error) {
+	mask, err := levelMask(rule.Level)
+	if err != nil {
+		return nil, err
+	}
+	rule.Target = strings.TrimSpace(rule.Target)
+	return &levelRule{LevelRule: rule, mask: mask}, nil
+}
+
+// levelConf ACM中的配置，TTL 从收到配置时开始计算，Until 为本地时间 2006-01-02 15:04:05 或者 RFC3339
+// 都不配置时使用 DefaultLevelTTL，最长 MaxLevelTTL
+type levelConf struct {
+	Rules []struct {
+		Target string
+		UID    uint32
+		Level  string
+		TTL    string
+		Until  string
+	}
+}
+
+// setAcm 整体替换ACM中的规则，任何一条错误都不会替换
+func (l *levels) setAcm(content string) error {
+	conf := &levelConf{}
+	if strings.TrimSpace(content) != "" {
+		j, err := gjson.LoadContent(content)
+		if err != nil {
+			return gerror.Wrap(err, "log level config parse error")
+		}
+		if err := j.Struct(conf); err != nil {
+			return gerror.Wrap(err, "log level config parse error")
+		}
+	}
+	now := l.now()
+	rules := make([]*levelRule, 0, len(conf.Rules))
+	for _, c := range conf.Rules {
+		rule := LevelRule{Target: c.Target, UID: c.UID, Level: c.Level, Source: LevelSourceAcm, Until: now.Add(DefaultLevelTTL)}
+		switch {
+		case c.Until != "":
+			until, err := time.Parse(time.RFC3339, c.Until)
+			if err != nil {
+				if until, err = time.ParseInLocation("2006-01-02 15:04:05", c.Until, time.Local); err != nil {
+					return gerror.Newf("log level %s until %q error", c.Target, c.Until)
+				}
+			}
+			rule.Until = until
+		case c.TTL != "":
+			ttl, err := time.ParseDuration(c.TTL)
+			if err != nil || ttl <= 0 {
+				return gerror.Newf("log level %s ttl %q error", c.Target, c.TTL)
+			}
+			rule.Until = now.Add(ttl)
+		}
+		//忘记删除的配置也会失效，不会一直输出调试日志
+		if max := now.Add(MaxLevelTTL); rule.Until.After(max) {
+			rule.Until = max
+		}
+		r, err := compileLevel(rule)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, r)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acm = rules
+	l.store()
+	return nil
+}
+
+// set 增加或者替换 Target 和 UID 相同的规则
+func (l *levels) set(rule LevelRule, ttl time.Duration) (LevelRule, error) {
+	if ttl <= 0 {
+		ttl = DefaultLevelTTL
+	}
+	if ttl > MaxLevelTTL {
+		ttl = MaxLevelTTL
+	}
+	rule.Source = LevelSourceAdmin
+	rule.Until = l.now().Add(ttl)
+	r, err := compileLevel(rule)
+	if err != nil {
+		return rule, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.admin = removeLevel(l.admin, r.Target, r.UID)
+	l.admin = append(l.admin, r)
+	l.store()
+	return r.LevelRule, nil
+}
+
+func removeLevel(rules []*levelRule, target string, uid uint32) []*levelRule {
+	res := rules[:0:0]
+	for _, r := range rules {
+		if r.Target != target || r.UID != uid {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+func (l *levels) remove(target string, uid uint32) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := len(l.admin)
+	l.admin = removeLevel(l.admin, strings.TrimSpace(target), uid)
+	l.store()
+	return len(l.admin) < n
+}
+
+func (l *levels) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.admin = nil
+	l.store()
+}
+
+func (l *levels) list() (string, []LevelRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.store()
+	st := l.state.Load().(*levelState)
+	res := make([]LevelRule, 0, len(st.rules))
+	for _, r := range st.rules {
+		res = append(res, r.LevelRule)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Target != res[j].Target {
+			return res[i].Target < res[j].Target
+		}
+		return res[i].UID < res[j].UID
+	})
+	return maskName(st.base), res
+}
+
+// maskName glog级别掩码中最低的级别名
+func maskName(mask int) string {
+	for _, level := range []int{glog.LEVEL_DEBU, glog.LEVEL_INFO, glog.LEVEL_NOTI, glog.LEVEL_WARN, glog.LEVEL_ERRO, glog.LEVEL_CRIT} {
+		if mask&level > 0 {
+			return levelNames[level]
+		}
+	}
+	return levelNames[glog.LEVEL_CRIT]
+}
+
+// SetLevels 整体替换ACM中的级别规则，参数和 acm.KeyCallback 一致：
+//
+//	acm.GetAcm().ListenKey("log-level", loghook.SetLevels)
+//
+// 内容为toml/json/yaml，TTL 从收到配置时开始计算，都不配置时使用 DefaultLevelTTL，最长 MaxLevelTTL：
+//
+//	[[Rules]]
+//	Target = "github.com/olaola-chat/slp-library/redis"
+//	Level = "debug"
+//	Until = "2026-10-20 18:00:00"
+//	[[Rules]]
+//	UID = 10086
+//	Level = "debug"
+//	TTL = "1h"
+func SetLevels(content string) error {
+	return defaultLevels.setAcm(content)
+}
+
+// SetLevel 临时调整 Target 或者 UID 的日志级别，ttl 后自动失效，0 使用 DefaultLevelTTL，最长 MaxLevelTTL
+// 和已有规则的 Target、UID 都相同时替换
+func SetLevel(rule LevelRule, ttl time.Duration) (LevelRule, error) {
+	return defaultLevels.set(rule, ttl)
+}
+
+// RemoveLevel 删除 SetLevel 设置的规则，返回是否存在
+func RemoveLevel(target string, uid uint32) bool {
+	return defaultLevels.remove(target, uid)
+}
+
+// ResetLevels 删除所有 SetLevel 设置的规则，ACM中的规则不受影响
+func ResetLevels() {
+	defaultLevels.reset()
+}
+
+// Levels 基础级别和当前有效的规则
+func Levels() (string, []LevelRule) {
+	return defaultLevels.list()
+}
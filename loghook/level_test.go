@@ -0,0 +1,182 @@
+package loghook
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogf/gf/os/glog"
+
+	context2 "github.com/olaola-chat/slp-library/server/http/context"
+)
+
+const testPackage = "github.com/olaola-chat/slp-library/loghook"
+
+func TestCallerPackage(t *testing.T) {
+	tests := map[string]string{
+		"[github.com/olaola-chat/slp-library/redis.(*Mutex).Lock]": "github.com/olaola-chat/slp-library/redis",
+		"github.com/olaola-chat/slp-library/loghook.TestX.func1":   testPackage,
+		"[main.main]": "main",
+		"":            "",
+	}
+	for fn, want := range tests {
+		if got := callerPackage(fn); got != want {
+			t.Errorf("callerPackage(%q) = %q, want %q", fn, got, want)
+		}
+	}
+}
+
+func TestLevelsMask(t *testing.T) {
+	now := time.Now()
+	l := newLevels()
+	l.now = func() time.Time { return now }
+	l.base = glog.LEVEL_WARN | glog.LEVEL_ERRO | glog.LEVEL_CRIT
+	l.store()
+
+	if _, err := l.set(LevelRule{Target: "github.com/olaola-chat/slp-library", Level: "error"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.set(LevelRule{Target: "github.com/olaola-chat/slp-library/redis", Level: "debug"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.set(LevelRule{UID: 42, Level: "info"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.set(LevelRule{Level: "verbose"}, 0); err == nil {
+		t.Error("set(verbose) error = nil")
+	}
+
+	user := context.WithValue(context.Background(), context2.ContextUserKey, &context2.ContextUser{UID: 42})
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		pkg   string
+		level int
+		want  bool
+	}{
+		{"longest target", nil, "github.com/olaola-chat/slp-library/redis", glog.LEVEL_DEBU, true},
+		{"parent target", nil, "github.com/olaola-chat/slp-library/kafka", glog.LEVEL_WARN, false},
+		{"not prefix", nil, "github.com/olaola-chat/slp-library/redisx", glog.LEVEL_ERRO, true},
+		{"base", nil, "github.com/other/pkg", glog.LEVEL_WARN, true},
+		{"uid", user, "github.com/other/pkg", glog.LEVEL_INFO, true},
+		{"uid not debug", user, "github.com/other/pkg", glog.LEVEL_DEBU, false},
+		{"other uid", context.Background(), "github.com/other/pkg", glog.LEVEL_INFO, false},
+	}
+	for _, tt := range tests {
+		if got := l.mask(tt.ctx, "", tt.pkg)&tt.level != 0; got != tt.want {
+			t.Errorf("%s: mask&level = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	//过期后恢复
+	now = now.Add(2 * time.Minute)
+	if l.mask(nil, "", "github.com/olaola-chat/slp-library/redis")&glog.LEVEL_DEBU != 0 {
+		t.Error("expired rule still works")
+	}
+	base, rules := l.list()
+	if base != "warn" || len(rules) != 2 || rules[0].UID != 42 || rules[1].Source != LevelSourceAdmin {
+		t.Errorf("list() = %s, %+v", base, rules)
+	}
+	if !l.remove("", 42) || l.remove("", 42) {
+		t.Error("remove() twice")
+	}
+}
+
+func TestSetLevelsAcm(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	l := newLevels()
+	l.now = func() time.Time { return now }
+	err := l.setAcm(`{"Rules":[
+		{"Target":"github.com/olaola-chat/slp-library/redis","Level":"debug","Until":"2026-10-19 18:00:00"},
+		{"UID":7,"Level":"debug","TTL":"1h"},
+		{"Target":"github.com/olaola-chat/slp-library/kafka","Level":"warning"}
+	]}`)
+	if err != nil {
+		t.Fatalf("setAcm() error = %v", err)
+	}
+	_, rules := l.list()
+	if len(rules) != 3 || !rules[0].Until.Equal(now.Add(time.Hour)) || !rules[2].Until.Equal(now.Add(6*time.Hour)) ||
+		!rules[1].Until.Equal(now.Add(DefaultLevelTTL)) {
+		t.Errorf("rules = %+v", rules)
+	}
+	for _, content := range []string{
+		`{"Rules":[{"Level":"loud"}]}`,
+		`{"Rules":[{"Level":"debug","TTL":"forever"}]}`,
+		`{"Rules":[{"Level":"debug","Until":"tomorrow"}]}`,
+	} {
+		if err := l.setAcm(content); err == nil {
+			t.Errorf("setAcm(%s) error = nil", content)
+		}
+	}
+	if _, rules := l.list(); len(rules) != 3 {
+		t.Errorf("rules after bad config = %+v", rules)
+	}
+	if err := l.setAcm(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, rules := l.list(); len(rules) != 0 {
+		t.Errorf("rules after empty config = %+v", rules)
+	}
+}
+
+func TestSetLevelsAcmTTL(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	l := newLevels()
+	l.now = func() time.Time { return now }
+	err := l.setAcm(`{"Rules":[
+		{"Target":"github.com/olaola-chat/slp-library/redis","Level":"debug"},
+		{"UID":7,"Level":"debug","TTL":"72h"},
+		{"UID":8,"Level":"debug","Until":"2027-10-19 12:00:00"}
+	]}`)
+	if err != nil {
+		t.Fatalf("setAcm() error = %v", err)
+	}
+	//超过 MaxLevelTTL 的按 MaxLevelTTL
+	_, rules := l.list()
+	if len(rules) != 3 || !rules[0].Until.Equal(now.Add(MaxLevelTTL)) || !rules[1].Until.Equal(now.Add(MaxLevelTTL)) {
+		t.Errorf("rules = %+v", rules)
+	}
+	//没有 TTL 的规则 DefaultLevelTTL 后失效
+	now = now.Add(DefaultLevelTTL)
+	if _, rules := l.list(); len(rules) != 2 || rules[0].Target != "" {
+		t.Errorf("rules after default ttl = %+v", rules)
+	}
+}
+
+func TestLevelsHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := glog.New()
+	logger.SetFlags(glog.F_FILE_SHORT)
+	logger.SetLevelStr("PROD")
+	logger.SetWriter(&buf)
+	l := newLevels()
+	l.setup(logger)
+	logger.SetHandlers(l.handle)
+	//没有规则时保持基础级别，不获取调用方
+	base := logger.GetLevel()
+	if base&glog.LEVEL_DEBU != 0 || logger.GetFlags()&glog.F_CALLER_FN != 0 {
+		t.Errorf("level = %d, flags = %d without rules", base, logger.GetFlags())
+	}
+
+	logger.Debug("hidden")
+	logger.Print("plain")
+	if _, err := l.set(LevelRule{Target: testPackage, Level: "debug"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("shown")
+	logger.Info("info shown")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "plain") || !strings.Contains(out, "shown") || !strings.Contains(out, "info shown") {
+		t.Errorf("output = %q", out)
+	}
+	//匹配包路径用的函数名不输出
+	if strings.Contains(out, "TestLevelsHandler") {
+		t.Errorf("caller func in output = %q", out)
+	}
+	if !l.remove(testPackage, 0) || logger.GetLevel() != base || logger.GetFlags()&glog.F_CALLER_FN != 0 {
+		t.Errorf("level = %d, flags = %d after rules removed", logger.GetLevel(), logger.GetFlags())
+	}
+}
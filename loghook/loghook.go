@@ -2,6 +2,7 @@ package loghook
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"strings"
 	"time"
@@ -9,10 +10,20 @@ import (
 	"github.com/gogf/gf/frame/g"
 	"github.com/gogf/gf/os/glog"
 	"github.com/gogf/gf/text/gregex"
+
+	"github.com/olaola-chat/slp-library/redact"
 )
 
 // NewLogWriter 自定义日志格式，从配置文件中读取logger配置
 func NewLogWriter(serverName string) *LogWriter {
+	return &LogWriter{
+		serverName: serverName,
+		logger:     newConfigLogger(),
+	}
+}
+
+// newConfigLogger 按配置文件中的logger配置输出
+func newConfigLogger() *glog.Logger {
 	logger := glog.New()
 	m := g.Config().GetMap("logger")
 	if len(m) > 0 {
@@ -20,11 +31,7 @@ func NewLogWriter(serverName string) *LogWriter {
 			panic(err)
 		}
 	}
-
-	return &LogWriter{
-		serverName: serverName,
-		logger:     logger,
-	}
+	return logger
 }
 
 type LogWriter struct {
@@ -41,7 +48,7 @@ func (w *LogWriter) Write(p []byte) (n int, err error) {
 		buffer.WriteString("[INFO]")
 		buffer.WriteByte(' ')
 	}
-	buffer.WriteString(strings.Trim(string(p), "\n"))
+	buffer.WriteString(redact.String(strings.Trim(string(p), "\n")))
 	if gregex.IsMatchString(`ERRO|CRIT|PANI|FATA`, str) {
 		buffer.WriteString("，Stack: ")
 		bs, _ := json.Marshal(strings.Split(strings.Trim(w.logger.GetStack(1), "\n"), "\n"))
@@ -53,7 +60,7 @@ func (w *LogWriter) Write(p []byte) (n int, err error) {
 func (w *LogWriter) Output(calldepth int, str string) error {
 	var buffer bytes.Buffer
 	buffer.WriteString("[" + time.Now().Format("2006-01-02 15:04:05") + "]" + "[" + w.serverName + "]")
-	buffer.WriteString(strings.Trim(str, "\n"))
+	buffer.WriteString(redact.String(strings.Trim(str, "\n")))
 	if gregex.IsMatchString(`ERR|CRIT|PANI|FATA`, str) {
 		buffer.WriteString("，Stack: ")
 		bs, _ := json.Marshal(strings.Split(strings.Trim(w.logger.GetStack(1), "\n"), "\n"))
@@ -62,3 +69,39 @@ func (w *LogWriter) Output(calldepth int, str string) error {
 	_, err := w.logger.Write(buffer.Bytes())
 	return err
 }
+
+// TextHandler glog的处理器，输出和 LogWriter 相同格式的文本日志
+// 堆栈使用 SetStack(true) 时glog在打印时获取的调用方堆栈
+func TextHandler(serverName string) glog.Handler {
+	return func(ctx context.Context, in *glog.HandlerInput) {
+		line := textLine(in, serverName)
+		in.Buffer.Reset()
+		in.Buffer.Write(line)
+		in.Next()
+	}
+}
+
+// textLine 格式化成一行文本，以换行结尾
+func textLine(in *glog.HandlerInput, serverName string) []byte {
+	//in 会被其他输出使用，格式化之后恢复原来的内容
+	origin := in.Content
+	content, stack := splitStack(origin)
+	in.Content = redact.String(content)
+	line := strings.TrimRight(strings.TrimLeft(in.String(), "\n"), " \n")
+	in.Content = origin
+
+	var buffer bytes.Buffer
+	buffer.WriteString("[" + in.Time.Format("2006-01-02 15:04:05") + "]" + "[" + serverName + "]")
+	if !gregex.IsMatchString(`WARN|NOTI|INFO|ERRO|CRIT|PANI|FATA|DEBU`, line) {
+		buffer.WriteString("[INFO]")
+		buffer.WriteByte(' ')
+	}
+	buffer.WriteString(line)
+	if len(stack) > 0 {
+		buffer.WriteString("，Stack: ")
+		bs, _ := json.Marshal(stack)
+		buffer.Write(bs)
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes()
+}
@@ -0,0 +1,409 @@
+package loghook
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/frame/g"
+	"github.com/gogf/gf/os/glog"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/olaola-chat/slp-library/kafka"
+)
+
+// 输出的类型
+const (
+	SinkFile   = "file"
+	SinkStdout = "stdout"
+	SinkKafka  = "kafka"
+)
+
+// SinkConf 一个日志输出，配置 server.LogSinks，没有配置时按 logger 配置输出
+//
+//	[[server.LogSinks]]
+//	Type = "file"
+//	Path = "/data/logs/app"
+//	File = "{Y-m-d}.log"
+//	RotateSize = 104857600
+//	Compress = true
+//	[[server.LogSinks]]
+//	Type = "kafka"
+//	Level = "warn"
+//	Format = "json"
+//	Kafka = "log"
+//	Topic = "app-log"
+type SinkConf struct {
+	Name       string //名字，用于统计，默认 <Type>.<序号>
+	Type       string //file、stdout、kafka
+	Level      string //最低级别，同json日志的 level，默认全部输出
+	Format     string //text、json，默认同 server.LogFormat
+	Buffer     int    //缓冲的条数，默认10000
+	DropOldest bool   //缓冲满时丢弃最早的一条，默认丢弃新的
+
+	Path              string //file：目录
+	File              string //file：文件名，可以使用 {Y-m-d} 等按时间切分，默认 {Y-m-d}.log
+	RotateSize        int64  //file：超过多少字节切分，0 不按大小切分
+	RotateBackupLimit int    //file：最多保留多少个切分的文件，0 不限制
+	RotateBackupDays  int    //file：切分的文件保留多少天，0 不限制
+	Compress          bool   //file：切分的文件用gzip压缩
+
+	Kafka string //kafka：kafka配置名
+	Topic string //kafka：topic
+}
+
+// sinkWriter 写出格式化好的一行日志
+type sinkWriter interface {
+	write(line []byte) error
+	close() error
+}
+
+// levelRanks 级别从低到高
+var levelRanks = map[string]int{
+	"debug": 0, "info": 1, "notice": 2, "warn": 3, "error": 4, "critical": 5, "panic": 6, "fatal": 7,
+}
+
+// sink 一个输出，日志先写入有界的缓冲，由单独的协程写出
+type sink struct {
+	name     string
+	minLevel int
+	json     bool
+	oldest   bool
+	writer   sinkWriter
+	queue    chan []byte
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	written metrics.Counter
+	dropped metrics.Counter
+	failed  metrics.Counter
+}
+
+// newSink 创建输出，failed 为写出失败的计数，和 writer 共用
+func newSink(name string, conf *SinkConf, format string, writer sinkWriter, failed metrics.Counter) (*sink, error) {
+	minLevel := 0
+	if conf.Level != "" {
+		rank, ok := levelRanks[strings.ToLower(conf.Level)]
+		if !ok {
+			return nil, gerror.Newf("log sink %s unknown level %s", name, conf.Level)
+		}
+		minLevel = rank
+	}
+	if conf.Format != "" {
+		format = conf.Format
+	}
+	size := conf.Buffer
+	if size <= 0 {
+		size = 10000
+	}
+	prefix := sinkMetricPrefix + name
+	s := &sink{
+		name:     name,
+		minLevel: minLevel,
+		json:     strings.EqualFold(format, FormatJSON),
+		oldest:   conf.DropOldest,
+		writer:   writer,
+		queue:    make(chan []byte, size),
+		done:     make(chan struct{}),
+		written:  registerCounter(prefix+".written", metrics.NewCounter()),
+		dropped:  registerCounter(prefix+".dropped", metrics.NewCounter()),
+		failed:   registerCounter(prefix+".failed", failed),
+	}
+	go s.run()
+	return s, nil
+}
+
+// offer 放入缓冲，不阻塞打印日志的协程，缓冲满时按策略丢弃并计数
+func (s *sink) offer(line []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.dropped.Inc(1)
+		return
+	}
+	select {
+	case s.queue <- line:
+		return
+	default:
+	}
+	if !s.oldest {
+		s.dropped.Inc(1)
+		return
+	}
+	//丢弃最早的一条，和写出的协程竞争，都失败时丢弃这一条
+	select {
+	case <-s.queue:
+		s.dropped.Inc(1)
+	default:
+	}
+	select {
+	case s.queue <- line:
+	default:
+		s.dropped.Inc(1)
+	}
+}
+
+func (s *sink) run() {
+	defer close(s.done)
+	for line := range s.queue {
+		//写出失败不能再打印日志，否则会回到这里
+		if err := s.writer.write(line); err != nil {
+			s.failed.Inc(1)
+			continue
+		}
+		s.written.Inc(1)
+	}
+}
+
+// sinkMetricPrefix 输出的统计在 metrics.DefaultRegistry 中的前缀
+const sinkMetricPrefix = "loghook.sink."
+
+// registerCounter 把计数注册到 metrics.DefaultRegistry，替换同名的旧计数
+// 每个 Sinks 使用自己的计数，重新 Setup 后不会带上之前的统计
+func registerCounter(name string, c metrics.Counter) metrics.Counter {
+	metrics.DefaultRegistry.Unregister(name)
+	_ = metrics.DefaultRegistry.Register(name, c)
+	return c
+}
+
+// unregisterCounter 计数还是 c 时从 metrics.DefaultRegistry 删除，已经被新的输出替换时不处理
+func unregisterCounter(name string, c metrics.Counter) {
+	if metrics.DefaultRegistry.Get(name) == c {
+		metrics.DefaultRegistry.Unregister(name)
+	}
+}
+
+// close 不再接收日志，等待缓冲中的日志写出，超时后直接关闭
+func (s *sink) close(timeout time.Duration) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	prefix := sinkMetricPrefix + s.name
+	unregisterCounter(prefix+".written", s.written)
+	unregisterCounter(prefix+".dropped", s.dropped)
+	unregisterCounter(prefix+".failed", s.failed)
+
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		return gerror.Newf("log sink %s close timeout, %d lines not written", s.name, len(s.queue))
+	}
+	return s.writer.close()
+}
+
+// SinkStats 一个输出的统计
+type SinkStats struct {
+	Name    string
+	Written int64 //已写出
+	Dropped int64 //缓冲满或者关闭后丢弃
+	Failed  int64 //写出失败
+	Pending int   //缓冲中还没写出
+}
+
+// Sinks 多个日志输出，每个输出有自己的级别和格式
+type Sinks struct {
+	serverName string
+	sinks      []*sink
+}
+
+// NewSinks 按配置创建日志输出，format 为没有配置 Format 的输出使用的格式
+func NewSinks(serverName, format string, confs []SinkConf) (*Sinks, error) {
+	res := &Sinks{serverName: serverName}
+	for i := range confs {
+		conf := &confs[i]
+		name := conf.Name
+		if name == "" {
+			name = conf.Type + "." + strconv.Itoa(i)
+		}
+		failed := metrics.NewCounter()
+		writer, err := newSinkWriter(conf, failed)
+		if err == nil {
+			var s *sink
+			if s, err = newSink(name, conf, format, writer, failed); err == nil {
+				res.sinks = append(res.sinks, s)
+				continue
+			}
+			_ = writer.close()
+		}
+		_ = res.Close(time.Second)
+		return nil, err
+	}
+	return res, nil
+}
+
+func newSinkWriter(conf *SinkConf, failed metrics.Counter) (sinkWriter, error) {
+	switch strings.ToLower(conf.Type) {
+	case SinkFile:
+		return newFileWriter(conf)
+	case SinkStdout:
+		return stdoutWriter{}, nil
+	case SinkKafka:
+		return newKafkaWriter(conf, failed)
+	}
+	return nil, gerror.Newf("log sink unknown type %q", conf.Type)
+}
+
+// Handler glog的处理器，按每个输出的级别和格式写入缓冲，之后不再由 logger 原来的输出写出
+func (s *Sinks) Handler() glog.Handler {
+	return func(ctx context.Context, in *glog.HandlerInput) {
+		rank := levelRanks[levelOf(in.Level, in.Content)]
+		var text, data []byte
+		for _, sk := range s.sinks {
+			if rank < sk.minLevel {
+				continue
+			}
+			if sk.json {
+				if data == nil {
+					data = jsonLine(ctx, in, s.serverName)
+				}
+				sk.offer(data)
+			} else {
+				if text == nil {
+					text = textLine(in, s.serverName)
+				}
+				sk.offer(text)
+			}
+		}
+	}
+}
+
+// Stats 每个输出的统计，同时注册在 metrics.DefaultRegistry 的 loghook.sink.<名字> 下，关闭后删除
+func (s *Sinks) Stats() []SinkStats {
+	res := make([]SinkStats, 0, len(s.sinks))
+	for _, sk := range s.sinks {
+		res = append(res, SinkStats{
+			Name:    sk.name,
+			Written: sk.written.Count(),
+			Dropped: sk.dropped.Count(),
+			Failed:  sk.failed.Count(),
+			Pending: len(sk.queue),
+		})
+	}
+	return res
+}
+
+// Close 等待所有输出写完缓冲中的日志后关闭，每个输出最多等待 timeout
+func (s *Sinks) Close(timeout time.Duration) error {
+	var errs []string
+	for _, sk := range s.sinks {
+		if err := sk.close(timeout); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return gerror.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sinksConfig 读取配置 server.LogSinks
+func sinksConfig() []SinkConf {
+	var confs []SinkConf
+	if err := g.Cfg().GetStructs("server.LogSinks", &confs); err != nil {
+		g.Log().Warningf("loghook sinks config error, %v", err)
+	}
+	return confs
+}
+
+// fileWriter 写入本地文件，使用glog的按大小、时间切分和压缩
+type fileWriter struct {
+	logger *glog.Logger
+}
+
+func newFileWriter(conf *SinkConf) (*fileWriter, error) {
+	if conf.Path == "" {
+		return nil, gerror.New("log sink file without Path")
+	}
+	c := glog.DefaultConfig()
+	c.Path = conf.Path
+	c.File = conf.File
+	if c.File == "" {
+		c.File = "{Y-m-d}.log"
+	}
+	c.StdoutPrint = false
+	c.RotateSize = conf.RotateSize
+	c.RotateBackupLimit = conf.RotateBackupLimit
+	c.RotateBackupExpire = time.Duration(conf.RotateBackupDays) * 24 * time.Hour
+	if conf.Compress {
+		c.RotateBackupCompress = 9
+	}
+	logger := glog.New()
+	if err := logger.SetConfig(c); err != nil {
+		return nil, gerror.Wrap(err, "log sink file config error")
+	}
+	return &fileWriter{logger: logger}, nil
+}
+
+func (w *fileWriter) write(line []byte) error {
+	_, err := w.logger.Write(line)
+	return err
+}
+
+func (w *fileWriter) close() error {
+	return nil
+}
+
+// stdoutWriter 写到标准输出，容器中由采集程序收集
+type stdoutWriter struct{}
+
+func (stdoutWriter) write(line []byte) error {
+	_, err := os.Stdout.Write(line)
+	return err
+}
+
+func (stdoutWriter) close() error {
+	return nil
+}
+
+// kafkaWriter 写入kafka集中收集，消息没有key，均匀写入各个分区
+// 投递失败时kafka客户端打印的错误日志也会写到这里，由 FloodHandler 限制条数
+type kafkaWriter struct {
+	client *kafka.Client
+	topic  string
+	failed metrics.Counter
+}
+
+func newKafkaWriter(conf *SinkConf, failed metrics.Counter) (*kafkaWriter, error) {
+	if conf.Kafka == "" || conf.Topic == "" {
+		return nil, gerror.New("log sink kafka without Kafka or Topic")
+	}
+	client, err := kafka.NewClient(conf.Kafka)
+	if err != nil {
+		return nil, err
+	}
+	//投递结果是异步的，失败计入这个输出的 failed
+	return &kafkaWriter{
+		client: client,
+		topic:  conf.Topic,
+		failed: failed,
+	}, nil
+}
+
+func (w *kafkaWriter) write(line []byte) error {
+	msg := &sarama.ProducerMessage{
+		Topic: w.topic,
+		Value: sarama.ByteEncoder(strings.TrimRight(string(line), "\n")),
+	}
+	return w.client.Produce(context.Background(), msg, func(_ *sarama.ProducerMessage, err error) {
+		if err != nil {
+			w.failed.Inc(1)
+		}
+	})
+}
+
+func (w *kafkaWriter) close() error {
+	return w.client.Close()
+}
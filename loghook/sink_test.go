@@ -0,0 +1,127 @@
+package loghook
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogf/gf/os/glog"
+	"github.com/rcrowley/go-metrics"
+)
+
+// memWriter 记录写出的日志，block 不为nil时每次写出前等待
+type memWriter struct {
+	mu      sync.Mutex
+	lines   []string
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (w *memWriter) write(line []byte) error {
+	if w.block != nil {
+		w.started <- struct{}{}
+		<-w.block
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines = append(w.lines, string(line))
+	return nil
+}
+
+func (w *memWriter) close() error {
+	return nil
+}
+
+func TestSinksHandler(t *testing.T) {
+	all, warn := &memWriter{}, &memWriter{}
+	textSink, err := newSink("test.text", &SinkConf{}, FormatText, all, metrics.NewCounter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonSink, err := newSink("test.json", &SinkConf{Level: "WARN", Format: FormatJSON}, FormatText, warn, metrics.NewCounter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinks := &Sinks{serverName: "SlpTest", sinks: []*sink{textSink, jsonSink}}
+
+	logger := glog.New()
+	logger.SetStack(true)
+	logger.SetHandlers(sinks.Handler())
+	logger.Info("hello")
+	logger.Warning("careful")
+	logger.Printf("[ERROR] legacy line")
+	if err := sinks.Close(time.Second); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if len(all.lines) != 3 || !strings.Contains(all.lines[0], "[SlpTest]") || !strings.Contains(all.lines[0], "hello") {
+		t.Errorf("text lines = %q", all.lines)
+	}
+	if len(warn.lines) != 2 || !strings.Contains(warn.lines[0], `"level":"warn"`) || !strings.Contains(warn.lines[1], `"level":"error"`) {
+		t.Errorf("json lines = %q", warn.lines)
+	}
+	stats := sinks.Stats()
+	if stats[0].Written != 3 || stats[1].Written != 2 || stats[1].Dropped != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	//关闭后不再注册统计
+	if c := metrics.DefaultRegistry.Get(sinkMetricPrefix + "test.text.written"); c != nil {
+		t.Errorf("metrics after close = %v", c)
+	}
+}
+
+func TestSinkDrop(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		oldest bool
+		want   []string
+	}{
+		{"test.drop.newest", false, []string{"0", "1", "2"}},
+		{"test.drop.oldest", true, []string{"0", "3", "4"}},
+	} {
+		w := &memWriter{started: make(chan struct{}), block: make(chan struct{})}
+		s, err := newSink(tt.name, &SinkConf{Buffer: 2, DropOldest: tt.oldest}, FormatText, w, metrics.NewCounter())
+		if err != nil {
+			t.Fatal(err)
+		}
+		//第一条被写出的协程取走并阻塞，之后缓冲只能放2条
+		s.offer([]byte("0"))
+		<-w.started
+		for _, line := range []string{"1", "2", "3", "4"} {
+			s.offer([]byte(line))
+		}
+		if got := s.dropped.Count(); got != 2 {
+			t.Errorf("%s dropped = %d, want 2", tt.name, got)
+		}
+		go func() {
+			for range w.started {
+			}
+		}()
+		close(w.block)
+		if err := s.close(time.Second); err != nil {
+			t.Fatalf("%s close() error = %v", tt.name, err)
+		}
+		close(w.started)
+		if strings.Join(w.lines, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s lines = %v, want %v", tt.name, w.lines, tt.want)
+		}
+		s.offer([]byte("5"))
+		if got := s.dropped.Count(); got != 3 {
+			t.Errorf("%s dropped after close = %d, want 3", tt.name, got)
+		}
+	}
+}
+
+func TestNewSinksError(t *testing.T) {
+	for _, conf := range []SinkConf{
+		{Type: "syslog"},
+		{Type: SinkFile},
+		{Type: SinkKafka, Topic: "log"},
+		{Type: SinkStdout, Level: "verbose"},
+	} {
+		if _, err := NewSinks("SlpTest", FormatText, []SinkConf{{Type: SinkStdout}, conf}); err == nil {
+			t.Errorf("NewSinks(%+v) error = nil", conf)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package outbox 事务发件箱，业务数据和待发送的消息在同一个MySQL事务中写入，由 Relay 投递到kafka或rocketmq
+//
+//	store := outbox.NewStore(db, "outbox")
+//	tx, _ := db.BeginTx(ctx, nil)
+//	//... 写业务数据
+//	store.AddJSON(ctx, tx, "order-events", orderID, event)
+//	tx.Commit()
+//
+//	relay := outbox.NewRelay(store, outbox.KafkaPublisher(client), &outbox.RelayConf{})
+//	go relay.Run(ctx)
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/util/gconv"
+
+	"github.com/olaola-chat/slp-library/kafka"
+	context2 "github.com/olaola-chat/slp-library/server/http/context"
+	"github.com/olaola-chat/slp-library/tracer/wrap"
+)
+
+// 消息状态
+const (
+	StatusPending = 0
+	StatusSent    = 1
+	StatusDead    = 2 //超过重试次数，不再投递
+)
+
+// Schema 发件箱表结构，table 为表名，时间都是毫秒时间戳
+func Schema(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,"+
+		"`aggregate_key` VARCHAR(191) NOT NULL DEFAULT '',"+
+		"`topic` VARCHAR(255) NOT NULL,"+
+		"`payload` MEDIUMBLOB NOT NULL,"+
+		"`headers` TEXT NOT NULL,"+
+		"`status` TINYINT NOT NULL DEFAULT 0,"+
+		"`attempts` INT NOT NULL DEFAULT 0,"+
+		"`next_attempt_at` BIGINT NOT NULL DEFAULT 0,"+
+		"`last_error` VARCHAR(1024) NOT NULL DEFAULT '',"+
+		"`created_at` BIGINT NOT NULL,"+
+		"`sent_at` BIGINT NOT NULL DEFAULT 0,"+
+		"PRIMARY KEY (`id`),"+
+		"KEY `idx_status_id` (`status`, `id`),"+
+		"KEY `idx_status_key` (`status`, `aggregate_key`, `id`),"+
+		"KEY `idx_status_sent` (`status`, `sent_at`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", table)
+}
+
+// Message 发件箱中的一条消息
+type Message struct {
+	ID        int64
+	Topic     string
+	Key       string //聚合键，同一个key按写入顺序投递；kafka作为消息key，rocketmq作为MessageGroup
+	Payload   []byte
+	Headers   map[string]string
+	Attempts  int
+	CreatedAt time.Time
+
+	nextAttempt time.Time
+}
+
+var tableName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Store MySQL中的发件箱表，db 一般使用 bbsql 驱动打开
+type Store struct {
+	db    *sql.DB
+	table string
+}
+
+// NewStore 创建发件箱，table 为空时使用 outbox，表名不合法panic
+func NewStore(db *sql.DB, table string) *Store {
+	if table == "" {
+		table = "outbox"
+	}
+	if !tableName.MatchString(table) {
+		panic(gerror.Newf("outbox table name %s error", table))
+	}
+	return &Store{db: db, table: table}
+}
+
+// CreateTable 创建发件箱表
+func (s *Store) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, Schema(s.table))
+	return gerror.Wrapf(err, "outbox create table %s error", s.table)
+}
+
+// Add 在业务事务 tx 中写入消息，事务提交后才会被投递
+// ctx 中的 TraceId、UID和语言写入消息头，消费方可以用 kafka.ContextFromMessage 还原
+func (s *Store) Add(ctx context.Context, tx *sql.Tx, msgs ...*Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	holders := make([]string, 0, len(msgs))
+	args := make([]interface{}, 0, len(msgs)*5)
+	for _, msg := range msgs {
+		if msg.Topic == "" {
+			return gerror.New("outbox message topic is empty")
+		}
+		headers := contextHeaders(ctx)
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		data, err := json.Marshal(headers)
+		if err != nil {
+			return gerror.Wrap(err, "outbox marshal headers error")
+		}
+		holders = append(holders, "(?, ?, ?, ?, ?)")
+		args = append(args, msg.Key, msg.Topic, msg.Payload, string(data), now)
+	}
+	query := fmt.Sprintf("INSERT INTO `%s` (`aggregate_key`, `topic`, `payload`, `headers`, `created_at`) VALUES %s",
+		s.table, strings.Join(holders, ", "))
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return gerror.Wrapf(err, "outbox insert into %s error", s.table)
+	}
+	return nil
+}
+
+// AddJSON 按json编码后写入，消息头 content-type 为 application/json
+func (s *Store) AddJSON(ctx context.Context, tx *sql.Tx, topic string, key interface{}, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return gerror.Wrapf(err, "outbox marshal %T error", value)
+	}
+	return s.Add(ctx, tx, &Message{
+		Topic:   topic,
+		Key:     gconv.String(key),
+		Payload: data,
+		Headers: map[string]string{kafka.HeaderContentType: kafka.ContentTypeJSON},
+	})
+}
+
+// contextHeaders 从ctx中取 TraceId、UID和语言
+func contextHeaders(ctx context.Context) map[string]string {
+	headers := make(map[string]string)
+	if traceID, ok := ctx.Value(wrap.TrackKey).(string); ok && traceID != "" {
+		headers[kafka.HeaderTraceID] = traceID
+	}
+	if user := context2.ContextSrv.GetUserCtx(ctx); user != nil {
+		if user.UID > 0 {
+			headers[kafka.HeaderUID] = gconv.String(user.UID)
+		}
+		if user.Language != "" {
+			headers[kafka.HeaderLanguage] = user.Language
+		}
+	}
+	return headers
+}
+
+// lock 使用MySQL的 GET_LOCK 保证同时只有一个 Relay 在投递，拿不到锁时返回 ok=false
+// 锁和连接绑定，连接断开时锁自动释放；lost 在连接不可用时返回错误
+func (s *Store) lock(ctx context.Context, name string) (ok bool, lost func(context.Context) error, release func(), err error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, nil, nil, gerror.Wrap(err, "outbox get connection error")
+	}
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&got); err != nil {
+		conn.Close()
+		return false, nil, nil, gerror.Wrapf(err, "outbox get lock %s error", name)
+	}
+	if got.Int64 != 1 {
+		conn.Close()
+		return false, nil, nil, nil
+	}
+	lost = func(ctx context.Context) error {
+		return conn.PingContext(ctx)
+	}
+	release = func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+		conn.Close()
+	}
+	return true, lost, release, nil
+}
+
+// pending 按id顺序取 now 时可以投递的消息
+// 跳过还没到重试时间的消息，以及同一个聚合键前面有还没到重试时间的消息，避免阻塞后面其他key的消息
+func (s *Store) pending(ctx context.Context, now time.Time, limit int) ([]*Message, error) {
+	query := fmt.Sprintf("SELECT `id`, `aggregate_key`, `topic`, `payload`, `headers`, `attempts`, `next_attempt_at`, `created_at` "+
+		"FROM `%[1]s` o WHERE `status` = ? AND `next_attempt_at` <= ? AND NOT EXISTS ("+
+		"SELECT 1 FROM `%[1]s` b WHERE b.`status` = ? AND b.`aggregate_key` = o.`aggregate_key` AND b.`aggregate_key` != '' "+
+		"AND b.`id` < o.`id` AND b.`next_attempt_at` > ?) ORDER BY `id` LIMIT ?", s.table)
+	ms := now.UnixMilli()
+	rows, err := s.db.QueryContext(ctx, query, StatusPending, ms, StatusPending, ms, limit)
+	if err != nil {
+		return nil, gerror.Wrapf(err, "outbox query %s error", s.table)
+	}
+	defer rows.Close()
+
+	var res []*Message
+	for rows.Next() {
+		var (
+			msg           Message
+			headers       string
+			next, created int64
+		)
+		if err := rows.Scan(&msg.ID, &msg.Key, &msg.Topic, &msg.Payload, &headers, &msg.Attempts, &next, &created); err != nil {
+			return nil, gerror.Wrapf(err, "outbox scan %s error", s.table)
+		}
+		if headers != "" {
+			if err := json.Unmarshal([]byte(headers), &msg.Headers); err != nil {
+				return nil, gerror.Wrapf(err, "outbox message %d headers error", msg.ID)
+			}
+		}
+		msg.nextAttempt = time.UnixMilli(next)
+		msg.CreatedAt = time.UnixMilli(created)
+		res = append(res, &msg)
+	}
+	return res, gerror.Wrapf(rows.Err(), "outbox query %s error", s.table)
+}
+
+// markSent 标记为已投递
+func (s *Store) markSent(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	holders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, 0, len(ids)+2)
+	args = append(args, StatusSent, time.Now().UnixMilli())
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf("UPDATE `%s` SET `status` = ?, `sent_at` = ? WHERE `id` IN (%s)", s.table, holders)
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return gerror.Wrapf(err, "outbox mark sent error")
+}
+
+// markFailed 记录投递失败，status 为 StatusDead 时不再投递
+func (s *Store) markFailed(ctx context.Context, msg *Message, status int, cause error) error {
+	reason := cause.Error()
+	if len(reason) > 1024 {
+		reason = reason[:1024]
+	}
+	query := fmt.Sprintf("UPDATE `%s` SET `status` = ?, `attempts` = ?, `next_attempt_at` = ?, `last_error` = ? WHERE `id` = ?", s.table)
+	_, err := s.db.ExecContext(ctx, query, status, msg.Attempts, msg.nextAttempt.UnixMilli(), reason, msg.ID)
+	return gerror.Wrapf(err, "outbox mark message %d failed error", msg.ID)
+}
+
+// clean 删除 before 之前投递的消息，每次最多删除 limit 条，返回删除的数量
+func (s *Store) clean(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM `%s` WHERE `status` = ? AND `sent_at` < ? LIMIT ?", s.table)
+	res, err := s.db.ExecContext(ctx, query, StatusSent, before.UnixMilli(), limit)
+	if err != nil {
+		return 0, gerror.Wrapf(err, "outbox clean %s error", s.table)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,312 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	rmq_client "github.com/apache/rocketmq-clients/golang/v5"
+	"github.com/gogf/gf/frame/g"
+
+	"github.com/olaola-chat/slp-library/kafka"
+	"github.com/olaola-chat/slp-library/rocketmq"
+)
+
+// Publisher 把发件箱中的消息投递到消息队列，返回nil表示已经被确认
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublisherFunc 函数形式的 Publisher
+type PublisherFunc func(ctx context.Context, msg *Message) error
+
+// Publish 实现 Publisher
+func (f PublisherFunc) Publish(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// KafkaPublisher 投递到kafka，聚合键作为消息key，同一个key写入同一个分区
+func KafkaPublisher(client *kafka.Client) Publisher {
+	return PublisherFunc(func(ctx context.Context, msg *Message) error {
+		pm := &sarama.ProducerMessage{
+			Topic:     msg.Topic,
+			Value:     sarama.ByteEncoder(msg.Payload),
+			Timestamp: msg.CreatedAt,
+		}
+		if msg.Key != "" {
+			pm.Key = sarama.StringEncoder(msg.Key)
+		}
+		for k, v := range msg.Headers {
+			pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+		_, _, err := client.SendFuture(ctx, pm).Get()
+		return err
+	})
+}
+
+// RocketPublisher 投递到rocketmq，聚合键作为 MessageGroup，需要使用FIFO topic才能保证顺序
+func RocketPublisher(client *rocketmq.Client) Publisher {
+	return PublisherFunc(func(ctx context.Context, msg *Message) error {
+		rm := &rmq_client.Message{Topic: msg.Topic, Body: msg.Payload}
+		if msg.Key != "" {
+			rm.SetKeys(msg.Key)
+			rm.SetMessageGroup(msg.Key)
+		}
+		for k, v := range msg.Headers {
+			rm.AddProperty(k, v)
+		}
+		return client.Send(ctx, rm)
+	})
+}
+
+// RelayConf 投递的参数，零值使用默认值
+type RelayConf struct {
+	LockName      string        //多个实例之间互斥的锁，默认 outbox.<表名>
+	Interval      time.Duration //没有消息时的轮询间隔，默认1s
+	BatchSize     int           //每次最多取多少条，默认100
+	Concurrency   int           //同时投递多少个聚合键，默认16
+	MaxAttempts   int           //最多投递多少次，之后标记为 StatusDead，默认10，小于0不限制
+	Backoff       time.Duration //第一次失败后的等待时间，之后每次翻倍，默认1s
+	MaxBackoff    time.Duration //最长等待时间，默认5m
+	Retention     time.Duration //已投递的消息保留多久，默认7天
+	CleanInterval time.Duration //清理已投递消息的间隔，默认1h
+}
+
+func (c *RelayConf) withDefaults(table string) RelayConf {
+	res := *c
+	if res.LockName == "" {
+		res.LockName = "outbox." + table
+	}
+	if res.Interval <= 0 {
+		res.Interval = time.Second
+	}
+	if res.BatchSize <= 0 {
+		res.BatchSize = 100
+	}
+	if res.Concurrency <= 0 {
+		res.Concurrency = 16
+	}
+	if res.MaxAttempts == 0 {
+		res.MaxAttempts = 10
+	}
+	if res.Backoff <= 0 {
+		res.Backoff = time.Second
+	}
+	if res.MaxBackoff <= 0 {
+		res.MaxBackoff = 5 * time.Minute
+	}
+	if res.Retention <= 0 {
+		res.Retention = 7 * 24 * time.Hour
+	}
+	if res.CleanInterval <= 0 {
+		res.CleanInterval = time.Hour
+	}
+	return res
+}
+
+// store Relay 用到的发件箱操作，*Store 实现
+type store interface {
+	lock(ctx context.Context, name string) (ok bool, lost func(context.Context) error, release func(), err error)
+	pending(ctx context.Context, now time.Time, limit int) ([]*Message, error)
+	markSent(ctx context.Context, ids []int64) error
+	markFailed(ctx context.Context, msg *Message, status int, cause error) error
+	clean(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// Relay 轮询发件箱投递消息，至少投递一次，消费方需要按消息幂等处理
+// 同一个聚合键的消息按id顺序投递，前面的消息没有成功之前后面的不会投递
+// 多个实例通过MySQL的锁保证同时只有一个在投递
+type Relay struct {
+	store     store
+	publisher Publisher
+	conf      RelayConf
+	now       func() time.Time
+}
+
+// NewRelay 创建投递 store 的 Relay
+func NewRelay(store *Store, publisher Publisher, conf *RelayConf) *Relay {
+	if conf == nil {
+		conf = &RelayConf{}
+	}
+	return &Relay{store: store, publisher: publisher, conf: conf.withDefaults(store.table), now: time.Now}
+}
+
+// Run 持续投递直到 ctx 结束，没有拿到锁时等待，数据库错误记录日志后重试
+func (r *Relay) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		ok, lost, release, err := r.store.lock(ctx, r.conf.LockName)
+		if err != nil {
+			g.Log().Warningf("outbox relay lock error, %v", err)
+		}
+		if ok {
+			r.lead(ctx, lost)
+			release()
+		}
+		_ = sleep(ctx, r.conf.Interval)
+	}
+	return nil
+}
+
+// lead 拿到锁之后一直投递，直到 ctx 结束或者锁所在的连接不可用
+func (r *Relay) lead(ctx context.Context, lost func(context.Context) error) {
+	lastClean := time.Time{}
+	for ctx.Err() == nil {
+		if err := lost(ctx); err != nil {
+			g.Log().Warningf("outbox relay lost lock %s, %v", r.conf.LockName, err)
+			return
+		}
+		if r.now().Sub(lastClean) >= r.conf.CleanInterval {
+			lastClean = r.now()
+			r.clean(ctx)
+		}
+		full, err := r.relay(ctx)
+		if err != nil {
+			g.Log().Warningf("outbox relay error, %v", err)
+		}
+		if !full || err != nil {
+			_ = sleep(ctx, r.conf.Interval)
+		}
+	}
+}
+
+// relay 投递一批消息，返回这一批是否取满并且有进展，是的话马上继续
+func (r *Relay) relay(ctx context.Context) (bool, error) {
+	msgs, err := r.store.pending(ctx, r.now(), r.conf.BatchSize)
+	if err != nil {
+		return false, err
+	}
+	groups := groupByKey(msgs)
+
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, r.conf.Concurrency)
+		done  int64
+	)
+	for _, group := range groups {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(group []*Message) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			atomic.AddInt64(&done, int64(r.publishGroup(ctx, group)))
+		}(group)
+	}
+	wg.Wait()
+	return len(msgs) >= r.conf.BatchSize && done > 0, nil
+}
+
+// groupByKey 按聚合键分组，组内和组间都保持id顺序，没有聚合键的消息各自一组
+func groupByKey(msgs []*Message) [][]*Message {
+	var (
+		groups [][]*Message
+		index  = make(map[string]int)
+	)
+	for _, msg := range msgs {
+		if msg.Key == "" {
+			groups = append(groups, []*Message{msg})
+			continue
+		}
+		i, ok := index[msg.Key]
+		if !ok {
+			i = len(groups)
+			index[msg.Key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], msg)
+	}
+	return groups
+}
+
+// publishGroup 按顺序投递同一个聚合键的消息，遇到还没到重试时间或者失败的消息就停止
+// 返回投递成功或者进入死信的数量
+func (r *Relay) publishGroup(ctx context.Context, group []*Message) (done int) {
+	var sent []int64
+	defer func() {
+		//ctx 结束时已经投递的消息也要标记，避免重复投递
+		markCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.store.markSent(markCtx, sent); err != nil {
+			g.Log().Warningf("outbox relay %v, messages will be sent again", err)
+		}
+	}()
+	for _, msg := range group {
+		if msg.nextAttempt.After(r.now()) {
+			return
+		}
+		err := r.publisher.Publish(ctx, msg)
+		if err == nil {
+			sent = append(sent, msg.ID)
+			done++
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		msg.Attempts++
+		status := StatusPending
+		if r.conf.MaxAttempts > 0 && msg.Attempts >= r.conf.MaxAttempts {
+			status = StatusDead
+			g.Log().Errorf("outbox message %d to %s key %s dead after %d attempts, %v", msg.ID, msg.Topic, msg.Key, msg.Attempts, err)
+		} else {
+			msg.nextAttempt = r.now().Add(r.backoff(msg.Attempts))
+			g.Log().Warningf("outbox message %d to %s key %s attempt %d failed, %v", msg.ID, msg.Topic, msg.Key, msg.Attempts, err)
+		}
+		if err := r.store.markFailed(ctx, msg, status, err); err != nil {
+			g.Log().Warningf("outbox relay %v", err)
+			return
+		}
+		//死信不再阻塞同一个key后面的消息
+		if status != StatusDead {
+			return
+		}
+		done++
+	}
+	return
+}
+
+// backoff 第 attempts 次失败后的等待时间
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.conf.Backoff
+	for i := 1; i < attempts && d < r.conf.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.conf.MaxBackoff {
+		d = r.conf.MaxBackoff
+	}
+	return d
+}
+
+// clean 分批删除超过保留时间的已投递消息
+func (r *Relay) clean(ctx context.Context) {
+	before := r.now().Add(-r.conf.Retention)
+	var total int64
+	for ctx.Err() == nil {
+		n, err := r.store.clean(ctx, before, 1000)
+		if err != nil {
+			g.Log().Warningf("outbox relay %v", err)
+			return
+		}
+		total += n
+		if n < 1000 {
+			break
+		}
+	}
+	if total > 0 {
+		g.Log().Infof("outbox relay cleaned %d messages sent before %v", total, before)
+	}
+}
+
+// sleep 等待 d，ctx 结束时返回错误
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,218 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore 内存中的发件箱
+type memStore struct {
+	mu     sync.Mutex
+	msgs   []*Message
+	status map[int64]int
+	locked bool
+}
+
+func newMemStore(keys ...string) *memStore {
+	s := &memStore{status: make(map[int64]int)}
+	for i, key := range keys {
+		s.msgs = append(s.msgs, &Message{ID: int64(i + 1), Topic: "events", Key: key})
+	}
+	return s
+}
+
+func (s *memStore) lock(ctx context.Context, name string) (bool, func(context.Context) error, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked {
+		return false, nil, nil, nil
+	}
+	s.locked = true
+	release := func() {
+		s.mu.Lock()
+		s.locked = false
+		s.mu.Unlock()
+	}
+	return true, func(context.Context) error { return nil }, release, nil
+}
+
+func (s *memStore) pending(ctx context.Context, now time.Time, limit int) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		res     []*Message
+		blocked = make(map[string]bool)
+	)
+	for _, msg := range s.msgs {
+		if s.status[msg.ID] != StatusPending || len(res) >= limit {
+			continue
+		}
+		if msg.nextAttempt.After(now) {
+			if msg.Key != "" {
+				blocked[msg.Key] = true
+			}
+			continue
+		}
+		if !blocked[msg.Key] || msg.Key == "" {
+			copied := *msg
+			res = append(res, &copied)
+		}
+	}
+	return res, nil
+}
+
+func (s *memStore) markSent(ctx context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.status[id] = StatusSent
+	}
+	return nil
+}
+
+func (s *memStore) markFailed(ctx context.Context, msg *Message, status int, cause error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status[msg.ID] = status
+	for _, m := range s.msgs {
+		if m.ID == msg.ID {
+			m.Attempts, m.nextAttempt = msg.Attempts, msg.nextAttempt
+		}
+	}
+	return nil
+}
+
+func (s *memStore) clean(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+// recorder 记录投递的消息，fail 中的消息id投递失败
+type recorder struct {
+	mu   sync.Mutex
+	sent []int64
+	fail map[int64]bool
+}
+
+func (p *recorder) Publish(ctx context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[msg.ID] {
+		return errors.New("broker down")
+	}
+	p.sent = append(p.sent, msg.ID)
+	return nil
+}
+
+func newTestRelay(s *memStore, p Publisher, conf RelayConf) *Relay {
+	return &Relay{store: s, publisher: p, conf: conf.withDefaults("outbox"), now: time.Now}
+}
+
+func TestRelayOrderPerKey(t *testing.T) {
+	s := newMemStore("a", "b", "a", "", "b")
+	p := &recorder{fail: map[int64]bool{1: true}}
+	r := newTestRelay(s, p, RelayConf{Concurrency: 1, Backoff: time.Hour})
+
+	if _, err := r.relay(context.Background()); err != nil {
+		t.Fatalf("relay() error = %v", err)
+	}
+	//a 的第一条失败，同一个key后面的消息不投递
+	if want := []int64{2, 5, 4}; !reflect.DeepEqual(p.sent, want) {
+		t.Errorf("sent = %v, want %v", p.sent, want)
+	}
+	if s.status[3] != StatusPending || s.msgs[0].Attempts != 1 {
+		t.Errorf("status = %v, attempts = %d", s.status, s.msgs[0].Attempts)
+	}
+
+	//还没到重试时间
+	p.fail = nil
+	_, _ = r.relay(context.Background())
+	if len(p.sent) != 3 {
+		t.Errorf("sent before backoff = %v", p.sent)
+	}
+	r.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, _ = r.relay(context.Background())
+	if want := []int64{2, 5, 4, 1, 3}; !reflect.DeepEqual(p.sent, want) {
+		t.Errorf("sent = %v, want %v", p.sent, want)
+	}
+}
+
+func TestRelaySkipBlockedKeys(t *testing.T) {
+	s := newMemStore("a", "b", "c", "a")
+	p := &recorder{fail: map[int64]bool{1: true, 2: true}}
+	r := newTestRelay(s, p, RelayConf{BatchSize: 2, Backoff: time.Hour})
+	for i := 0; i < 5; i++ {
+		if _, err := r.relay(context.Background()); err != nil {
+			t.Fatalf("relay() error = %v", err)
+		}
+	}
+	//a、b 在等待重试，不影响 c，a 后面的消息仍然等待
+	if want := []int64{3}; !reflect.DeepEqual(p.sent, want) {
+		t.Errorf("sent = %v, want %v", p.sent, want)
+	}
+	if s.status[4] != StatusPending {
+		t.Errorf("status = %v", s.status)
+	}
+}
+
+func TestRelayDead(t *testing.T) {
+	s := newMemStore("a", "a")
+	p := &recorder{fail: map[int64]bool{1: true}}
+	r := newTestRelay(s, p, RelayConf{MaxAttempts: 1})
+	_, _ = r.relay(context.Background())
+	if s.status[1] != StatusDead || s.status[2] != StatusSent {
+		t.Errorf("status = %v", s.status)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	r := newTestRelay(newMemStore(), nil, RelayConf{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 20: 5 * time.Second} {
+		if got := r.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestRelayRunLocked(t *testing.T) {
+	s := newMemStore("a")
+	p := &recorder{}
+	other := newTestRelay(s, p, RelayConf{Interval: time.Millisecond})
+	ok, _, release, _ := s.lock(context.Background(), "outbox")
+	if !ok {
+		t.Fatal("lock() = false")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- other.Run(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	p.mu.Lock()
+	if len(p.sent) != 0 {
+		t.Errorf("sent without lock = %v", p.sent)
+	}
+	p.mu.Unlock()
+
+	//锁释放后接手投递
+	release()
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		n := len(p.sent)
+		p.mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(p.sent, []int64{1}) {
+		t.Errorf("sent = %v", p.sent)
+	}
+}
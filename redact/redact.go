@@ -0,0 +1,461 @@
+// Package redact 日志和链路中敏感数据的脱敏
+//
+// 规则按字段名(token、password、phone等)或者正则(带 +86 的手机号、JWT等)匹配，命中后按策略替换：
+// 全部遮盖、保留首尾、哈希或者删除。规则从配置 server.Redact 读取，可以用 SetConfig 在运行时整体替换：
+//
+//	[server.Redact]
+//	[[server.Redact.Rules]]
+//	Name = "bank"
+//	Keys = ["bank_card"]
+//	Pattern = '\b\d{16,19}\b'
+//	Strategy = "partial"
+//	Keep = 4
+package redact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/gogf/gf/encoding/gjson"
+	"github.com/gogf/gf/errors/gerror"
+	"github.com/gogf/gf/frame/g"
+)
+
+// 脱敏策略
+const (
+	StrategyMask    = "mask"    //整体替换成 Conf.Mask
+	StrategyPartial = "partial" //保留首尾 Keep 个字符，如 138****5678
+	StrategyHash    = "hash"    //sha256 的前12位，相同的值结果相同，便于关联排查
+	StrategyRemove  = "remove"  //替换成空字符串
+)
+
+// Rule 一条脱敏规则，Keys 和 Pattern 至少有一个
+type Rule struct {
+	Name     string   //名字，便于排查
+	Keys     []string //字段名，不区分大小写，也匹配 xxx_<key> 形式的字段，如 token 匹配 access_token
+	Pattern  string   //正则，匹配任意文本中的值，有分组时只替换匹配到的第一个分组
+	Strategy string   //策略，默认 mask
+	Keep     int      //partial 保留首尾多少个字符，默认3
+}
+
+// Conf 脱敏配置
+type Conf struct {
+	Disabled   bool   //关闭脱敏
+	NoDefaults bool   //不使用 DefaultRules
+	Mask       string //mask 策略替换成的内容，默认 ***
+	Rules      []Rule //和 DefaultRules 合并，Keys 相同时以这里的为准
+}
+
+// DefaultRules 默认的规则：凭证类字段整体遮盖，手机号保留首尾
+// 任意文本中只处理带 +86 或者分隔符的手机号，单独的11位数字可能是uid、订单号等，不处理
+var DefaultRules = []Rule{
+	{
+		Name: "credential",
+		Keys: []string{"password", "passwd", "pwd", "secret", "token", "authorization", "cookie"},
+	},
+	{
+		Name:     "phone",
+		Keys:     []string{"mobile", "phone"},
+		Pattern:  `\+86[ -]?(1[3-9]\d{9})\b|\b(1[3-9]\d[ -]\d{4}[ -]\d{4})\b`,
+		Strategy: StrategyPartial,
+		Keep:     3,
+	},
+	{Name: "jwt", Pattern: `\beyJ[\w-]+\.[\w-]+\.[\w-]+`},
+	{Name: "bearer", Pattern: `(?i)\bbearer\s+[\w.~+/=-]+`},
+}
+
+// rule 编译后的规则
+type rule struct {
+	Rule
+	mask    string
+	pattern *regexp.Regexp
+}
+
+// replace 替换文本中匹配正则的部分，正则有分组时只替换匹配到的第一个分组
+func (r *rule) replace(s string) string {
+	if r.pattern.NumSubexp() == 0 {
+		return r.pattern.ReplaceAllStringFunc(s, r.apply)
+	}
+	matches := r.pattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var (
+		buf  strings.Builder
+		last int
+	)
+	for _, m := range matches {
+		start, end := -1, -1
+		for i := 2; start < 0 && i+1 < len(m); i += 2 {
+			start, end = m[i], m[i+1]
+		}
+		if start < 0 {
+			continue
+		}
+		buf.WriteString(s[last:start])
+		buf.WriteString(r.apply(s[start:end]))
+		last = end
+	}
+	buf.WriteString(s[last:])
+	return buf.String()
+}
+
+func (r *rule) apply(s string) string {
+	switch r.Strategy {
+	case StrategyPartial:
+		keep := r.Keep
+		if keep <= 0 {
+			keep = 3
+		}
+		if utf8.RuneCountInString(s) <= keep*2 {
+			return r.mask
+		}
+		runes := []rune(s)
+		return string(runes[:keep]) + "****" + string(runes[len(runes)-keep:])
+	case StrategyHash:
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:])[:12]
+	case StrategyRemove:
+		return ""
+	}
+	return r.mask
+}
+
+// Redactor 编译好的脱敏规则，可以并发使用
+type Redactor struct {
+	disabled bool
+	mask     string
+	keys     map[string]*rule //小写字段名 => 规则
+	patterns []*rule
+	pairs    *regexp.Regexp //文本中的 key=value、"key":"value" 等
+}
+
+// New 编译脱敏规则
+func New(conf *Conf) (*Redactor, error) {
+	r := &Redactor{disabled: conf.Disabled, mask: conf.Mask, keys: make(map[string]*rule)}
+	if r.mask == "" {
+		r.mask = "***"
+	}
+	var rules []Rule
+	if !conf.NoDefaults {
+		rules = append(rules, DefaultRules...)
+	}
+	rules = append(rules, conf.Rules...)
+
+	for i := range rules {
+		c := &rule{Rule: rules[i], mask: r.mask}
+		switch c.Strategy {
+		case "":
+			c.Strategy = StrategyMask
+		case StrategyMask, StrategyPartial, StrategyHash, StrategyRemove:
+		default:
+			return nil, gerror.Newf("redact rule %s unknown strategy %s", c.Name, c.Strategy)
+		}
+		if len(c.Keys) == 0 && c.Pattern == "" {
+			return nil, gerror.Newf("redact rule %s without Keys or Pattern", c.Name)
+		}
+		if c.Pattern != "" {
+			pattern, err := regexp.Compile(c.Pattern)
+			if err != nil {
+				return nil, gerror.Wrapf(err, "redact rule %s pattern error", c.Name)
+			}
+			c.pattern = pattern
+			r.patterns = append(r.patterns, c)
+		}
+		for _, key := range c.Keys {
+			r.keys[normalizeKey(key)] = c
+		}
+	}
+
+	if len(r.keys) > 0 {
+		names := make([]string, 0, len(r.keys))
+		for key := range r.keys {
+			names = append(names, regexp.QuoteMeta(key))
+		}
+		//长的在前，避免 pwd 先于 passwd 匹配
+		sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+		//带引号的值匹配到对应的右引号，可以包含空格
+		r.pairs = regexp.MustCompile(`(?i)\b([\w-]*(?:` + strings.Join(names, "|") + `))(["']?\s*[:=]\s*)` +
+			`(?:"((?:[^"\\]|\\.)+)"|'((?:[^'\\]|\\.)+)'|([^"'&,;\s})\]]+))`)
+	}
+	return r, nil
+}
+
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+}
+
+// keyRule 字段名对应的规则，没有时返回nil
+func (r *Redactor) keyRule(key string) *rule {
+	key = normalizeKey(key)
+	if c, ok := r.keys[key]; ok {
+		return c
+	}
+	if i := strings.LastIndexByte(key, '_'); i >= 0 {
+		return r.keys[key[i+1:]]
+	}
+	return nil
+}
+
+// Sensitive 字段名是否需要脱敏
+func (r *Redactor) Sensitive(key string) bool {
+	return !r.disabled && r.keyRule(key) != nil
+}
+
+// String 脱敏任意文本，处理文本中的 key=value、key: value、"key":"value" 和正则规则
+func (r *Redactor) String(s string) string {
+	if r.disabled || s == "" {
+		return s
+	}
+	//先按正则处理，Authorization: Bearer xxx 这样带空格的值整体替换
+	for _, c := range r.patterns {
+		s = c.replace(s)
+	}
+	if r.pairs != nil {
+		s = r.replacePairs(s)
+	}
+	return s
+}
+
+func (r *Redactor) replacePairs(s string) string {
+	matches := r.pairs.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var (
+		buf  strings.Builder
+		last int
+	)
+	for _, m := range matches {
+		c := r.keyRule(s[m[2]:m[3]])
+		if c == nil {
+			continue
+		}
+		//值在三种形式中的一个分组：双引号、单引号、不带引号
+		start, end := m[6], m[7]
+		for i := 8; start < 0 && i+1 < len(m); i += 2 {
+			start, end = m[i], m[i+1]
+		}
+		buf.WriteString(s[last:start])
+		buf.WriteString(c.apply(s[start:end]))
+		last = end
+	}
+	buf.WriteString(s[last:])
+	return buf.String()
+}
+
+// Value 脱敏 key 对应的值，字段名命中规则时整体替换，字符串按 String 处理，其他类型原样返回
+func (r *Redactor) Value(key string, value interface{}) interface{} {
+	if r.disabled || value == nil {
+		return value
+	}
+	if c := r.keyRule(key); c != nil {
+		return c.apply(stringify(value))
+	}
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case []byte:
+		return r.String(string(v))
+	case error:
+		return r.String(v.Error())
+	case map[string]interface{}:
+		return r.Map(v)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i := range v {
+			res[i] = r.Value("", v[i])
+		}
+		return res
+	}
+	return value
+}
+
+// Map 返回脱敏后的副本，嵌套的 map 和数组也会处理
+func (r *Redactor) Map(m map[string]interface{}) map[string]interface{} {
+	if r.disabled || m == nil {
+		return m
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = r.Value(k, v)
+	}
+	return res
+}
+
+// JSON 脱敏json，字段名命中规则的值整体替换，字符串按 String 处理
+// 不是json时按文本处理；结果中对象的字段按名字排序
+func (r *Redactor) JSON(data []byte) []byte {
+	if r.disabled || len(data) == 0 {
+		return data
+	}
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return []byte(r.String(string(data)))
+	}
+	res, err := json.Marshal(r.Value("", v))
+	if err != nil {
+		return []byte(r.String(string(data)))
+	}
+	return res
+}
+
+// URL 脱敏url中的查询参数，同时处理其他部分中的正则规则
+func (r *Redactor) URL(raw string) string {
+	if r.disabled {
+		return raw
+	}
+	path, query, ok := strings.Cut(raw, "?")
+	if !ok {
+		return r.String(raw)
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		if c := r.keyRule(key); c != nil {
+			params[i] = key + "=" + c.apply(value)
+		} else {
+			params[i] = key + "=" + r.String(value)
+		}
+	}
+	return r.String(path) + "?" + strings.Join(params, "&")
+}
+
+// Command 格式化并脱敏redis等命令，命中规则的参数之后的一个参数整体替换，AUTH 的参数全部替换
+func (r *Redactor) Command(args []interface{}) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = stringify(arg)
+		if strings.ContainsAny(parts[i], " \t\r\n\"") {
+			parts[i] = strconv.Quote(parts[i])
+		}
+	}
+	if r.disabled {
+		return strings.Join(parts, " ")
+	}
+	for i := 1; i < len(parts); i++ {
+		if strings.EqualFold(parts[0], "auth") {
+			parts[i] = r.mask
+			continue
+		}
+		if c := r.keyRule(stringify(args[i-1])); c != nil {
+			parts[i] = c.apply(stringify(args[i]))
+		}
+	}
+	return r.String(strings.Join(parts, " "))
+}
+
+func stringify(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case fmt.Stringer:
+		return s.String()
+	case error:
+		return s.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+var (
+	current  atomic.Value //*Redactor
+	loadOnce sync.Once
+	noop     = &Redactor{disabled: true}
+)
+
+// Default 当前使用的规则，第一次使用时读取配置 server.Redact，配置错误时只使用默认规则
+func Default() *Redactor {
+	loadOnce.Do(func() {
+		if current.Load() != nil {
+			return
+		}
+		conf := &Conf{}
+		if err := g.Cfg().GetStruct("server.Redact", conf); err != nil {
+			g.Log().Warningf("redact config error, %v", err)
+		}
+		r, err := New(conf)
+		if err != nil {
+			g.Log().Warningf("redact config error, use default rules, %v", err)
+			r, _ = New(&Conf{})
+		}
+		current.Store(r)
+	})
+	if r, ok := current.Load().(*Redactor); ok {
+		return r
+	}
+	return noop
+}
+
+// Configure 整体替换当前使用的规则，规则错误时返回错误并保留之前的
+func Configure(conf *Conf) error {
+	r, err := New(conf)
+	if err != nil {
+		return err
+	}
+	current.Store(r)
+	return nil
+}
+
+// SetConfig 解析toml/json/yaml格式的 Conf 并替换当前使用的规则，参数和 acm.KeyCallback 一致：
+//
+//	acm.GetAcm().ListenKey("redact", redact.SetConfig)
+func SetConfig(content string) error {
+	conf := &Conf{}
+	if strings.TrimSpace(content) != "" {
+		j, err := gjson.LoadContent(content)
+		if err != nil {
+			return gerror.Wrap(err, "redact config parse error")
+		}
+		if err := j.Struct(conf); err != nil {
+			return gerror.Wrap(err, "redact config parse error")
+		}
+	}
+	return Configure(conf)
+}
+
+// String 使用当前规则脱敏文本，见 Redactor.String
+func String(s string) string {
+	return Default().String(s)
+}
+
+// Value 使用当前规则脱敏 key 对应的值，见 Redactor.Value
+func Value(key string, value interface{}) interface{} {
+	return Default().Value(key, value)
+}
+
+// Map 使用当前规则脱敏，返回副本，见 Redactor.Map
+func Map(m map[string]interface{}) map[string]interface{} {
+	return Default().Map(m)
+}
+
+// JSON 使用当前规则脱敏json，见 Redactor.JSON
+func JSON(data []byte) []byte {
+	return Default().JSON(data)
+}
+
+// URL 使用当前规则脱敏url，见 Redactor.URL
+func URL(raw string) string {
+	return Default().URL(raw)
+}
+
+// Command 使用当前规则格式化并脱敏命令，见 Redactor.Command
+func Command(args []interface{}) string {
+	return Default().Command(args)
+}
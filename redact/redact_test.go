@@ -0,0 +1,135 @@
+package redact
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestRedactor(t *testing.T, conf *Conf) *Redactor {
+	t.Helper()
+	r, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return r
+}
+
+func TestString(t *testing.T) {
+	r := newTestRedactor(t, &Conf{})
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"login token=abc123&uid=7", "login token=***&uid=7"},
+		{`{"password": "p@ss", "name": "tom"}`, `{"password": "***", "name": "tom"}`},
+		{`{"password": "my secret", "name": "tom"}`, `{"password": "***", "name": "tom"}`},
+		{`secret='a b, c' uid=1`, `secret='***' uid=1`},
+		{`{"token":"a\"b c"}`, `{"token":"***"}`},
+		{"access_token: xyz, expire: 10", "access_token: ***, expire: 10"},
+		{"call +86 13812345678 failed", "call +86 138****678 failed"},
+		{"call +8613812345678, 138-1234-5678", "call +86138****678, 138****678"},
+		{"order 13812345678 uid=15912345678", "order 13812345678 uid=15912345678"},
+		{"phone=13812345678", "phone=138****678"},
+		{"Authorization: Bearer abc.def", "Authorization: ***"},
+		{"jwt eyJhbGci.eyJzdWIi.c2lnbmF0 end", "jwt *** end"},
+		{"tokens=5 uid=19912345678901", "tokens=5 uid=19912345678901"},
+	}
+	for _, tt := range tests {
+		if got := r.String(tt.in); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	r := newTestRedactor(t, &Conf{NoDefaults: true, Mask: "[hidden]", Rules: []Rule{
+		{Keys: []string{"password"}},
+		{Keys: []string{"email"}, Strategy: StrategyHash},
+		{Keys: []string{"card"}, Strategy: StrategyPartial, Keep: 4},
+		{Keys: []string{"memo"}, Strategy: StrategyRemove},
+	}})
+	m := r.Map(map[string]interface{}{
+		"password": "x", "email": "a@b.c", "bank_card": "6222020000001234", "memo": "hi", "phone": "13812345678",
+	})
+	if m["password"] != "[hidden]" || m["bank_card"] != "6222****1234" || m["memo"] != "" || m["phone"] != "13812345678" {
+		t.Errorf("Map() = %v", m)
+	}
+	if email, _ := m["email"].(string); !strings.HasPrefix(email, "sha256:") || len(email) != 19 || email != r.Value("email", "a@b.c") {
+		t.Errorf("hash = %v", m["email"])
+	}
+}
+
+func TestJSON(t *testing.T) {
+	r := newTestRedactor(t, &Conf{})
+	got := string(r.JSON([]byte(`{"query":{"term":{"mobile":13812345678}},"docs":[{"note":"call +86-13912345678","token":{"v":1}}]}`)))
+	want := `{"docs":[{"note":"call +86-139****678","token":"***"}],"query":{"term":{"mobile":"138****678"}}}`
+	if got != want {
+		t.Errorf("JSON() = %s, want %s", got, want)
+	}
+	if got := string(r.JSON([]byte("not json password=1"))); got != "not json password=***" {
+		t.Errorf("JSON(text) = %s", got)
+	}
+}
+
+func TestURLAndCommand(t *testing.T) {
+	r := newTestRedactor(t, &Conf{})
+	if got := r.URL("/go/user/info?token=abc&uid=1&note=138-1234-5678"); got != "/go/user/info?token=***&uid=1&note=138****678" {
+		t.Errorf("URL() = %s", got)
+	}
+	tests := []struct {
+		args []interface{}
+		want string
+	}{
+		{[]interface{}{"auth", "user", "secret"}, "auth *** ***"},
+		{[]interface{}{"hset", "user:1", "phone", "13812345678", "name", "tom cat"}, `hset user:1 phone 138****678 name "tom cat"`},
+		{[]interface{}{"get", []byte("token:abc")}, "get token:***"},
+		{[]interface{}{"incrby", "score", 3}, "incrby score 3"},
+	}
+	for _, tt := range tests {
+		if got := r.Command(tt.args); got != tt.want {
+			t.Errorf("Command(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	r := newTestRedactor(t, &Conf{})
+	if got := r.Value("error", errors.New("bad password=1")); got != "bad password=***" {
+		t.Errorf("Value(error) = %v", got)
+	}
+	if got := r.Value("count", 3); got != 3 {
+		t.Errorf("Value(int) = %v", got)
+	}
+	if got := r.Value("list", []interface{}{"+8613812345678", 1}); !reflect.DeepEqual(got, []interface{}{"+86138****678", 1}) {
+		t.Errorf("Value(list) = %v", got)
+	}
+	disabled := newTestRedactor(t, &Conf{Disabled: true})
+	if got := disabled.String("token=1"); got != "token=1" {
+		t.Errorf("disabled String() = %v", got)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	defer func() { _ = Configure(&Conf{}) }()
+	if err := SetConfig(`{"Rules":[{"Name":"card","Keys":["card"],"Strategy":"partial","Keep":4}]}`); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+	if got := String("card=6222020000001234 token=1"); got != "card=6222****1234 token=***" {
+		t.Errorf("String() = %s", got)
+	}
+	for _, content := range []string{
+		`{"Rules":[{"Name":"bad","Strategy":"shuffle","Keys":["a"]}]}`,
+		`{"Rules":[{"Name":"bad","Pattern":"("}]}`,
+		`{"Rules":[{"Name":"empty"}]}`,
+	} {
+		if err := SetConfig(content); err == nil {
+			t.Errorf("SetConfig(%s) error = nil", content)
+		}
+	}
+	//错误的配置不替换
+	if got := String("card=6222020000001234"); got != "card=6222****1234" {
+		t.Errorf("String() after bad config = %s", got)
+	}
+}
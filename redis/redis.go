@@ -3,6 +3,8 @@ package redis
 import (
 	"context"
 	"fmt"
+	"strings"
+
 	"github.com/go-redis/redis/extra/rediscmd"
 	"github.com/gogf/gf/errors/gerror"
 	"github.com/gogf/gf/frame/g"
@@ -13,6 +15,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/opentracing/opentracing-go"
 
+	"github.com/olaola-chat/slp-library/redact"
 	"github.com/olaola-chat/slp-library/tracer/wrap"
 )
 
@@ -74,9 +77,10 @@ var (
 func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
 	span, spCtx := wrap.StartOpentracingSpan(ctx, fmt.Sprintf("redis-%s", cmd.FullName()))
 	if span != nil {
+		//命令中可能有token、手机号等，脱敏后记录
 		span.LogFields(
 			log.String("db.system", "redis"),
-			log.String("db.statement", rediscmd.CmdString(cmd)),
+			log.String("db.statement", redact.Command(cmd.Args())),
 		)
 		return context.WithValue(spCtx, tracingRedisKey, true), nil
 	}
@@ -92,13 +96,17 @@ func (hook tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error
 }
 
 func (tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
-	summary, cmdsString := rediscmd.CmdsString(cmds)
+	summary, _ := rediscmd.CmdsString(cmds)
 	span, spCtx := wrap.StartOpentracingSpan(ctx, "redis-pipeline "+summary)
 	if span != nil {
+		statements := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			statements[i] = redact.Command(cmd.Args())
+		}
 		span.LogFields(
 			log.String("db.system", "redis"),
 			log.Int("db.redis.num_cmd", len(cmds)),
-			log.String("db.statement", cmdsString),
+			log.String("db.statement", strings.Join(statements, "\n")),
 		)
 		return context.WithValue(spCtx, tracingRedisKey, true), nil
 	}
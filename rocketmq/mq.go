@@ -34,6 +34,15 @@ func NewClient(name string) *Client {
 }
 
 func (c *Client) Produce(topic string, body []byte) error {
+	return c.Send(context.TODO(), &rmq_client.Message{
+		Topic: topic,
+		Body:  body,
+	})
+}
+
+// Send 发送消息，FIFO topic 通过 SetMessageGroup 指定顺序投递的分组
+func (c *Client) Send(ctx context.Context, msg *rmq_client.Message) error {
+	topic, body := msg.Topic, msg.Body
 	producer, err := rmq_client.NewProducer(&rmq_client.Config{
 		Endpoint: c.Config.EndPoint,
 		Credentials: &credentials.SessionCredentials{
@@ -51,11 +60,7 @@ func (c *Client) Produce(topic string, body []byte) error {
 		return err
 	}
 	defer producer.GracefulStop()
-	msg := &rmq_client.Message{
-		Topic: topic,
-		Body:  body,
-	}
-	_, err = producer.Send(context.TODO(), msg)
+	_, err = producer.Send(ctx, msg)
 	if err != nil {
 		g.Log().Errorf("rocketmq produce send error||topic=%s||body=%s", topic, string(body))
 		return err
@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/frame/g"
+	"github.com/gogf/gf/net/ghttp"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/olaola-chat/slp-library/i18n"
+	"github.com/olaola-chat/slp-library/loghook"
+)
+
+// Prefix 管理接口的统一前缀，不会注册到nginx
+const Prefix = "/admin/"
+
+// HealthPath 健康检查接口，k8s探针使用，任何一项检查失败返回503
+const HealthPath = "/health"
+
+var (
+	mu       sync.Mutex
+	handlers = map[string]ghttp.HandlerFunc{
+		"i18n/missing": RequireToken(i18nMissing),
+		"metrics":      metricsJSON,
+		"log/level":    RequireToken(logLevel),
+	}
+)
+
+// Register 注册一个管理接口，pattern 不含前缀，如 "i18n/missing"
+func Register(pattern string, handler ghttp.HandlerFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[pattern] = handler
+}
+
+// Bind 把所有管理接口绑定到server，http服务和rpc服务的探针端口都会调用
+func Bind(server *ghttp.Server) {
+	mu.Lock()
+	patterns := make([]string, 0, len(handlers))
+	for pattern := range handlers {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	bound := make(map[string]ghttp.HandlerFunc, len(handlers))
+	for _, pattern := range patterns {
+		bound[pattern] = handlers[pattern]
+	}
+	mu.Unlock()
+	for _, pattern := range patterns {
+		server.BindHandler(Prefix+pattern, bound[pattern])
+	}
+	server.BindHandler(HealthPath, health)
+}
+
+// RequireToken 需要认证的管理接口，请求头 X-Admin-Token 或 Authorization: Bearer 需要和配置 server.AdminToken 一致
+// 没有配置token时拒绝所有请求
+func RequireToken(handler ghttp.HandlerFunc) ghttp.HandlerFunc {
+	return func(r *ghttp.Request) {
+		token := g.Cfg().GetString("server.AdminToken")
+		got := r.Header.Get("X-Admin-Token")
+		if got == "" {
+			got = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			r.Response.Status = http.StatusForbidden
+			r.Response.WriteJsonExit(g.Map{"error": "forbidden"})
+		}
+		handler(r)
+	}
+}
+
+// logLevel 运行时调整日志级别，GET 查看，POST 设置，DELETE 删除，见 loghook.SetLevel
+// 参数 target 包路径前缀，uid 用户，level 级别，ttl 有效期如 30m；DELETE 时 all=1 删除所有
+func logLevel(r *ghttp.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		var ttl time.Duration
+		if s := r.GetString("ttl"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				r.Response.Status = http.StatusBadRequest
+				r.Response.WriteJsonExit(g.Map{"error": "ttl error, " + err.Error()})
+			}
+			ttl = d
+		}
+		rule := loghook.LevelRule{Target: r.GetString("target"), UID: r.GetUint32("uid"), Level: r.GetString("level")}
+		if _, err := loghook.SetLevel(rule, ttl); err != nil {
+			r.Response.Status = http.StatusBadRequest
+			r.Response.WriteJsonExit(g.Map{"error": err.Error()})
+		}
+		g.Log().Warningf("log level %+v set by %s for %v", rule, r.GetClientIp(), ttl)
+	case http.MethodDelete:
+		if r.GetBool("all") {
+			loghook.ResetLevels()
+		} else {
+			loghook.RemoveLevel(r.GetString("target"), r.GetUint32("uid"))
+		}
+	default:
+		r.Response.Status = http.StatusMethodNotAllowed
+		r.Response.WriteJsonExit(g.Map{"error": "method not allowed"})
+	}
+	base, rules := loghook.Levels()
+	r.Response.Status = http.StatusOK
+	r.Response.WriteJsonExit(g.Map{
+		"base":  base,
+		"rules": rules,
+	})
+}
+
+// i18nMissing 缺失翻译统计，参数 lang 过滤语言，POST reset=1 返回后清空
+func i18nMissing(r *ghttp.Request) {
+	keys := i18n.MissingKeys(r.GetString("lang"))
+	if r.Method == http.MethodPost && r.GetBool("reset") {
+		i18n.ResetMissingKeys()
+	}
+	r.Response.Status = http.StatusOK
+	r.Response.WriteJsonExit(g.Map{
+		"total": len(keys),
+		"keys":  keys,
+	})
+}
+
+// metricsJSON 输出 metrics.DefaultRegistry 中的所有统计，如kafka消费的积压、耗时
+func metricsJSON(r *ghttp.Request) {
+	r.Response.Status = http.StatusOK
+	r.Response.WriteJsonExit(metrics.DefaultRegistry)
+}
+
+// healthMu 健康检查的结果保存在检查项中，同时只执行一次
+var healthMu sync.Mutex
+
+// health 执行 metrics.DefaultRegistry 中注册的所有健康检查
+func health(r *ghttp.Request) {
+	status, failed := runHealthchecks(metrics.DefaultRegistry)
+	r.Response.Status = status
+	if status == http.StatusOK {
+		r.Response.WriteJsonExit(g.Map{"status": "ok"})
+	}
+	r.Response.WriteJsonExit(g.Map{
+		"status": "unhealthy",
+		"checks": failed,
+	})
+}
+
+// runHealthchecks 返回状态码和失败的检查项
+func runHealthchecks(registry metrics.Registry) (int, map[string]string) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	registry.RunHealthchecks()
+	failed := make(map[string]string)
+	registry.Each(func(name string, i interface{}) {
+		if h, ok := i.(metrics.Healthcheck); ok && h.Error() != nil {
+			failed[name] = h.Error().Error()
+		}
+	})
+	if len(failed) > 0 {
+		return http.StatusServiceUnavailable, failed
+	}
+	return http.StatusOK, nil
+}
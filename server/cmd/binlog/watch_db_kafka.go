@@ -28,7 +28,7 @@ func NewWatchWorkers(
 
 	workers := make([]*kafka.Worker, 0, count)
 	for i := 0; i < count; i++ {
-		worker, err := kafka.NewConsumerWorker(cfg, wrap.receiveMsg)
+		worker, err := kafka.NewConsumerWorkerCtx(cfg, wrap.receiveMsg)
 		if err != nil {
 			return nil, err
 		}
@@ -38,45 +38,55 @@ func NewWatchWorkers(
 	return workers, nil
 }
 
+// RunWorkers 运行所有worker，收到退出信号后等待处理中的消息完成并提交offset
 func RunWorkers(workers []*kafka.Worker) {
 	if len(workers) == 0 {
 		return
 	}
+	ctx, stop := signal.NotifyContext(context.Background(),
+		os.Interrupt, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer stop()
 
-	count := len(workers)
-
-	wg := &sync.WaitGroup{}
-	stops := make([]chan bool, 0)
-
-	for i := 0; i < count; i++ {
-		stop := make(chan bool, 1)
-		stops = append(stops, stop)
-		_ = workers[i].Start(stop, wg)
+	if err := RunWorkersCtx(ctx, workers); err != nil {
+		g.Log().Errorf("RunWorkers failed, %v", err)
 	}
+	g.Log().Println("RunWorkers completely closed")
+}
 
-	sign := make(chan os.Signal, 1)
-	signal.Notify(sign, os.Interrupt, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
-
-	v := <-sign
-	g.Log().Println("RunWorkers receive sign", v)
-	for _, stop := range stops {
-		stop <- true
+// RunWorkersCtx 运行所有worker直到 ctx 结束，任何一个worker出错都会停止其他worker，返回第一个错误
+func RunWorkersCtx(ctx context.Context, workers []*kafka.Worker) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker *kafka.Worker) {
+			defer wg.Done()
+			if err := worker.Run(ctx); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(worker)
 	}
-
 	wg.Wait()
-	g.Log().Println("RunWorkers completely closed")
+	return firstErr
 }
 
 type cbWrap struct {
 	tables map[string]Callback
 }
 
-func (c cbWrap) receiveMsg(msg *sarama.ConsumerMessage) error {
+// receiveMsg ctx 中有写入方的链路，回调中的redis、sql等调用会加入原来的链路
+func (c cbWrap) receiveMsg(ctx context.Context, msg *sarama.ConsumerMessage) error {
 	now := time.Now().UnixNano()
 
-	//ctx := myctx.NewContext(msg.Topic)
-	ctx := context.Background()
-
 	kafkaTime := msg.Timestamp.UnixNano()
 	kafkaDur := float64(now-kafkaTime) / 1e6 //kafka到now的时间段
 
@@ -0,0 +1,83 @@
+package binlog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olaola-chat/slp-library/kafka"
+	"github.com/olaola-chat/slp-library/kafka/kafkatest"
+)
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+// recorder 记录收到的变更
+type recorder struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+func (r *recorder) New() interface{} { return &user{} }
+
+func (r *recorder) record(op string, val []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range val {
+		r.changes = append(r.changes, op+":"+v.(*user).Name)
+	}
+}
+
+func (r *recorder) Inserted(ctx context.Context, val []interface{}, res *CanalJSON) error {
+	r.record("insert", val)
+	return nil
+}
+
+func (r *recorder) Updated(ctx context.Context, val []interface{}, res *CanalJSON) error {
+	r.record("update", val)
+	return nil
+}
+
+func (r *recorder) Deleted(ctx context.Context, val []interface{}, res *CanalJSON) error {
+	r.record("delete", val)
+	return nil
+}
+
+func TestRunWorkersCtx(t *testing.T) {
+	broker := kafkatest.NewBroker()
+	users := &recorder{}
+	wrap := cbWrap{tables: map[string]Callback{"user": users}}
+	cfg := &ConsumerConf{GroupName: "binlog", Topics: []string{"binlog"}}
+	workers := []*kafka.Worker{broker.NewWorker(cfg, wrap.receiveMsg)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- RunWorkersCtx(ctx, workers)
+	}()
+
+	broker.Publish("binlog", "", `{"type":"INSERT","table":"user","data":[{"id":"1","name":"tom"},{"id":"2","name":"amy"}]}`)
+	broker.Publish("binlog", "", `{"type":"UPDATE","table":"user","data":[{"id":"1","name":"tim"}],"old":[{"name":"tom"}]}`)
+	broker.Publish("binlog", "", `{"type":"DELETE","table":"user","data":[{"id":"2","name":"amy"}]}`)
+	broker.Publish("binlog", "", `{"type":"INSERT","table":"room","data":[{"id":"1"}]}`)
+	broker.Publish("binlog", "", `not json`)
+	broker.WaitIdle(t, "binlog", time.Second)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("RunWorkersCtx() error = %v", err)
+	}
+
+	want := []string{"insert:tom", "insert:amy", "update:tim", "delete:amy"}
+	if len(users.changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", users.changes, want)
+	}
+	for i := range want {
+		if users.changes[i] != want[i] {
+			t.Errorf("changes = %v, want %v", users.changes, want)
+			break
+		}
+	}
+}
@@ -34,10 +34,10 @@ func run(name string, action string, servers []interface{}) {
 					tool.Str.FirstToUpper(action)
 				g.Log().SetAsync(true)
 				g.Log().SetFlags(glog.F_FILE_SHORT)
-				g.Log().SetStack(false)
-				g.Log().SetWriter(loghook.NewLogWriter(serverName))
+				loghook.Setup(g.Log(), serverName)
 
 				method.Call([]reflect.Value{})
+				_ = loghook.Close(3 * time.Second)
 				return
 			}
 			panic(fmt.Sprintf("error action name with %s", action))
@@ -64,7 +64,6 @@ func Run(servers []interface{}) {
 	g.Log().SetAsync(true)
 	g.Log().SetHeaderPrint(true)
 	g.Log().SetFlags(glog.F_FILE_SHORT)
-	g.Log().SetStack(false)
 
 	acm.GetAcm()
 
@@ -103,7 +102,7 @@ func Run(servers []interface{}) {
 		panic(err)
 	}
 
-	g.Log().SetWriter(loghook.NewLogWriter("poCmd_" + cmdName + "_" + cmdActionName))
+	loghook.Setup(g.Log(), "poCmd_"+cmdName+"_"+cmdActionName)
 
 	run(cmdName, cmdActionName, servers)
 }
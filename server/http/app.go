@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/olaola-chat/slp-library/consul"
+	"github.com/olaola-chat/slp-library/loghook"
+	"github.com/olaola-chat/slp-library/server/admin"
 	_ "github.com/olaola-chat/slp-library/tracer"
 
 	"github.com/gogf/gf/frame/g"
@@ -62,6 +64,7 @@ func appRun(route func(server *ghttp.Server)) {
 		time.Sleep(time.Second * 3)
 		r.Response.Write("ok")
 	})
+	admin.Bind(server)
 
 	route(server)
 
@@ -103,4 +106,6 @@ func appRun(route func(server *ghttp.Server)) {
 
 	//关闭注册服务
 	_ = consul.GetNginx().Close()
+	//写完缓冲中的日志
+	_ = loghook.Close(3 * time.Second)
 }
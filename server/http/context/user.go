@@ -8,6 +8,7 @@ import (
 	"github.com/gogf/gf/text/gregex"
 	"github.com/syyongx/php2go"
 
+	"github.com/olaola-chat/slp-library/i18n"
 	"github.com/olaola-chat/slp-library/tool"
 )
 
@@ -31,16 +32,17 @@ type ContextUser struct {
 	UID               uint32
 	AppID             uint8 //用户对应的APPID
 	Salt              string
-	Platform          string //用户平台
-	Time              uint32 //令牌生成时间
-	Agent             string //用户的Agent
-	Channel           string //用户所属渠道
-	Package           string //当前请求的包名
-	Language          string //用户的原始语言
-	Area              string //用户的原始地区
-	NativeVersion     uint32 //客户端版本号 ip2long
-	NativeMainVersion uint32 //build号为0的版本
-	JsVersion         uint32 //已经无用
+	Platform          string   //用户平台
+	Time              uint32   //令牌生成时间
+	Agent             string   //用户的Agent
+	Channel           string   //用户所属渠道
+	Package           string   //当前请求的包名
+	Language          string   //用户的原始语言
+	Languages         []string //用户偏好的语言，按优先级排列，第一个就是 Language
+	Area              string   //用户的原始地区
+	NativeVersion     uint32   //客户端版本号 ip2long
+	NativeMainVersion uint32   //build号为0的版本
+	JsVersion         uint32   //已经无用
 	Mac               string
 	DeviceName        string
 	Did               string
@@ -114,21 +116,17 @@ func NewContextUserFromRequest(r *ghttp.Request) *ContextUser {
 	user.Channel = r.GetHeader("User-Channel")
 	user.Did = r.GetHeader("User-Did")
 
-	language := r.GetHeader("Accept-Language")
-	if len(language) > 0 {
-		//zh-CN,zh;q=0.9
-		//todo... 优化，判断本地有哪些语言
-		langArray := strings.Split(language, ",")
-		user.Language = strings.ToLower(langArray[0])
-	}
-	language = r.GetHeader("User-Langauge")
-	if len(language) > 0 {
-		user.Language = strings.Trim(strings.ToLower(language), " ")
-	} else {
+	//zh-CN,zh;q=0.9
+	user.Languages = i18n.ParseAcceptLanguage(r.GetHeader("Accept-Language"))
+	language := r.GetHeader("User-Langauge")
+	if len(language) == 0 {
 		language = r.GetQueryString("lang")
-		if len(language) > 0 {
-			user.Language = strings.ToLower(language)
-		}
+	}
+	if language = strings.Trim(strings.ToLower(language), " "); len(language) > 0 {
+		user.Languages = append([]string{language}, user.Languages...)
+	}
+	if len(user.Languages) > 0 {
+		user.Language = user.Languages[0]
 	}
 	user.IsSimulator = func() bool {
 		if r.GetHeader("User-Issimulator") == "true" {
@@ -71,9 +71,9 @@ func (c *ctxMiddleware) Ctx(r *ghttp.Request) {
 			r.Cookie.Remove("token")
 		}
 	}
-	// TODO: 过滤支持的语言
-	rbpI18n.SetLanguage(ctxUser.Language) //从header中获取的
-	r.Validator.SetLanguage(ctxUser.Language)
+	//根据i18n资源文件中支持的语言协商，生成回退链
+	rbpI18n.SetLanguages(i18n2.Negotiate(ctxUser.Languages, ctxUser.Area))
+	r.Validator.SetLanguage(rbpI18n.GetLanguage())
 	// 执行下一步请求逻辑
 	r.Middleware.Next()
 }
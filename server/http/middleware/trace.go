@@ -9,7 +9,9 @@ import (
 	"github.com/opentracing/opentracing-go/log"
 	"github.com/uber/jaeger-client-go"
 
+	"github.com/olaola-chat/slp-library/redact"
 	context2 "github.com/olaola-chat/slp-library/server/http/context"
+	"github.com/olaola-chat/slp-library/tracer/wrap"
 )
 
 const LogTrackKey = "TraceId"
@@ -36,16 +38,8 @@ func Trace(r *ghttp.Request) {
 		//框架默认在整个业务之后关闭，会导致链路无法追踪
 		//代码做了更改，可以多次close
 		// r.Session.Close()
-		// 删除敏感数据
-		if len(r.GetString("token")) > 0 {
-			// 链路追踪的一些数据
-			values := r.URL.Query()
-			values.Del("token")
-			r.URL.RawQuery = values.Encode()
-			rootSpan.SetTag("http.url", r.URL.String())
-		} else {
-			rootSpan.SetTag("http.url", r.RequestURI)
-		}
+		// 脱敏url中的token等参数
+		rootSpan.SetTag("http.url", redact.URL(r.RequestURI))
 
 		ctxUser, ok := r.GetCtxVar(context2.ContextUserKey).Interface().(*context2.ContextUser)
 		if !ok {
@@ -64,8 +58,8 @@ func Trace(r *ghttp.Request) {
 		rootSpan.SetTag("http.method", r.Method)
 		rootSpan.SetTag("http.status_code", r.Response.Status)
 		if err := r.GetError(); err != nil {
-			rootSpan.SetTag("error", err.Error())
-			rootSpan.LogFields(
+			wrap.SetTag(rootSpan, "error", err.Error())
+			wrap.LogFields(rootSpan,
 				log.String("event", "error"),
 				log.String("stack", err.Error()),
 			)
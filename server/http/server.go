@@ -6,7 +6,9 @@ import (
 	"github.com/gogf/gf/net/ghttp"
 
 	"github.com/olaola-chat/slp-library/acm"
+	"github.com/olaola-chat/slp-library/i18n"
 	"github.com/olaola-chat/slp-library/loghook"
+	"github.com/olaola-chat/slp-library/redact"
 
 	_ "github.com/olaola-chat/slp-library/tracer"
 
@@ -20,10 +22,27 @@ func Run(route func(server *ghttp.Server)) {
 	g.Log().SetAsync(true)
 	g.Log().SetHeaderPrint(true)
 	g.Log().SetFlags(glog.F_FILE_SHORT)
-	g.Log().SetStack(false)
 	g.Log().Info("work begin")
 
 	acm.GetAcm()
+	//翻译从ACM目录热更新，资源文件作为基础
+	if dir := g.Cfg().GetString("i18n.AcmDir"); dir != "" {
+		if err := acm.GetAcm().ListenDir(dir, i18n.SetBundles); err != nil {
+			g.Log().Error("i18n listen acm error", dir, err)
+		}
+	}
+	//日志级别从ACM临时调整，见 loghook.SetLevels
+	if key := g.Cfg().GetString("server.LogLevelAcmKey"); key != "" {
+		if err := acm.GetAcm().ListenKey(key, loghook.SetLevels); err != nil {
+			g.Log().Error("log level listen acm error", key, err)
+		}
+	}
+	//脱敏规则从ACM热更新，ACM中的规则整体替换配置文件中的 server.Redact
+	if key := g.Cfg().GetString("server.RedactAcmKey"); key != "" {
+		if err := acm.GetAcm().ListenKey(key, redact.SetConfig); err != nil {
+			g.Log().Error("redact listen acm error", key, err)
+		}
+	}
 
 	var cfgName string
 
@@ -47,7 +66,7 @@ func Run(route func(server *ghttp.Server)) {
 	}
 
 	//设置日志
-	g.Log().SetWriter(loghook.NewLogWriter("SlpGoHttp"))
+	loghook.Setup(g.Log(), "SlpGoHttp")
 
 	appRun(route)
 }
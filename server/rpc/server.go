@@ -15,9 +15,12 @@ import (
 
 	"github.com/olaola-chat/slp-library/acm"
 	"github.com/olaola-chat/slp-library/env"
+	"github.com/olaola-chat/slp-library/i18n"
+	"github.com/olaola-chat/slp-library/server/admin"
 	"github.com/olaola-chat/slp-library/server/rpc/plugins"
 
 	"github.com/olaola-chat/slp-library/loghook"
+	"github.com/olaola-chat/slp-library/redact"
 	"github.com/olaola-chat/slp-library/tool"
 	_ "github.com/olaola-chat/slp-library/tracer"
 
@@ -70,6 +73,7 @@ func (s *Server) healthy() (err error) {
 			r.Response.Status = http.StatusOK
 			r.Response.WriteExit("unregister ok!")
 		})
+		admin.Bind(server)
 		go server.Run()
 	}
 	return nil
@@ -237,10 +241,27 @@ func Run(servers map[string]*ServerCfg) {
 	g.Log().SetAsync(true)
 	g.Log().SetHeaderPrint(true)
 	g.Log().SetFlags(glog.F_FILE_SHORT)
-	g.Log().SetStack(false)
 	g.Log().Info("work begin")
 
 	acm.GetAcm()
+	//翻译从ACM目录热更新，资源文件作为基础
+	if dir := g.Cfg().GetString("i18n.AcmDir"); dir != "" {
+		if err := acm.GetAcm().ListenDir(dir, i18n.SetBundles); err != nil {
+			g.Log().Error("i18n listen acm error", dir, err)
+		}
+	}
+	//日志级别从ACM临时调整，见 loghook.SetLevels
+	if key := g.Cfg().GetString("server.LogLevelAcmKey"); key != "" {
+		if err := acm.GetAcm().ListenKey(key, loghook.SetLevels); err != nil {
+			g.Log().Error("log level listen acm error", key, err)
+		}
+	}
+	//脱敏规则从ACM热更新，ACM中的规则整体替换配置文件中的 server.Redact
+	if key := g.Cfg().GetString("server.RedactAcmKey"); key != "" {
+		if err := acm.GetAcm().ListenKey(key, redact.SetConfig); err != nil {
+			g.Log().Error("redact listen acm error", key, err)
+		}
+	}
 
 	var serviceName string
 	var cfgName string
@@ -274,7 +295,7 @@ func Run(servers map[string]*ServerCfg) {
 		panic(err)
 	}
 
-	g.Log().SetWriter(loghook.NewLogWriter("SlpRpc." + tool.Str.FirstToUpper(serviceName)))
+	loghook.Setup(g.Log(), "SlpRpc."+tool.Str.FirstToUpper(serviceName))
 
 	var pwg sync.WaitGroup
 	pwg.Add(1)
@@ -296,4 +317,5 @@ func Run(servers map[string]*ServerCfg) {
 	}
 	pwg.Wait()
 	g.Log().Info("rpc server closed complete")
+	_ = loghook.Close(3 * time.Second)
 }
@@ -1,16 +1,20 @@
 package tool
 
 import (
-	"github.com/gogf/gf/util/gconv"
+	"strconv"
 	"strings"
+
+	"github.com/gogf/gf/util/gconv"
 )
 
 // Path 单例selfpath，并导出
+// 需要按用户语言展示的数字请使用 i18n.FormatNumber/FormatCompact/FormatCurrency
 var NumberFormat = &numberFormat{}
 
 type numberFormat struct{}
 
 // 99,999,999.09
+// 英文缩写 K/M/B，十亿以上是B
 func (*numberFormat) ScienceFormat(num int) (value float32, unit string) {
 	switch {
 	case num < 1000:
@@ -23,79 +27,65 @@ func (*numberFormat) ScienceFormat(num int) (value float32, unit string) {
 		value = gconv.Float32(num) / 1000000
 		unit = "M"
 	default:
-		value = gconv.Float32(num) / 1000000
-		unit = "M"
+		value = gconv.Float32(num) / 1000000000
+		unit = "B"
 	}
 	return
 }
 
-// 格式化保留小数点相应位数
-func (*numberFormat) DecimalPoint(value float32, radixNum int) float32 {
-	str := gconv.String(value)
-	strS := strings.Split(str, ".")
-	var left, right string
-	if len(strS) == 1 {
-		left = strS[0]
-		right = "0"
-	} else {
-		left = strS[0]
-		right = strS[1]
+// splitFloat32 float32 转成能还原该值的最短十进制表示，拆成整数和小数部分
+// 避免 gconv.String 得到 0.100000001 这样的数字
+func splitFloat32(value float32) (sign, left, right string) {
+	str := strconv.FormatFloat(float64(value), 'f', -1, 32)
+	if strings.HasPrefix(str, "-") {
+		sign, str = "-", str[1:]
 	}
-	rightVal := make([]byte, 0)
-	rightLen := len(right)
-	for i := 0; i < radixNum; i++ {
-		if rightLen-1 < i {
-			rightVal = append(rightVal, right[i])
-		} else {
-			rightVal = append(rightVal, '0')
-		}
+	left = str
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		left, right = str[:i], str[i+1:]
+	}
+	return
+}
+
+// truncateRight 截取 num 位小数，不足补0
+func truncateRight(right string, num int) string {
+	if num <= 0 {
+		return ""
 	}
-	if len(rightVal) > 0 {
-		str = left + "." + string(rightVal)
-	} else {
-		str = left
+	if len(right) >= num {
+		return right[:num]
+	}
+	return right + strings.Repeat("0", num-len(right))
+}
+
+// 格式化保留小数点相应位数，多余的位数直接截掉
+func (*numberFormat) DecimalPoint(value float32, radixNum int) float32 {
+	sign, left, right := splitFloat32(value)
+	str := sign + left
+	if right = truncateRight(right, radixNum); right != "" {
+		str += "." + right
 	}
 	return gconv.Float32(str)
 }
 
-// 格式化成科学计数 10,000.989
+// 格式化成科学计数 10,000.989，多余的位数直接截掉
 func (*numberFormat) DecimalFormat(value float32, rightNum int) string {
 	if value == 0 {
 		return "0"
 	}
-	var left, right, str string
-	str = gconv.String(value)
-	strS := strings.Split(str, ".")
-	if len(strS) == 1 {
-		left = strS[0]
-		right = "0"
-	} else {
-		left = strS[0]
-		right = strS[1]
-	}
+	sign, left, right := splitFloat32(value)
 
-	rightVal := make([]byte, 0)
-	leftLen := len(left)
-	base := ""
-	if leftLen > 3 {
-		start := leftLen % 3
-		base = left[0:start]
-		for start < leftLen-1 {
-			base = base + "," + left[start:start+3]
-			start = start + 3
+	var base strings.Builder
+	base.WriteString(sign)
+	for i := range left {
+		if i > 0 && (len(left)-i)%3 == 0 {
+			base.WriteByte(',')
 		}
-	} else {
-		base = left
+		base.WriteByte(left[i])
 	}
-
-	rightLen := len(right)
-	for i := 0; i < rightNum; i++ {
-		if i > rightLen-1 {
-			rightVal = append(rightVal, '0')
-		} else {
-			rightVal = append(rightVal, right[i])
-		}
+	if right = truncateRight(right, rightNum); right != "" {
+		base.WriteByte('.')
+		base.WriteString(right)
 	}
-	str = base + "." + string(rightVal)
-	return str
+	return base.String()
 }
@@ -0,0 +1,46 @@
+package tool
+
+import (
+	"testing"
+)
+
+func Test_numberFormat_ScienceFormat(t *testing.T) {
+	tests := []struct {
+		num   int
+		value float32
+		unit  string
+	}{
+		{999, 999, ""},
+		{1500, 1.5, "K"},
+		{2500000, 2.5, "M"},
+		{3000000000, 3, "B"},
+	}
+	for _, tt := range tests {
+		value, unit := NumberFormat.ScienceFormat(tt.num)
+		if value != tt.value || unit != tt.unit {
+			t.Errorf("ScienceFormat(%d) = %v%s, want %v%s", tt.num, value, unit, tt.value, tt.unit)
+		}
+	}
+}
+
+func Test_numberFormat_DecimalFormat(t *testing.T) {
+	tests := []struct {
+		value    float32
+		rightNum int
+		want     string
+	}{
+		{0.1, 3, "0.100"},
+		{123.456, 2, "123.45"},
+		{100000, 1, "100,000.0"},
+		{1234567, 0, "1,234,567"},
+		{-12345.5, 2, "-12,345.50"},
+	}
+	for _, tt := range tests {
+		if got := NumberFormat.DecimalFormat(tt.value, tt.rightNum); got != tt.want {
+			t.Errorf("DecimalFormat(%v, %d) = %q, want %q", tt.value, tt.rightNum, got, tt.want)
+		}
+	}
+	if got := NumberFormat.DecimalPoint(1.256, 2); got != 1.25 {
+		t.Errorf("DecimalPoint(1.256, 2) = %v, want 1.25", got)
+	}
+}
@@ -92,7 +92,7 @@ func (c wrappedConn) PrepareContext(ctx context.Context, query string) (stmt dri
 		}
 		span, _ := StartOpentracingSpan(ctx, "sql-query")
 		if span != nil {
-			span.SetTag("db.statement", query)
+			SetTag(span, "db.statement", query)
 		}
 		return wrappedStmt{
 			ctx:    ctx,
@@ -183,7 +183,7 @@ func (t wrappedTx) Commit() (err error) {
 	defer func() {
 		if t.span != nil {
 			if err != nil {
-				t.span.LogFields(
+				LogFields(t.span,
 					log.String("event", "error"),
 					log.String("stack", trimError(err)),
 				)
@@ -199,7 +199,7 @@ func (t wrappedTx) Rollback() (err error) {
 	defer func() {
 		if t.span != nil {
 			if err != nil {
-				t.span.LogFields(
+				LogFields(t.span,
 					log.String("event", "error"),
 					log.String("stack", trimError(err)),
 				)
@@ -237,7 +237,7 @@ func (s wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue)
 		res, err := stmtExecContext.ExecContext(ctx, args)
 		if err != nil {
 			if s.span != nil {
-				s.span.LogFields(
+				LogFields(s.span,
 					log.String("event", "error"),
 					log.String("stack", trimError(err)),
 				)
@@ -2,8 +2,13 @@ package wrap
 
 import (
 	"context"
+	"fmt"
+
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
 	"github.com/smallnest/rpcx/share"
+
+	"github.com/olaola-chat/slp-library/redact"
 )
 
 const (
@@ -45,3 +50,31 @@ func GetOpentracingEnabled(ctx context.Context) bool {
 	}
 	return false
 }
+
+// SetTag 按 redact 的规则脱敏后设置span的tag，span为nil时忽略
+func SetTag(span opentracing.Span, key string, value interface{}) {
+	if span != nil {
+		span.SetTag(key, redact.Value(key, value))
+	}
+}
+
+// LogFields 按 redact 的规则脱敏后记录span的日志，span为nil时忽略
+// 字符串和错误类型的值、以及字段名需要脱敏的值会记录为脱敏后的字符串
+func LogFields(span opentracing.Span, fields ...log.Field) {
+	if span == nil {
+		return
+	}
+	res := make([]log.Field, len(fields))
+	for i, f := range fields {
+		res[i] = f
+		switch f.Value().(type) {
+		case string, error:
+		default:
+			if !redact.Default().Sensitive(f.Key()) {
+				continue
+			}
+		}
+		res[i] = log.String(f.Key(), fmt.Sprint(redact.Value(f.Key(), f.Value())))
+	}
+	span.LogFields(res...)
+}